@@ -0,0 +1,172 @@
+// Copyright 2010 Gary Burd
+//
+// Licensed under the Apache License, Version 2.0 (the "License"): you may
+// not use this file except in compliance with the License. You may obtain
+// a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+// WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the
+// License for the specific language governing permissions and limitations
+// under the License.
+
+package twitterstream
+
+import (
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// SearchRecentV2URL is the Twitter API v2 recent search endpoint.
+const SearchRecentV2URL = "https://api.twitter.com/2/tweets/search/recent"
+
+// Backfill recovers the tweets missed while a stream was disconnected using
+// the recent search endpoint.
+//
+//  bf := &twitterstream.Backfill{
+//      BearerToken: token,
+//      Query:       twitterstream.BackfillQuery(track, follow),
+//  }
+//  ts := twitterstream.NewReconnectingStream(client, cred, url, params,
+//      twitterstream.OpenOnReconnect(func(gap time.Duration) {
+//          go bf.Fill(ctx, lastID, ch)
+//      }))
+type Backfill struct {
+	// BearerToken is the application's bearer token.
+	BearerToken string
+
+	// Query is the search query. Use BackfillQuery to create a query
+	// matching the track and follow parameters of a filter stream.
+	Query string
+
+	// Params are additional parameters for the search request such as the
+	// fields and expansions.
+	Params url.Values
+
+	// Dedupe filters tweets that were already delivered by the stream. Use
+	// the deduper specified with the OpenDedupe option.
+	Dedupe Deduper
+
+	// HTTPClient is the client used for requests. If nil, then
+	// http.DefaultClient is used.
+	HTTPClient *http.Client
+
+	// URL is the search endpoint. If empty, then SearchRecentV2URL is used.
+	URL string
+}
+
+// BackfillQuery returns a search query that matches tweets containing one of
+// the track phrases or created by one of the follow users.
+func BackfillQuery(track []string, follow []int64) string {
+	var terms []string
+	for _, phrase := range track {
+		if strings.Contains(phrase, " ") {
+			phrase = "(" + phrase + ")"
+		}
+		terms = append(terms, phrase)
+	}
+	for _, id := range follow {
+		terms = append(terms, "from:"+strconv.FormatInt(id, 10))
+	}
+	return strings.Join(terms, " OR ")
+}
+
+// Fill searches for the tweets matching the query with an ID greater than
+// sinceID and sends the tweets to ch, oldest first. Each tweet is sent in the
+// format of a line read from a v2 stream. Decode the message to a ResponseV2.
+// Fill returns when all tweets are sent, or when the context is done.
+func (b *Backfill) Fill(ctx context.Context, sinceID string, ch chan<- Message) error {
+	var tweets []json.RawMessage
+	nextToken := ""
+	for {
+		params := url.Values{}
+		for k, v := range b.Params {
+			params[k] = v
+		}
+		params.Set("query", b.Query)
+		params.Set("since_id", sinceID)
+		params.Set("max_results", "100")
+		if nextToken != "" {
+			params.Set("next_token", nextToken)
+		}
+		v, err := b.search(ctx, params)
+		if err != nil {
+			return err
+		}
+		tweets = append(tweets, v.Data...)
+		nextToken = v.Meta.NextToken
+		if nextToken == "" {
+			break
+		}
+	}
+
+	// The endpoint returns the newest tweets first.
+	for i := len(tweets) - 1; i >= 0; i-- {
+		if b.Dedupe != nil {
+			var t struct {
+				ID string `json:"id"`
+			}
+			if json.Unmarshal(tweets[i], &t) == nil {
+				if id, err := strconv.ParseInt(t.ID, 10, 64); err == nil && b.Dedupe.Seen(id) {
+					continue
+				}
+			}
+		}
+		raw := append(append([]byte(`{"data":`), tweets[i]...), '}')
+		select {
+		case ch <- Message{Kind: KindTweet, Raw: raw, Received: time.Now()}:
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+	return nil
+}
+
+type searchResponse struct {
+	Data []json.RawMessage `json:"data"`
+	Meta struct {
+		NextToken string `json:"next_token"`
+	} `json:"meta"`
+}
+
+func (b *Backfill) search(ctx context.Context, params url.Values) (*searchResponse, error) {
+	urlStr := b.URL
+	if urlStr == "" {
+		urlStr = SearchRecentV2URL
+	}
+	req, err := http.NewRequestWithContext(ctx, "GET", urlStr+"?"+params.Encode(), nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Authorization", "Bearer "+b.BearerToken)
+
+	client := b.HTTPClient
+	if client == nil {
+		client = http.DefaultClient
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	p, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode != 200 {
+		return nil, newHTTPStatusError(resp, p)
+	}
+	var v searchResponse
+	if err := json.Unmarshal(p, &v); err != nil {
+		return nil, err
+	}
+	return &v, nil
+}
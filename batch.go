@@ -0,0 +1,83 @@
+// Copyright 2010 Gary Burd
+//
+// Licensed under the Apache License, Version 2.0 (the "License"): you may
+// not use this file except in compliance with the License. You may obtain
+// a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+// WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the
+// License for the specific language governing permissions and limitations
+// under the License.
+
+package twitterstream
+
+import (
+	"context"
+	"io"
+)
+
+// Batch returns up to n messages from the channel. Batch waits for the first
+// message and then takes the messages that are already waiting on the
+// channel, so the batches are small when the stream is slow and large when
+// the application falls behind. Batch returns io.EOF if the channel is closed
+// before the first message and the context's error if the context is done
+// before the first message.
+//
+//  for {
+//      batch, err := twitterstream.Batch(ctx, messages, 100)
+//      if err == io.EOF {
+//          return nil
+//      } else if err != nil {
+//          return err
+//      }
+//      publish(batch)
+//  }
+func Batch(ctx context.Context, messages <-chan Message, n int) ([]Message, error) {
+	if n < 1 {
+		n = 1
+	}
+	var batch []Message
+	select {
+	case m, ok := <-messages:
+		if !ok {
+			return nil, io.EOF
+		}
+		batch = append(make([]Message, 0, n), m)
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+	for len(batch) < n {
+		select {
+		case m, ok := <-messages:
+			if !ok {
+				return batch, nil
+			}
+			batch = append(batch, m)
+		default:
+			return batch, nil
+		}
+	}
+	return batch, nil
+}
+
+// Settle completes the delivery of message m to a sink. If err is nil, then
+// Settle acknowledges and releases m. If err is not nil and onError is nil,
+// then Settle returns err and does not acknowledge m. Otherwise, Settle calls
+// onError with the message and the error, then acknowledges and releases m.
+//
+// The sinks in the subpackages of this package use Settle to implement their
+// OnError fields.
+func Settle(m Message, err error, onError func(m Message, err error)) error {
+	if err != nil {
+		if onError == nil {
+			return err
+		}
+		onError(m, err)
+	}
+	m.Ack()
+	m.Release()
+	return nil
+}
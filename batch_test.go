@@ -0,0 +1,89 @@
+// Copyright 2010 Gary Burd
+//
+// Licensed under the Apache License, Version 2.0 (the "License"): you may
+// not use this file except in compliance with the License. You may obtain
+// a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+// WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the
+// License for the specific language governing permissions and limitations
+// under the License.
+
+package twitterstream
+
+import (
+	"context"
+	"errors"
+	"io"
+	"testing"
+)
+
+func TestBatch(t *testing.T) {
+	ctx := context.Background()
+	messages := make(chan Message, 10)
+	for i := 0; i < 5; i++ {
+		messages <- Message{Source: string(rune('a' + i))}
+	}
+	batch, err := Batch(ctx, messages, 3)
+	if err != nil || len(batch) != 3 || batch[0].Source != "a" || batch[2].Source != "c" {
+		t.Fatalf("Batch = %v, %v, want a b c", batch, err)
+	}
+	batch, err = Batch(ctx, messages, 3)
+	if err != nil || len(batch) != 2 || batch[0].Source != "d" {
+		t.Fatalf("Batch = %v, %v, want d e", batch, err)
+	}
+	messages <- Message{Source: "f"}
+	close(messages)
+	batch, err = Batch(ctx, messages, 3)
+	if err != nil || len(batch) != 1 || batch[0].Source != "f" {
+		t.Fatalf("Batch = %v, %v, want f", batch, err)
+	}
+	if batch, err := Batch(ctx, messages, 3); err != io.EOF || batch != nil {
+		t.Fatalf("Batch on closed channel = %v, %v, want nil, io.EOF", batch, err)
+	}
+}
+
+func TestBatchContext(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if _, err := Batch(ctx, make(chan Message), 3); err != context.Canceled {
+		t.Fatalf("Batch returned %v, want %v", err, context.Canceled)
+	}
+}
+
+func TestSettle(t *testing.T) {
+	errFail := errors.New("fail")
+	for _, tt := range []struct {
+		err       error
+		onError   bool
+		wantErr   error
+		wantAck   bool
+		wantCalls int
+	}{
+		{nil, false, nil, true, 0},
+		{nil, true, nil, true, 0},
+		{errFail, false, errFail, false, 0},
+		{errFail, true, nil, true, 1},
+	} {
+		acked := false
+		calls := 0
+		m := Message{ack: func() { acked = true }}
+		var onError func(Message, error)
+		if tt.onError {
+			onError = func(m Message, err error) {
+				if acked {
+					t.Error("message acknowledged before OnError")
+				}
+				calls++
+			}
+		}
+		err := Settle(m, tt.err, onError)
+		if err != tt.wantErr || acked != tt.wantAck || calls != tt.wantCalls {
+			t.Errorf("Settle(%v, onError=%v) = %v, acked %v, %d calls; want %v, %v, %d",
+				tt.err, tt.onError, err, acked, calls, tt.wantErr, tt.wantAck, tt.wantCalls)
+		}
+	}
+}
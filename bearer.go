@@ -0,0 +1,81 @@
+// Copyright 2010 Gary Burd
+//
+// Licensed under the Apache License, Version 2.0 (the "License"): you may
+// not use this file except in compliance with the License. You may obtain
+// a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+// WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the
+// License for the specific language governing permissions and limitations
+// under the License.
+
+package twitterstream
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+// BearerTokenURL is the endpoint for exchanging application credentials for a
+// bearer token.
+const BearerTokenURL = "https://api.twitter.com/oauth2/token"
+
+// OpenBearer opens a new stream using application-only authentication. Use
+// BearerToken to get a bearer token for the application. Endpoints that
+// require a user context do not accept bearer tokens.
+func OpenBearer(ctx context.Context, bearerToken string, urlStr string, params url.Values, options ...OpenOption) (*Stream, error) {
+	return open(ctx, urlStr, params, newOpenOptions(options), bearerAuthorizer(bearerToken))
+}
+
+func bearerAuthorizer(bearerToken string) authorizer {
+	return func(method string, urlStr string, form url.Values, header http.Header) {
+		header.Set("Authorization", "Bearer "+bearerToken)
+	}
+}
+
+// BearerToken exchanges the application's consumer key and secret for a
+// bearer token. If client is nil, then http.DefaultClient is used.
+func BearerToken(ctx context.Context, client *http.Client, consumerKey, consumerSecret string) (string, error) {
+	if client == nil {
+		client = http.DefaultClient
+	}
+	req, err := http.NewRequestWithContext(ctx, "POST", BearerTokenURL, strings.NewReader("grant_type=client_credentials"))
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded;charset=UTF-8")
+	req.SetBasicAuth(url.QueryEscape(consumerKey), url.QueryEscape(consumerSecret))
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+	p, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return "", err
+	}
+	if resp.StatusCode != 200 {
+		return "", newHTTPStatusError(resp, p)
+	}
+
+	var v struct {
+		TokenType   string `json:"token_type"`
+		AccessToken string `json:"access_token"`
+	}
+	if err := json.Unmarshal(p, &v); err != nil {
+		return "", err
+	}
+	if v.TokenType != "bearer" || v.AccessToken == "" {
+		return "", errors.New("twitterstream: unexpected bearer token response")
+	}
+	return v.AccessToken, nil
+}
@@ -0,0 +1,130 @@
+// Copyright 2010 Gary Burd
+//
+// Licensed under the Apache License, Version 2.0 (the "License"): you may
+// not use this file except in compliance with the License. You may obtain
+// a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+// WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the
+// License for the specific language governing permissions and limitations
+// under the License.
+
+package twitterstream
+
+import (
+	"sync"
+	"sync/atomic"
+)
+
+// Broadcaster delivers the messages from one stream to multiple independent
+// subscribers. Each subscriber has a queue with its own depth and overflow
+// policy.
+//
+//  b := twitterstream.NewBroadcaster(ts.Messages(100))
+//  archive := b.Subscribe(10000, twitterstream.OverflowBlock)
+//  realtime := b.Subscribe(100, twitterstream.OverflowDropOldest)
+type Broadcaster struct {
+	mu     sync.Mutex
+	subs   map[*Subscription]struct{}
+	closed bool
+}
+
+// NewBroadcaster starts a goroutine that delivers the messages received from
+// messages to the subscribers. The subscribers' channels are closed after
+// messages is closed.
+func NewBroadcaster(messages <-chan Message) *Broadcaster {
+	b := &Broadcaster{subs: make(map[*Subscription]struct{})}
+	go func() {
+		for m := range messages {
+			// The subscribers share the buffer, so the buffer cannot be
+			// released to the pool.
+			m.line = nil
+			b.mu.Lock()
+			subs := make([]*Subscription, 0, len(b.subs))
+			for s := range b.subs {
+				subs = append(subs, s)
+			}
+			b.mu.Unlock()
+			for _, s := range subs {
+				s.q.put(m)
+			}
+		}
+		b.mu.Lock()
+		b.closed = true
+		for s := range b.subs {
+			s.q.close()
+		}
+		b.mu.Unlock()
+	}()
+	return b
+}
+
+// Subscription is a subscriber to a Broadcaster.
+type Subscription struct {
+	b    *Broadcaster
+	q    *messageQueue
+	c    chan Message
+	quit chan struct{}
+	once sync.Once
+}
+
+// Subscribe adds a subscriber with a queue of depth messages. The policy
+// specifies what happens when the subscriber falls behind and the queue is
+// full. A subscriber with the OverflowBlock policy blocks delivery to all
+// subscribers when the subscriber's queue is full.
+func (b *Broadcaster) Subscribe(depth int, policy OverflowPolicy) *Subscription {
+	s := &Subscription{
+		b:    b,
+		q:    newMessageQueue(depth, policy, 0),
+		c:    make(chan Message),
+		quit: make(chan struct{}),
+	}
+	b.mu.Lock()
+	if b.closed {
+		s.q.close()
+	} else {
+		b.subs[s] = struct{}{}
+	}
+	b.mu.Unlock()
+	go func() {
+		defer close(s.c)
+		for {
+			m, ok := s.q.get()
+			if !ok {
+				return
+			}
+			select {
+			case s.c <- m:
+			case <-s.quit:
+				return
+			}
+		}
+	}()
+	return s
+}
+
+// C returns the subscriber's channel.
+func (s *Subscription) C() <-chan Message {
+	return s.c
+}
+
+// Dropped returns the number of messages discarded by the subscriber's
+// overflow policy.
+func (s *Subscription) Dropped() int64 {
+	return atomic.LoadInt64(&s.q.dropped)
+}
+
+// Close removes the subscriber from the broadcaster and closes the
+// subscriber's channel.
+func (s *Subscription) Close() {
+	s.once.Do(func() {
+		s.b.mu.Lock()
+		delete(s.b.subs, s)
+		s.b.mu.Unlock()
+		close(s.quit)
+		s.q.abort()
+	})
+}
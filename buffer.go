@@ -0,0 +1,101 @@
+// Copyright 2010 Gary Burd
+//
+// Licensed under the Apache License, Version 2.0 (the "License"): you may
+// not use this file except in compliance with the License. You may obtain
+// a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+// WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the
+// License for the specific language governing permissions and limitations
+// under the License.
+
+package twitterstream
+
+import (
+	"sync"
+)
+
+// Line is a copy of a line read from the stream in a buffer from a pool.
+// Call Release to return the buffer to the pool when done with the line.
+//
+//  l, err := ts.NextPooled()
+//  if err != nil {
+//      ...
+//  }
+//  go func() {
+//      defer l.Release()
+//      process(l.Bytes)
+//  }()
+type Line struct {
+	// Bytes is the line without the line terminator.
+	Bytes []byte
+}
+
+// maxPooledLine is the capacity of the largest buffer returned to the pool.
+// Larger buffers are left to the garbage collector to avoid pinning memory
+// after an unusually large message.
+const maxPooledLine = 64 * 1024
+
+var linePool = sync.Pool{New: func() interface{} { return new(Line) }}
+
+// newLine returns a line from the pool with a copy of p.
+func newLine(p []byte) *Line {
+	l := linePool.Get().(*Line)
+	l.Bytes = append(l.Bytes[:0], p...)
+	return l
+}
+
+// Release returns the line's buffer to the pool. The application must not
+// use the line or the Bytes slice after calling Release.
+func (l *Line) Release() {
+	if cap(l.Bytes) > maxPooledLine {
+		return
+	}
+	l.Bytes = l.Bytes[:0]
+	linePool.Put(l)
+}
+
+// NextCopy returns a copy of the next line from the stream. Unlike the
+// slice returned by Next, the application owns the returned slice.
+func (ts *Stream) NextCopy() ([]byte, error) {
+	p, err := ts.Next()
+	if err != nil {
+		return nil, err
+	}
+	return append([]byte(nil), p...), nil
+}
+
+// NextPooled returns a copy of the next line from the stream in a buffer
+// from a pool. The application owns the line until the application calls
+// Release.
+func (ts *Stream) NextPooled() (*Line, error) {
+	p, err := ts.Next()
+	if err != nil {
+		return nil, err
+	}
+	return newLine(p), nil
+}
+
+// NextCopy returns a copy of the next line from the stream. Unlike the
+// slice returned by Next, the application owns the returned slice.
+func (rs *ReconnectingStream) NextCopy() ([]byte, error) {
+	p, err := rs.Next()
+	if err != nil {
+		return nil, err
+	}
+	return append([]byte(nil), p...), nil
+}
+
+// NextPooled returns a copy of the next line from the stream in a buffer
+// from a pool. The application owns the line until the application calls
+// Release.
+func (rs *ReconnectingStream) NextPooled() (*Line, error) {
+	p, err := rs.Next()
+	if err != nil {
+		return nil, err
+	}
+	return newLine(p), nil
+}
@@ -0,0 +1,175 @@
+// Copyright 2010 Gary Burd
+//
+// Licensed under the Apache License, Version 2.0 (the "License"): you may
+// not use this file except in compliance with the License. You may obtain
+// a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+// WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the
+// License for the specific language governing permissions and limitations
+// under the License.
+
+package twitterstream
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Checkpointer stores the ID of the newest tweet read from a stream. Use the
+// stored ID to resume or backfill the stream after a restart.
+//
+//  cp := &twitterstream.FileCheckpointer{Path: "stream.checkpoint"}
+//  sinceID, err := cp.Load()
+//  ...
+//  ts := twitterstream.NewReconnectingStream(client, cred, url, params,
+//      twitterstream.OpenCheckpointer(cp, 10*time.Second))
+type Checkpointer interface {
+	// Load returns the stored ID or zero if no ID is stored.
+	Load() (int64, error)
+
+	// Save stores the ID.
+	Save(id int64) error
+}
+
+// MemoryCheckpointer is a Checkpointer that stores the ID in memory.
+type MemoryCheckpointer struct {
+	mu sync.Mutex
+	id int64
+}
+
+// Load implements the Checkpointer interface.
+func (c *MemoryCheckpointer) Load() (int64, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.id, nil
+}
+
+// Save implements the Checkpointer interface.
+func (c *MemoryCheckpointer) Save(id int64) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.id = id
+	return nil
+}
+
+// FileCheckpointer is a Checkpointer that stores the ID in a file. The file is
+// replaced atomically on each save so that a crash does not corrupt the
+// stored ID.
+type FileCheckpointer struct {
+	// Path is the name of the file.
+	Path string
+}
+
+// Load implements the Checkpointer interface.
+func (c *FileCheckpointer) Load() (int64, error) {
+	p, err := ioutil.ReadFile(c.Path)
+	if os.IsNotExist(err) {
+		return 0, nil
+	} else if err != nil {
+		return 0, err
+	}
+	return strconv.ParseInt(strings.TrimSpace(string(p)), 10, 64)
+}
+
+// Save implements the Checkpointer interface.
+func (c *FileCheckpointer) Save(id int64) error {
+	return writeFileAtomic(c.Path, []byte(strconv.FormatInt(id, 10)+"\n"))
+}
+
+// writeFileAtomic replaces the named file with data. A crash during the write
+// leaves the original file or the new file.
+func writeFileAtomic(name string, data []byte) error {
+	f, err := ioutil.TempFile(filepath.Dir(name), filepath.Base(name)+".tmp")
+	if err != nil {
+		return err
+	}
+	_, err = f.Write(data)
+	if err == nil {
+		err = f.Sync()
+	}
+	if e := f.Close(); err == nil {
+		err = e
+	}
+	if err == nil {
+		err = os.Rename(f.Name(), name)
+	}
+	if err != nil {
+		os.Remove(f.Name())
+	}
+	return err
+}
+
+// checkpoint tracks the newest tweet ID for the OpenCheckpointer option. The
+// checkpoint is shared by the connections of a reconnecting stream.
+type checkpoint struct {
+	c        Checkpointer
+	interval time.Duration
+
+	mu      sync.Mutex
+	newest  int64
+	saved   int64
+	savedAt time.Time
+}
+
+// update records the tweet ID and saves the newest ID if the interval has
+// elapsed since the last save.
+func (cp *checkpoint) update(id int64) error {
+	cp.mu.Lock()
+	defer cp.mu.Unlock()
+	if id > cp.newest {
+		cp.newest = id
+	}
+	if time.Since(cp.savedAt) < cp.interval {
+		return nil
+	}
+	return cp.save()
+}
+
+// flush saves the newest ID if the ID is not already saved.
+func (cp *checkpoint) flush() error {
+	cp.mu.Lock()
+	defer cp.mu.Unlock()
+	return cp.save()
+}
+
+func (cp *checkpoint) save() error {
+	if cp.newest == cp.saved {
+		return nil
+	}
+	if err := cp.c.Save(cp.newest); err != nil {
+		return err
+	}
+	cp.saved = cp.newest
+	cp.savedAt = time.Now()
+	return nil
+}
+
+// tweetID returns the ID of the tweet in line p. The function returns false if
+// the line is not a v1.1 tweet or a v2 tweet.
+func tweetID(p []byte) (int64, bool) {
+	var v []byte
+	var ok bool
+	if data, isV2 := objectField(p, "data"); isV2 {
+		v, ok = objectField(data, "id")
+	} else {
+		v, ok = objectField(p, "id_str")
+	}
+	if !ok {
+		return 0, false
+	}
+	s, ok := rawString(v)
+	if !ok {
+		return 0, false
+	}
+	id, err := strconv.ParseInt(s, 10, 64)
+	return id, err == nil
+}
@@ -0,0 +1,71 @@
+// Copyright 2010 Gary Burd
+//
+// Licensed under the Apache License, Version 2.0 (the "License"): you may
+// not use this file except in compliance with the License. You may obtain
+// a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+// WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the
+// License for the specific language governing permissions and limitations
+// under the License.
+
+package twitterstream
+
+import (
+	"context"
+	"github.com/garyburd/go-oauth/oauth"
+	"net/url"
+	"time"
+)
+
+// Connector holds the credentials, unsigned parameters and options for
+// connecting to a streaming endpoint. Each call to Connect signs a new
+// request with a fresh nonce and timestamp. Params is never modified.
+//
+//  c := &twitterstream.Connector{
+//      OAuthClient: client,
+//      AccessToken: cred,
+//      URL:         twitterstream.FilterURL,
+//      Params:      twitterstream.FilterParams{Track: []string{"golang"}}.Values(),
+//  }
+//  ts := c.ReconnectingStream()
+type Connector struct {
+	// OAuthClient and AccessToken are the credentials for user
+	// authentication.
+	OAuthClient *oauth.Client
+	AccessToken *oauth.Credentials
+
+	// BearerToken is the credential for application-only authentication. If
+	// BearerToken is set, then OAuthClient and AccessToken are ignored.
+	BearerToken string
+
+	// URL is the endpoint URL.
+	URL string
+
+	// Params are the unsigned request parameters.
+	Params url.Values
+
+	// Options are the options for opening the stream.
+	Options []OpenOption
+}
+
+// Connect opens a new stream.
+func (c *Connector) Connect(ctx context.Context) (*Stream, error) {
+	if c.BearerToken != "" {
+		return OpenBearer(ctx, c.BearerToken, c.URL, c.Params, c.Options...)
+	}
+	return OpenContext(ctx, c.OAuthClient, c.AccessToken, c.URL, c.Params, c.Options...)
+}
+
+// ReconnectingStream returns a stream that uses the connector to connect and
+// reconnect to the endpoint.
+func (c *Connector) ReconnectingStream() *ReconnectingStream {
+	return newReconnectingStream(func(ctx context.Context, gap time.Duration, params url.Values) (*Stream, error) {
+		cc := *c
+		cc.Params = params
+		return cc.Connect(ctx)
+	}, c.Params, c.Options)
+}
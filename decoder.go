@@ -0,0 +1,60 @@
+// Copyright 2010 Gary Burd
+//
+// Licensed under the Apache License, Version 2.0 (the "License"): you may
+// not use this file except in compliance with the License. You may obtain
+// a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+// WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the
+// License for the specific language governing permissions and limitations
+// under the License.
+
+package twitterstream
+
+import (
+	"bytes"
+	"encoding/json"
+)
+
+// Decoder decodes JSON. Use the OpenDecoder option to replace encoding/json
+// with a faster package such as jsoniter, go-json or sonic:
+//
+//  var fast = jsoniter.ConfigCompatibleWithStandardLibrary
+//  ts, err := twitterstream.Open(client, cred, url, params,
+//      twitterstream.OpenDecoder(twitterstream.DecoderFunc(fast.Unmarshal)))
+type Decoder interface {
+	// Unmarshal decodes the JSON in p to v. The decoder must not retain p
+	// after returning.
+	Unmarshal(p []byte, v interface{}) error
+}
+
+// DecoderFunc is an adapter to allow the use of an ordinary function as a
+// Decoder.
+type DecoderFunc func(p []byte, v interface{}) error
+
+// Unmarshal calls f(p, v).
+func (f DecoderFunc) Unmarshal(p []byte, v interface{}) error {
+	return f(p, v)
+}
+
+// jsonDecoder is the default decoder. The decoder decodes a *Tweet with
+// decodeTweet, which does not use reflection and skips the cost of
+// validating the line before decoding. The stream delivers valid JSON.
+type jsonDecoder struct {
+	useNumber bool
+}
+
+func (d jsonDecoder) Unmarshal(p []byte, v interface{}) error {
+	if t, ok := v.(*Tweet); ok {
+		return decodeTweet(p, t)
+	}
+	if !d.useNumber {
+		return json.Unmarshal(p, v)
+	}
+	dec := json.NewDecoder(bytes.NewReader(p))
+	dec.UseNumber()
+	return dec.Decode(v)
+}
@@ -0,0 +1,156 @@
+// Copyright 2010 Gary Burd
+//
+// Licensed under the Apache License, Version 2.0 (the "License"): you may
+// not use this file except in compliance with the License. You may obtain
+// a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+// WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the
+// License for the specific language governing permissions and limitations
+// under the License.
+
+package twitterstream
+
+import (
+	"container/list"
+	"math"
+	"sync"
+	"time"
+)
+
+// Deduper detects tweets that were already delivered. Reconnects and backfill
+// can deliver a tweet more than once. Use the OpenDedupe option and the
+// Backfill Dedupe field to filter the repeats. Implementations must be safe
+// for concurrent use.
+type Deduper interface {
+	// Seen records the tweet ID and returns true if the ID was recorded
+	// before.
+	Seen(id int64) bool
+}
+
+// LRUDeduper is a Deduper that remembers the most recently seen tweet IDs.
+type LRUDeduper struct {
+	mu   sync.Mutex
+	size int
+	ids  map[int64]*list.Element
+	lru  list.List
+}
+
+// NewLRUDeduper returns a deduper that remembers the last size tweet IDs.
+func NewLRUDeduper(size int) *LRUDeduper {
+	return &LRUDeduper{size: size, ids: make(map[int64]*list.Element, size)}
+}
+
+// Seen implements the Deduper interface.
+func (d *LRUDeduper) Seen(id int64) bool {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if e, ok := d.ids[id]; ok {
+		d.lru.MoveToFront(e)
+		return true
+	}
+	d.ids[id] = d.lru.PushFront(id)
+	if d.lru.Len() > d.size {
+		e := d.lru.Back()
+		d.lru.Remove(e)
+		delete(d.ids, e.Value.(int64))
+	}
+	return false
+}
+
+// BloomDeduper is a Deduper for high volume streams. The deduper uses two
+// Bloom filters: the current filter and the filter for the previous
+// rotation interval. Seen checks both filters and records the ID in the
+// current filter. At the end of each interval, the current filter replaces
+// the previous filter. A BloomDeduper uses constant memory, but can report a
+// new ID as seen with the configured false positive rate.
+type BloomDeduper struct {
+	mu       sync.Mutex
+	m        uint64
+	k        int
+	interval time.Duration
+	rotated  time.Time
+	cur      []uint64
+	prev     []uint64
+}
+
+// Defaults for the NewBloomDeduper arguments.
+const (
+	defaultBloomFPRate   = 0.001
+	defaultBloomInterval = time.Hour
+)
+
+// NewBloomDeduper returns a deduper that remembers IDs for at least the
+// rotation interval. The n argument is the expected number of IDs in an
+// interval and fpRate is the false positive rate at n IDs. If fpRate is not
+// between 0 and 1 exclusive, then a rate of 0.001 is used. If interval is
+// not positive, then an interval of one hour is used.
+func NewBloomDeduper(n int, fpRate float64, interval time.Duration) *BloomDeduper {
+	if n < 1 {
+		n = 1
+	}
+	if !(fpRate > 0 && fpRate < 1) {
+		fpRate = defaultBloomFPRate
+	}
+	if interval <= 0 {
+		interval = defaultBloomInterval
+	}
+	m := uint64(math.Ceil(-float64(n) * math.Log(fpRate) / (math.Ln2 * math.Ln2)))
+	if m < 64 {
+		m = 64
+	}
+	k := int(math.Round(float64(m) / float64(n) * math.Ln2))
+	if k < 1 {
+		k = 1
+	}
+	words := (m + 63) / 64
+	return &BloomDeduper{
+		m:        words * 64,
+		k:        k,
+		interval: interval,
+		rotated:  time.Now(),
+		cur:      make([]uint64, words),
+		prev:     make([]uint64, words),
+	}
+}
+
+// mix64 is the splitmix64 finalizer.
+func mix64(x uint64) uint64 {
+	x ^= x >> 30
+	x *= 0xbf58476d1ce4e5b9
+	x ^= x >> 27
+	x *= 0x94d049bb133111eb
+	x ^= x >> 31
+	return x
+}
+
+// Seen implements the Deduper interface.
+func (d *BloomDeduper) Seen(id int64) bool {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if time.Since(d.rotated) >= d.interval {
+		d.prev, d.cur = d.cur, d.prev
+		for i := range d.cur {
+			d.cur[i] = 0
+		}
+		d.rotated = time.Now()
+	}
+	h1 := mix64(uint64(id))
+	h2 := mix64(h1) | 1
+	inCur, inPrev := true, true
+	for i := 0; i < d.k; i++ {
+		bit := (h1 + uint64(i)*h2) % d.m
+		word, mask := bit/64, uint64(1)<<(bit%64)
+		if d.cur[word]&mask == 0 {
+			inCur = false
+			d.cur[word] |= mask
+		}
+		if d.prev[word]&mask == 0 {
+			inPrev = false
+		}
+	}
+	return inCur || inPrev
+}
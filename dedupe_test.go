@@ -0,0 +1,79 @@
+// Copyright 2010 Gary Burd
+//
+// Licensed under the Apache License, Version 2.0 (the "License"): you may
+// not use this file except in compliance with the License. You may obtain
+// a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+// WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the
+// License for the specific language governing permissions and limitations
+// under the License.
+
+package twitterstream
+
+import (
+	"math"
+	"testing"
+	"time"
+)
+
+func TestBloomDeduper(t *testing.T) {
+	for _, tt := range []struct {
+		fpRate   float64
+		interval time.Duration
+	}{
+		{0.01, time.Hour},
+		{0, time.Hour},
+		{-1, time.Hour},
+		{1, time.Hour},
+		{2, time.Hour},
+		{math.NaN(), time.Hour},
+		{0.01, 0},
+		{0.01, -time.Second},
+	} {
+		d := NewBloomDeduper(1000, tt.fpRate, tt.interval)
+		for id := int64(1); id <= 100; id++ {
+			if d.Seen(id) {
+				t.Errorf("fpRate=%v interval=%v: new ID %d reported as seen", tt.fpRate, tt.interval, id)
+			}
+		}
+		for id := int64(1); id <= 100; id++ {
+			if !d.Seen(id) {
+				t.Errorf("fpRate=%v interval=%v: ID %d not reported as seen", tt.fpRate, tt.interval, id)
+			}
+		}
+	}
+}
+
+func TestBloomDeduperRotate(t *testing.T) {
+	d := NewBloomDeduper(1000, 0.001, time.Hour)
+	d.Seen(1)
+	// The ID is remembered for one rotation and forgotten after two.
+	d.rotated = d.rotated.Add(-time.Hour)
+	if !d.Seen(1) {
+		t.Fatal("ID not seen after one rotation")
+	}
+	d.rotated = d.rotated.Add(-time.Hour)
+	d.Seen(2)
+	d.rotated = d.rotated.Add(-time.Hour)
+	if d.Seen(1) {
+		t.Fatal("ID seen after two rotations")
+	}
+}
+
+func TestLRUDeduper(t *testing.T) {
+	d := NewLRUDeduper(2)
+	for _, tt := range []struct {
+		id   int64
+		seen bool
+	}{
+		{1, false}, {2, false}, {1, true}, {3, false}, {2, false}, {1, false},
+	} {
+		if seen := d.Seen(tt.id); seen != tt.seen {
+			t.Errorf("Seen(%d) = %v, want %v", tt.id, seen, tt.seen)
+		}
+	}
+}
@@ -0,0 +1,378 @@
+// Copyright 2010 Gary Burd
+//
+// Licensed under the Apache License, Version 2.0 (the "License"): you may
+// not use this file except in compliance with the License. You may obtain
+// a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+// WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the
+// License for the specific language governing permissions and limitations
+// under the License.
+
+package twitterstream
+
+import (
+	"encoding/json"
+	"strconv"
+)
+
+// Delete is a notice that a tweet was deleted. Applications that store tweets
+// should honor the notice by deleting the tweet from the store.
+type Delete struct {
+	// ID is the ID of the deleted tweet.
+	ID    int64  `json:"id"`
+	IDStr string `json:"id_str"`
+
+	// UserID is the ID of the user who posted the deleted tweet.
+	UserID    int64  `json:"user_id"`
+	UserIDStr string `json:"user_id_str"`
+
+	// TimestampMs is the time of the deletion.
+	TimestampMs UnixMillis `json:"-"`
+}
+
+// deleteNotice is the JSON representation of a delete notice.
+type deleteNotice struct {
+	Delete struct {
+		Status      Delete     `json:"status"`
+		TimestampMs UnixMillis `json:"timestamp_ms"`
+	} `json:"delete"`
+}
+
+// ParseDelete decodes a delete notice read from the stream.
+func ParseDelete(p []byte) (*Delete, error) {
+	var m deleteNotice
+	if err := json.Unmarshal(p, &m); err != nil {
+		return nil, err
+	}
+	d := m.Delete.Status
+	d.TimestampMs = m.Delete.TimestampMs
+	return &d, nil
+}
+
+// Limit is a notice that the stream matched more tweets than the stream is
+// allowed to deliver.
+type Limit struct {
+	// Track is the number of undelivered tweets since the connection was
+	// opened.
+	Track int64 `json:"track"`
+
+	// TimestampMs is the time of the notice.
+	TimestampMs UnixMillis `json:"timestamp_ms"`
+}
+
+// ParseLimit decodes a limit notice read from the stream.
+func ParseLimit(p []byte) (*Limit, error) {
+	var m struct {
+		Limit Limit `json:"limit"`
+	}
+	if err := json.Unmarshal(p, &m); err != nil {
+		return nil, err
+	}
+	return &m.Limit, nil
+}
+
+// ScrubGeo is a notice that the geolocation data should be removed from a
+// range of a user's tweets.
+type ScrubGeo struct {
+	UserID    int64  `json:"user_id"`
+	UserIDStr string `json:"user_id_str"`
+
+	// UpToStatusID is the ID of the most recent tweet to scrub. All earlier
+	// tweets by the user are also scrubbed.
+	UpToStatusID    int64  `json:"up_to_status_id"`
+	UpToStatusIDStr string `json:"up_to_status_id_str"`
+}
+
+// ParseScrubGeo decodes a scrub_geo notice read from the stream.
+func ParseScrubGeo(p []byte) (*ScrubGeo, error) {
+	var m struct {
+		ScrubGeo ScrubGeo `json:"scrub_geo"`
+	}
+	if err := json.Unmarshal(p, &m); err != nil {
+		return nil, err
+	}
+	return &m.ScrubGeo, nil
+}
+
+// Applies returns true if the notice applies to tweet t.
+func (sg *ScrubGeo) Applies(t *Tweet) bool {
+	return t.User != nil && t.User.ID == sg.UserID && t.ID <= sg.UpToStatusID
+}
+
+// Scrub removes the geolocation data from tweet t if the notice applies to
+// t. Scrub returns true if the notice applies.
+func (sg *ScrubGeo) Scrub(t *Tweet) bool {
+	if !sg.Applies(t) {
+		return false
+	}
+	t.Coordinates = nil
+	t.Place = nil
+	return true
+}
+
+// Disconnect is a notice sent by Twitter before closing the connection.
+type Disconnect struct {
+	Code       int    `json:"code"`
+	StreamName string `json:"stream_name"`
+	Reason     string `json:"reason"`
+}
+
+// Disconnect codes.
+const (
+	DisconnectShutdown        = 1  // Twitter closed the connection for shutdown.
+	DisconnectDuplicateStream = 2  // Another stream connected with the same credentials.
+	DisconnectControlRequest  = 3  // Control request for the stream.
+	DisconnectStall           = 4  // The application did not read the stream fast enough.
+	DisconnectNormal          = 5  // Normal disconnect.
+	DisconnectTokenRevoked    = 6  // The user revoked the access token.
+	DisconnectAdminLogout     = 7  // The user logged out.
+	DisconnectMaxMessageLimit = 9  // The stream reached the maximum message limit.
+	DisconnectStreamException = 10 // Internal error in the stream.
+	DisconnectBrokerStall     = 11 // Internal stall in the stream.
+	DisconnectShedLoad        = 12 // Twitter closed the connection to shed load.
+)
+
+// ParseDisconnect decodes a disconnect notice read from the stream.
+func ParseDisconnect(p []byte) (*Disconnect, error) {
+	var m struct {
+		Disconnect Disconnect `json:"disconnect"`
+	}
+	if err := json.Unmarshal(p, &m); err != nil {
+		return nil, err
+	}
+	return &m.Disconnect, nil
+}
+
+// DisconnectError is the permanent error for a stream closed by Twitter after
+// sending a disconnect notice.
+type DisconnectError struct {
+	Disconnect
+}
+
+func (err DisconnectError) Error() string {
+	return "twitterstream: disconnect code=" + strconv.Itoa(err.Code) + " " + err.Reason
+}
+
+// Warning is a notice that the connection is at risk of being closed. Request
+// stall warnings with the OpenStallWarnings option.
+type Warning struct {
+	// Code is "FALLING_BEHIND" when the application is not reading the
+	// stream fast enough or "FOLLOWS_OVER_LIMIT" when a user stream follows
+	// more users than the stream can deliver.
+	Code    string `json:"code"`
+	Message string `json:"message"`
+
+	// PercentFull is how full the queue of messages waiting to be sent to
+	// the application is. Twitter disconnects the stream when the queue is
+	// full. Set for FALLING_BEHIND warnings.
+	PercentFull int `json:"percent_full,omitempty"`
+
+	// UserID is the user stream's user. Set for FOLLOWS_OVER_LIMIT warnings.
+	UserID int64 `json:"user_id,omitempty"`
+}
+
+// StatusWithheld is a notice that a tweet is withheld in some countries.
+type StatusWithheld struct {
+	ID                  int64      `json:"id"`
+	UserID              int64      `json:"user_id"`
+	WithheldInCountries []string   `json:"withheld_in_countries"`
+	TimestampMs         UnixMillis `json:"timestamp_ms"`
+}
+
+// ParseStatusWithheld decodes a status_withheld notice read from the stream.
+func ParseStatusWithheld(p []byte) (*StatusWithheld, error) {
+	var m struct {
+		StatusWithheld StatusWithheld `json:"status_withheld"`
+	}
+	if err := json.Unmarshal(p, &m); err != nil {
+		return nil, err
+	}
+	return &m.StatusWithheld, nil
+}
+
+// UserWithheld is a notice that a user's tweets are withheld in some
+// countries.
+type UserWithheld struct {
+	ID                  int64      `json:"id"`
+	WithheldInCountries []string   `json:"withheld_in_countries"`
+	TimestampMs         UnixMillis `json:"timestamp_ms"`
+}
+
+// ParseUserWithheld decodes a user_withheld notice read from the stream.
+func ParseUserWithheld(p []byte) (*UserWithheld, error) {
+	var m struct {
+		UserWithheld UserWithheld `json:"user_withheld"`
+	}
+	if err := json.Unmarshal(p, &m); err != nil {
+		return nil, err
+	}
+	return &m.UserWithheld, nil
+}
+
+// FriendsList is the list of the user's friends sent at the start of a user
+// stream.
+type FriendsList struct {
+	IDs []int64
+}
+
+// ParseFriendsList decodes a friends list read from a user stream. The list
+// is encoded as numbers or, when the stringify_friend_ids parameter is set, as
+// strings.
+func ParseFriendsList(p []byte) (*FriendsList, error) {
+	var m struct {
+		Friends    []int64  `json:"friends"`
+		FriendsStr []string `json:"friends_str"`
+	}
+	if err := json.Unmarshal(p, &m); err != nil {
+		return nil, err
+	}
+	fl := &FriendsList{IDs: m.Friends}
+	if m.FriendsStr != nil {
+		fl.IDs = make([]int64, len(m.FriendsStr))
+		for i, s := range m.FriendsStr {
+			id, err := strconv.ParseInt(s, 10, 64)
+			if err != nil {
+				return nil, err
+			}
+			fl.IDs[i] = id
+		}
+	}
+	return fl, nil
+}
+
+// Demux dispatches messages to handlers by message type. Messages with no
+// corresponding handler are ignored.
+//
+//  d := twitterstream.Demux{
+//      OnTweet: func(t *twitterstream.Tweet) { ... },
+//      OnDelete: func(d *twitterstream.Delete) { ... },
+//  }
+//  for {
+//      p, err := ts.Next()
+//      if err != nil {
+//          break
+//      }
+//      if err := d.Handle(p); err != nil {
+//          log.Println("error decoding message: ", err)
+//      }
+//  }
+type Demux struct {
+	OnTweet      func(*Tweet)
+	OnDelete     func(*Delete)
+	OnLimit      func(*Limit)
+	OnScrubGeo   func(*ScrubGeo)
+	OnDisconnect func(*Disconnect)
+	OnWarning    func(*Warning)
+
+	OnStatusWithheld func(*StatusWithheld)
+	OnUserWithheld   func(*UserWithheld)
+
+	// OnFriends is called with the friends list at the start of a user
+	// stream.
+	OnFriends func(*FriendsList)
+
+	// OnResponseV2 is called with the messages from v2 streams that contain
+	// a tweet.
+	OnResponseV2 func(*ResponseV2)
+
+	// OnOther is called with the raw line for messages of any other type.
+	OnOther func([]byte)
+}
+
+// Handle decodes a line read from the stream and calls the handler for the
+// message type. The message type is determined by KindOf.
+func (d *Demux) Handle(p []byte) error {
+	switch KindOf(p) {
+	case KindDelete:
+		if d.OnDelete != nil {
+			v, err := ParseDelete(p)
+			if err != nil {
+				return err
+			}
+			d.OnDelete(v)
+		}
+	case KindLimit:
+		if d.OnLimit != nil {
+			v, err := ParseLimit(p)
+			if err != nil {
+				return err
+			}
+			d.OnLimit(v)
+		}
+	case KindScrubGeo:
+		if d.OnScrubGeo != nil {
+			v, err := ParseScrubGeo(p)
+			if err != nil {
+				return err
+			}
+			d.OnScrubGeo(v)
+		}
+	case KindDisconnect:
+		if d.OnDisconnect != nil {
+			v, err := ParseDisconnect(p)
+			if err != nil {
+				return err
+			}
+			d.OnDisconnect(v)
+		}
+	case KindFriends:
+		if d.OnFriends != nil {
+			v, err := ParseFriendsList(p)
+			if err != nil {
+				return err
+			}
+			d.OnFriends(v)
+		}
+	case KindWarning:
+		if d.OnWarning != nil {
+			var m struct {
+				Warning Warning `json:"warning"`
+			}
+			if err := json.Unmarshal(p, &m); err != nil {
+				return err
+			}
+			d.OnWarning(&m.Warning)
+		}
+	case KindStatusWithheld:
+		if d.OnStatusWithheld != nil {
+			v, err := ParseStatusWithheld(p)
+			if err != nil {
+				return err
+			}
+			d.OnStatusWithheld(v)
+		}
+	case KindUserWithheld:
+		if d.OnUserWithheld != nil {
+			v, err := ParseUserWithheld(p)
+			if err != nil {
+				return err
+			}
+			d.OnUserWithheld(v)
+		}
+	case KindTweet:
+		if _, isV2 := objectField(p, "data"); isV2 {
+			if d.OnResponseV2 != nil {
+				var v ResponseV2
+				if err := json.Unmarshal(p, &v); err != nil {
+					return err
+				}
+				d.OnResponseV2(&v)
+			}
+		} else if d.OnTweet != nil {
+			var v Tweet
+			if err := decodeTweet(p, &v); err != nil {
+				return err
+			}
+			d.OnTweet(&v)
+		}
+	default:
+		if d.OnOther != nil {
+			d.OnOther(p)
+		}
+	}
+	return nil
+}
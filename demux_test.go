@@ -0,0 +1,74 @@
+// Copyright 2010 Gary Burd
+//
+// Licensed under the Apache License, Version 2.0 (the "License"): you may
+// not use this file except in compliance with the License. You may obtain
+// a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+// WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the
+// License for the specific language governing permissions and limitations
+// under the License.
+
+package twitterstream
+
+import (
+	"testing"
+)
+
+func TestDemuxHandle(t *testing.T) {
+	var got string
+	d := Demux{
+		OnTweet:          func(v *Tweet) { got = "tweet " + v.IDStr },
+		OnDelete:         func(v *Delete) { got = "delete " + v.IDStr },
+		OnLimit:          func(v *Limit) { got = "limit" },
+		OnScrubGeo:       func(v *ScrubGeo) { got = "scrub_geo " + v.UserIDStr },
+		OnDisconnect:     func(v *Disconnect) { got = "disconnect " + v.Reason },
+		OnWarning:        func(v *Warning) { got = "warning " + v.Code },
+		OnStatusWithheld: func(v *StatusWithheld) { got = "status_withheld" },
+		OnUserWithheld:   func(v *UserWithheld) { got = "user_withheld" },
+		OnFriends:        func(v *FriendsList) { got = "friends" },
+		OnResponseV2:     func(v *ResponseV2) { got = "v2 " + v.Data.ID },
+		OnOther:          func(p []byte) { got = "other" },
+	}
+	for _, tt := range []struct {
+		p    string
+		want string
+	}{
+		{`{"id_str":"1","user":{"id_str":"2"},"text":"hello"}`, "tweet 1"},
+		{`{"data":{"id":"3","text":"hello"},"matching_rules":[{"id":"1","tag":"x"}]}`, "v2 3"},
+		{`{"delete":{"status":{"id":4,"id_str":"4","user_id":5,"user_id_str":"5"},"timestamp_ms":"1539202764000"}}`, "delete 4"},
+		{`{"limit":{"track":10,"timestamp_ms":"1539202764000"}}`, "limit"},
+		{`{"scrub_geo":{"user_id":1,"user_id_str":"1","up_to_status_id":2,"up_to_status_id_str":"2"}}`, "scrub_geo 1"},
+		{`{"disconnect":{"code":4,"stream_name":"x","reason":"stall"}}`, "disconnect stall"},
+		{`{"warning":{"code":"FALLING_BEHIND","message":"x","percent_full":60}}`, "warning FALLING_BEHIND"},
+		{`{"status_withheld":{"id":1,"user_id":2,"withheld_in_countries":["DE"]}}`, "status_withheld"},
+		{`{"user_withheld":{"id":1,"withheld_in_countries":["DE"]}}`, "user_withheld"},
+		{`{"friends":[1,2]}`, "friends"},
+		{`{"friends_str":["1","2"]}`, "friends"},
+		{`{"event":"follow"}`, "other"},
+		{`{"errors":[{"title":"operational-disconnect"}]}`, "other"},
+	} {
+		got = ""
+		if err := d.Handle([]byte(tt.p)); err != nil {
+			t.Errorf("Handle(%s) returned error %v", tt.p, err)
+		}
+		if got != tt.want {
+			t.Errorf("Handle(%s) called %q, want %q", tt.p, got, tt.want)
+		}
+	}
+}
+
+func TestDemuxHandleError(t *testing.T) {
+	d := Demux{OnTweet: func(*Tweet) {}, OnLimit: func(*Limit) {}}
+	for _, p := range []string{
+		`{"id_str":"1","user":{"id_str":"2"},"id":"x"}`,
+		`{"limit":{"track":"x"}}`,
+	} {
+		if err := d.Handle([]byte(p)); err == nil {
+			t.Errorf("Handle(%s) returned nil error", p)
+		}
+	}
+}
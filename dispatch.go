@@ -0,0 +1,97 @@
+// Copyright 2010 Gary Burd
+//
+// Licensed under the Apache License, Version 2.0 (the "License"): you may
+// not use this file except in compliance with the License. You may obtain
+// a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+// WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the
+// License for the specific language governing permissions and limitations
+// under the License.
+
+package twitterstream
+
+import (
+	"sync"
+)
+
+// DispatchOption specifies an option for Dispatch.
+type DispatchOption struct {
+	f func(*dispatchOptions)
+}
+
+type dispatchOptions struct {
+	key func(Message) string
+}
+
+// DispatchByUser partitions the messages by the ID of the user who created
+// the tweet. All tweets from a user are handled by the same worker in the
+// order received. Messages that are not tweets are handled by any worker.
+func DispatchByUser() DispatchOption {
+	return DispatchOption{func(do *dispatchOptions) {
+		do.key = UserKey
+	}}
+}
+
+// UserKey returns the ID of the user who created the v1.1 or v2 tweet in m.
+// UserKey returns "" if the message is not a tweet.
+func UserKey(m Message) string {
+	t := tweetObject(m.Raw)
+	v, ok := lookupPath(t, userIDPath)
+	if !ok {
+		v, ok = lookupPath(t, authorIDPath)
+	}
+	if !ok {
+		return ""
+	}
+	s, _ := rawString(v)
+	return s
+}
+
+var (
+	userIDPath   = []string{"user", "id_str"}
+	authorIDPath = []string{"author_id"}
+)
+
+// Dispatch calls handler with each message received from messages using
+// the given number of worker goroutines. Dispatch returns after messages is
+// closed and the workers have handled all of the messages.
+//
+//  twitterstream.Dispatch(ts.Messages(100), process, 8, twitterstream.DispatchByUser())
+func Dispatch(messages <-chan Message, handler func(Message), workers int, options ...DispatchOption) {
+	var do dispatchOptions
+	for _, option := range options {
+		option.f(&do)
+	}
+	if workers < 1 {
+		workers = 1
+	}
+
+	var wg sync.WaitGroup
+	wg.Add(workers)
+	if do.key == nil {
+		for i := 0; i < workers; i++ {
+			go func() {
+				defer wg.Done()
+				for m := range messages {
+					handler(m)
+				}
+			}()
+		}
+		wg.Wait()
+		return
+	}
+
+	for _, c := range Shard(messages, workers, do.key) {
+		go func(c <-chan Message) {
+			defer wg.Done()
+			for m := range c {
+				handler(m)
+			}
+		}(c)
+	}
+	wg.Wait()
+}
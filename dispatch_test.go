@@ -0,0 +1,48 @@
+// Copyright 2010 Gary Burd
+//
+// Licensed under the Apache License, Version 2.0 (the "License"): you may
+// not use this file except in compliance with the License. You may obtain
+// a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+// WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the
+// License for the specific language governing permissions and limitations
+// under the License.
+
+package twitterstream
+
+import (
+	"testing"
+)
+
+var userKeyTests = []struct {
+	raw  string
+	want string
+}{
+	{`{"id_str":"1","user":{"id":2,"id_str":"2"},"text":"hello"}`, "2"},
+	{`{"user":{"id_str":"23"}}`, "23"},
+	{`{"data":{"id":"1","author_id":"3","text":"hello"},"includes":{}}`, "3"},
+	{`{"delete":{"status":{"id_str":"1","user_id_str":"2"}}}`, ""},
+	{`{"user":{"id":2}}`, ""},
+	{`{"user":null}`, ""},
+	{`not json`, ""},
+}
+
+func TestUserKey(t *testing.T) {
+	for _, tt := range userKeyTests {
+		if got := UserKey(Message{Raw: []byte(tt.raw)}); got != tt.want {
+			t.Errorf("UserKey(%s) = %q, want %q", tt.raw, got, tt.want)
+		}
+	}
+}
+
+func BenchmarkUserKey(b *testing.B) {
+	m := Message{Raw: []byte(benchmarkLine)}
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		UserKey(m)
+	}
+}
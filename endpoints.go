@@ -0,0 +1,100 @@
+// Copyright 2010 Gary Burd
+//
+// Licensed under the Apache License, Version 2.0 (the "License"): you may
+// not use this file except in compliance with the License. You may obtain
+// a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+// WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the
+// License for the specific language governing permissions and limitations
+// under the License.
+
+package twitterstream
+
+import (
+	"context"
+	"github.com/garyburd/go-oauth/oauth"
+	"net/url"
+)
+
+// Twitter streaming API v1.1 endpoints.
+const (
+	SampleURL     = "https://stream.twitter.com/1.1/statuses/sample.json"
+	FilterURL     = "https://stream.twitter.com/1.1/statuses/filter.json"
+	FirehoseURL   = "https://stream.twitter.com/1.1/statuses/firehose.json"
+	UserStreamURL = "https://userstream.twitter.com/1.1/user.json"
+)
+
+// withMethod returns options for an endpoint that uses the given method
+// followed by the application's options.
+func withMethod(method string, options []OpenOption) []OpenOption {
+	return append([]OpenOption{OpenMethod(method)}, options...)
+}
+
+// OpenSample opens the statuses/sample endpoint. The stream delivers a random
+// sample of all public tweets.
+func OpenSample(ctx context.Context, oauthClient *oauth.Client, accessToken *oauth.Credentials, params url.Values, options ...OpenOption) (*Stream, error) {
+	return OpenContext(ctx, oauthClient, accessToken, SampleURL, params, withMethod("GET", options)...)
+}
+
+// OpenFilter opens the statuses/filter endpoint. The stream delivers public
+// tweets matching the filter. Use FilterParams to create the parameters.
+func OpenFilter(ctx context.Context, oauthClient *oauth.Client, accessToken *oauth.Credentials, params url.Values, options ...OpenOption) (*Stream, error) {
+	return OpenContext(ctx, oauthClient, accessToken, FilterURL, params, withMethod("POST", options)...)
+}
+
+// OpenFirehose opens the statuses/firehose endpoint. The stream delivers all
+// public tweets. The endpoint requires special permission from Twitter.
+func OpenFirehose(ctx context.Context, oauthClient *oauth.Client, accessToken *oauth.Credentials, params url.Values, options ...OpenOption) (*Stream, error) {
+	return OpenContext(ctx, oauthClient, accessToken, FirehoseURL, params, withMethod("GET", options)...)
+}
+
+// OpenUserStream opens the user stream for the user authorized by the access
+// token. The stream delivers the data and events for the user. Use
+// UserStreamParams to create the parameters.
+//
+// The first message in the stream is the list of the user's friends. Use
+// Stream.Friends to get the list after the first call to Next.
+func OpenUserStream(ctx context.Context, oauthClient *oauth.Client, accessToken *oauth.Credentials, params url.Values, options ...OpenOption) (*Stream, error) {
+	return OpenContext(ctx, oauthClient, accessToken, UserStreamURL, params, withMethod("GET", options)...)
+}
+
+// UserStreamParams specifies the parameters for the user stream endpoint.
+type UserStreamParams struct {
+	// With is "user" to receive only the user's own messages or
+	// "followings" to also receive messages from the accounts the user
+	// follows. The default is "followings".
+	With string
+
+	// AllReplies specifies whether the stream includes all replies by
+	// followed accounts instead of only replies to accounts the user also
+	// follows.
+	AllReplies bool
+
+	// Track and Locations add public tweets matching the filter to the
+	// stream.
+	Track     []string
+	Locations []BoundingBox
+
+	// StringifyFriendIDs specifies whether the friends list is sent as
+	// strings.
+	StringifyFriendIDs bool
+}
+
+// Values returns the parameters encoded for use with OpenUserStream.
+func (up UserStreamParams) Values() url.Values {
+	params := FilterParams{Track: up.Track, Locations: up.Locations}.Values()
+	if up.With != "" {
+		params.Set("with", up.With)
+	}
+	if up.AllReplies {
+		params.Set("replies", "all")
+	}
+	if up.StringifyFriendIDs {
+		params.Set("stringify_friend_ids", "true")
+	}
+	return params
+}
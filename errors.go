@@ -0,0 +1,147 @@
+// Copyright 2010 Gary Burd
+//
+// Licensed under the Apache License, Version 2.0 (the "License"): you may
+// not use this file except in compliance with the License. You may obtain
+// a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+// WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the
+// License for the specific language governing permissions and limitations
+// under the License.
+
+package twitterstream
+
+import (
+	"bufio"
+	"context"
+	"errors"
+)
+
+var (
+	// ErrStreamClosed is the error for operations on a stream closed by the
+	// application.
+	ErrStreamClosed = errors.New("twitterstream: stream closed")
+
+	// ErrStalled is the error for a stream closed because no data arrived
+	// within the read timeout.
+	ErrStalled = errors.New("twitterstream: no data received before read timeout, stream stalled")
+
+	// ErrRateLimited matches HTTP 420 and 429 errors with errors.Is.
+	ErrRateLimited = errors.New("twitterstream: rate limited")
+
+	// ErrUnauthorized matches HTTP 401 errors and disconnects for revoked
+	// authorization with errors.Is.
+	ErrUnauthorized = errors.New("twitterstream: unauthorized")
+
+	// ErrMessageTooLarge is the error for a line longer than the maximum
+	// message size. The line is discarded and the stream remains usable.
+	ErrMessageTooLarge = errors.New("twitterstream: message too large")
+)
+
+// IsTemporary returns true if opening a new connection after err is expected
+// to succeed. Network errors, stalls, rate limiting and server errors are
+// temporary. Authentication failures, rejected requests, disconnects for
+// duplicate streams or revoked authorization, and cancellation by the
+// application are not temporary.
+//
+// The decision is made from this package's errors only. All errors from the
+// net and net/url packages are temporary, including refused connections and
+// failed DNS lookups, because those errors are commonly caused by brief
+// network outages.
+func IsTemporary(err error) bool {
+	switch {
+	case err == nil:
+		return false
+	case errors.Is(err, context.Canceled),
+		errors.Is(err, context.DeadlineExceeded),
+		errors.Is(err, ErrStreamClosed),
+		errors.Is(err, errPinnedKeys),
+		errors.Is(err, bufio.ErrBufferFull):
+		return false
+	}
+	var herr HTTPStatusError
+	if errors.As(err, &herr) {
+		return herr.Temporary()
+	}
+	var derr DisconnectError
+	if errors.As(err, &derr) {
+		return derr.Temporary()
+	}
+	var perr *ParamError
+	var rerr *RulesError
+	var terr TeeError
+	if errors.As(err, &perr) || errors.As(err, &rerr) || errors.As(err, &terr) {
+		return false
+	}
+	// Assume that other errors are from the network.
+	return true
+}
+
+// Is returns true if target is ErrRateLimited and the status code is 420 or
+// 429 or if target is ErrUnauthorized and the status code is 401.
+func (err HTTPStatusError) Is(target error) bool {
+	switch target {
+	case ErrRateLimited:
+		return err.StatusCode == 420 || err.StatusCode == 429
+	case ErrUnauthorized:
+		return err.StatusCode == 401
+	}
+	return false
+}
+
+// Is returns true if target is ErrUnauthorized and the stream was closed
+// because the user revoked the authorization or logged out.
+func (err DisconnectError) Is(target error) bool {
+	return target == ErrUnauthorized &&
+		(err.Code == DisconnectTokenRevoked || err.Code == DisconnectAdminLogout)
+}
+
+// Temporary returns false if the status code indicates that the request is
+// not authorized, the endpoint does not exist or the request is not
+// acceptable to the endpoint. Other errors, including rate limits and server
+// errors, are temporary.
+func (err HTTPStatusError) Temporary() bool {
+	switch err.StatusCode {
+	case 401, 403, 404, 406, 413, 416:
+		return false
+	}
+	return true
+}
+
+// Temporary returns false if Twitter closed the connection because of a
+// duplicate stream or a revoked authorization.
+func (err DisconnectError) Temporary() bool {
+	switch err.Code {
+	case DisconnectDuplicateStream, DisconnectTokenRevoked, DisconnectAdminLogout:
+		return false
+	}
+	return true
+}
+
+// Temporary returns false. Rejected rules must be corrected before retrying.
+func (err *RulesError) Temporary() bool {
+	return false
+}
+
+// TeeError is the permanent error for a stream closed because of an error
+// writing to the writer specified with the OpenTee option.
+type TeeError struct {
+	Err error
+}
+
+func (err TeeError) Error() string {
+	return "twitterstream: tee: " + err.Err.Error()
+}
+
+// Unwrap returns the error from the writer.
+func (err TeeError) Unwrap() error {
+	return err.Err
+}
+
+// Temporary returns false. Reconnecting does not fix the writer.
+func (err TeeError) Temporary() bool {
+	return false
+}
@@ -0,0 +1,82 @@
+// Copyright 2010 Gary Burd
+//
+// Licensed under the Apache License, Version 2.0 (the "License"): you may
+// not use this file except in compliance with the License. You may obtain
+// a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+// WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the
+// License for the specific language governing permissions and limitations
+// under the License.
+
+package twitterstream
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"syscall"
+	"testing"
+)
+
+func TestIsTemporary(t *testing.T) {
+	tests := []struct {
+		err  error
+		want bool
+	}{
+		{nil, false},
+		{context.Canceled, false},
+		{fmt.Errorf("wrapped: %w", context.DeadlineExceeded), false},
+		{ErrStreamClosed, false},
+		{ErrStalled, true},
+		{errors.New("unexpected EOF"), true},
+		{&net.OpError{Op: "dial", Net: "tcp", Err: syscall.ECONNREFUSED}, true},
+		{&net.OpError{Op: "dial", Net: "tcp", Err: syscall.ENETUNREACH}, true},
+		{&url.Error{Op: "Get", URL: "https://example.invalid", Err: &net.DNSError{Err: "no such host", Name: "example.invalid", IsNotFound: true}}, true},
+		{HTTPStatusError{StatusCode: 401}, false},
+		{HTTPStatusError{StatusCode: 403}, false},
+		{HTTPStatusError{StatusCode: 404}, false},
+		{HTTPStatusError{StatusCode: 406}, false},
+		{HTTPStatusError{StatusCode: 413}, false},
+		{HTTPStatusError{StatusCode: 416}, false},
+		{HTTPStatusError{StatusCode: 420}, true},
+		{HTTPStatusError{StatusCode: 429}, true},
+		{HTTPStatusError{StatusCode: 503}, true},
+		{fmt.Errorf("wrapped: %w", HTTPStatusError{StatusCode: 401}), false},
+		{DisconnectError{Disconnect{Code: DisconnectDuplicateStream}}, false},
+		{DisconnectError{Disconnect{Code: DisconnectTokenRevoked}}, false},
+		{DisconnectError{Disconnect{Code: DisconnectAdminLogout}}, false},
+		{DisconnectError{Disconnect{Code: DisconnectStall}}, true},
+		{&ParamError{Param: "track"}, false},
+		{&RulesError{}, false},
+		{TeeError{errors.New("disk full")}, false},
+	}
+	for _, tt := range tests {
+		if got := IsTemporary(tt.err); got != tt.want {
+			t.Errorf("IsTemporary(%#v) = %v, want %v", tt.err, got, tt.want)
+		}
+	}
+}
+
+func TestIsTemporaryConnectionRefused(t *testing.T) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	addr := l.Addr().String()
+	l.Close()
+	resp, err := http.Get("http://" + addr + "/")
+	if err == nil {
+		resp.Body.Close()
+		t.Skip("connection to closed listener succeeded")
+	}
+	if !IsTemporary(err) {
+		t.Errorf("IsTemporary(%v) = false, want true", err)
+	}
+}
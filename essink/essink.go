@@ -0,0 +1,381 @@
+// Copyright 2010 Gary Burd
+//
+// Licensed under the Apache License, Version 2.0 (the "License"): you may
+// not use this file except in compliance with the License. You may obtain
+// a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+// WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the
+// License for the specific language governing permissions and limitations
+// under the License.
+
+// Package essink indexes the tweets read from a twitterstream stream in
+// Elasticsearch or OpenSearch using the bulk API.
+//
+//  s := &essink.Sink{URL: "http://localhost:9200", Index: "tweets", DateLayout: "2006.01.02"}
+//  if err := s.PutTemplate(ctx); err != nil {
+//      log.Fatal(err)
+//  }
+//  err := s.Run(ctx, ts.Messages(1000))
+//
+// The document ID is the tweet ID, so a tweet indexed twice is stored once.
+// The document is the message read from the stream: a v1.1 tweet or a v2
+// response with the tweet in the data field. Messages other than tweets are
+// ignored.
+//
+// The sink retries bulk requests and documents rejected with HTTP status
+// 429 because the cluster is overloaded.
+package essink
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"github.com/garyburd/twitterstream"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Sink indexes tweets in Elasticsearch. The fields must not be changed
+// after the first message is indexed.
+type Sink struct {
+	// URL is the base URL of the cluster.
+	URL string
+
+	// HTTPClient is the client used for requests. If nil, then
+	// http.DefaultClient is used.
+	HTTPClient *http.Client
+
+	// Header is added to each request. Use Header to set the Authorization
+	// header.
+	Header http.Header
+
+	// Index is the name of the index or, if DateLayout is set, the prefix
+	// of the index names. If empty, then "tweets" is used.
+	Index string
+
+	// DateLayout is the layout for formatting the time the tweet was
+	// created in the index name. If set, then the tweet is indexed in
+	// Index + "-" + date, for example "tweets-2021.03.04" for the layout
+	// "2006.01.02". The date is in UTC.
+	DateLayout string
+
+	// BatchSize is the maximum number of documents in one bulk request. If
+	// zero, then 500 is used.
+	BatchSize int
+
+	// Retries is the number of times a request or document rejected with
+	// HTTP status 429 is retried. If zero, then five retries are made. Use a
+	// negative value to disable retries.
+	Retries int
+
+	// OnError is called with each message that could not be indexed. See
+	// twitterstream.Settle.
+	OnError func(m twitterstream.Message, err error)
+}
+
+// ItemError is the error for a document rejected by the bulk API.
+type ItemError struct {
+	Status int
+	Type   string
+	Reason string
+}
+
+func (err *ItemError) Error() string {
+	return "essink: status " + strconv.Itoa(err.Status) + ": " + err.Type + ": " + err.Reason
+}
+
+// StatusError is the error for a failed bulk request.
+type StatusError struct {
+	StatusCode int
+	Message    string
+}
+
+func (err *StatusError) Error() string {
+	return "essink: HTTP status " + strconv.Itoa(err.StatusCode) + ": " + err.Message
+}
+
+func (s *Sink) index() string {
+	if s.Index == "" {
+		return "tweets"
+	}
+	return s.Index
+}
+
+// do sends a request and returns the response body for a 2xx response.
+func (s *Sink) do(ctx context.Context, method, path, contentType string, body []byte) ([]byte, error) {
+	client := s.HTTPClient
+	if client == nil {
+		client = http.DefaultClient
+	}
+	req, err := http.NewRequestWithContext(ctx, method, strings.TrimSuffix(s.URL, "/")+path, bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	for k, v := range s.Header {
+		req.Header[k] = v
+	}
+	req.Header.Set("Content-Type", contentType)
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode/100 != 2 {
+		p, _ := ioutil.ReadAll(io.LimitReader(resp.Body, 4096))
+		return nil, &StatusError{StatusCode: resp.StatusCode, Message: string(p)}
+	}
+	return ioutil.ReadAll(resp.Body)
+}
+
+// PutTemplate creates or replaces an index template named Index with
+// mappings for the fields of v1.1 tweets and v2 responses. The template
+// applies to the index or indexes written by the sink. Other fields are
+// mapped dynamically.
+func (s *Sink) PutTemplate(ctx context.Context) error {
+	pattern := s.index()
+	if s.DateLayout != "" {
+		pattern += "-*"
+	}
+	keyword := map[string]string{"type": "keyword"}
+	text := map[string]string{"type": "text"}
+	twitterDate := map[string]string{"type": "date", "format": "EEE MMM dd HH:mm:ss Z yyyy||strict_date_optional_time"}
+	date := map[string]string{"type": "date"}
+	template := map[string]interface{}{
+		"index_patterns": []string{pattern},
+		"template": map[string]interface{}{
+			"mappings": map[string]interface{}{
+				"properties": map[string]interface{}{
+					"id_str":                    keyword,
+					"text":                      text,
+					"full_text":                 text,
+					"lang":                      keyword,
+					"created_at":                twitterDate,
+					"timestamp_ms":              map[string]string{"type": "date", "format": "epoch_millis"},
+					"in_reply_to_status_id_str": keyword,
+					"in_reply_to_user_id_str":   keyword,
+					"extended_tweet": map[string]interface{}{
+						"properties": map[string]interface{}{"full_text": text},
+					},
+					"user": map[string]interface{}{
+						"properties": map[string]interface{}{
+							"id_str":      keyword,
+							"screen_name": keyword,
+							"name":        text,
+							"created_at":  twitterDate,
+						},
+					},
+					"entities": map[string]interface{}{
+						"properties": map[string]interface{}{
+							"hashtags":      map[string]interface{}{"properties": map[string]interface{}{"text": keyword}},
+							"user_mentions": map[string]interface{}{"properties": map[string]interface{}{"id_str": keyword, "screen_name": keyword}},
+							"urls":          map[string]interface{}{"properties": map[string]interface{}{"expanded_url": keyword}},
+						},
+					},
+					"coordinates": map[string]interface{}{
+						"properties": map[string]interface{}{"coordinates": map[string]string{"type": "geo_point"}},
+					},
+					"data": map[string]interface{}{
+						"properties": map[string]interface{}{
+							"id":              keyword,
+							"text":            text,
+							"lang":            keyword,
+							"author_id":       keyword,
+							"conversation_id": keyword,
+							"created_at":      date,
+						},
+					},
+				},
+			},
+		},
+	}
+	p, err := json.Marshal(template)
+	if err != nil {
+		return err
+	}
+	_, err = s.do(ctx, "PUT", "/_index_template/"+s.index(), "application/json", p)
+	return err
+}
+
+// document is a tweet to index.
+type document struct {
+	m     twitterstream.Message
+	i     int // index of m in the batch
+	id    string
+	index string
+}
+
+// documents returns the documents for the tweets in batch.
+func (s *Sink) documents(batch []twitterstream.Message) []document {
+	docs := make([]document, 0, len(batch))
+	for i, m := range batch {
+		if twitterstream.KindOf(m.Raw) != twitterstream.KindTweet {
+			continue
+		}
+		lm := twitterstream.LazyMessage(m.Raw)
+		d := document{m: m, i: i, id: lm.String("id_str"), index: s.index()}
+		timePath := "created_at"
+		if lm.Has("data") {
+			d.id, timePath = lm.String("data.id"), "data.created_at"
+		}
+		if d.id == "" {
+			continue
+		}
+		if s.DateLayout != "" {
+			t := m.Received
+			if v, ok := lm.Get(timePath); ok {
+				var tt twitterstream.TwitterTime
+				if tt.UnmarshalJSON(v) == nil && !tt.IsZero() {
+					t = tt.Time
+				}
+			}
+			d.index += "-" + t.UTC().Format(s.DateLayout)
+		}
+		docs = append(docs, d)
+	}
+	return docs
+}
+
+// bulk sends the documents in a bulk request and returns the error for each
+// document.
+func (s *Sink) bulk(ctx context.Context, docs []document) ([]error, error) {
+	var buf bytes.Buffer
+	for _, d := range docs {
+		action, err := json.Marshal(map[string]map[string]string{"index": {"_index": d.index, "_id": d.id}})
+		if err != nil {
+			return nil, err
+		}
+		buf.Write(action)
+		buf.WriteByte('\n')
+		buf.Write(d.m.Raw)
+		buf.WriteByte('\n')
+	}
+	p, err := s.do(ctx, "POST", "/_bulk", "application/x-ndjson", buf.Bytes())
+	if err != nil {
+		return nil, err
+	}
+	var resp struct {
+		Errors bool `json:"errors"`
+		Items  []map[string]struct {
+			Status int `json:"status"`
+			Error  *struct {
+				Type   string `json:"type"`
+				Reason string `json:"reason"`
+			} `json:"error"`
+		} `json:"items"`
+	}
+	if err := json.Unmarshal(p, &resp); err != nil {
+		return nil, err
+	}
+	errs := make([]error, len(docs))
+	if !resp.Errors {
+		return errs, nil
+	}
+	if len(resp.Items) != len(docs) {
+		return nil, errors.New("essink: bulk response does not match request")
+	}
+	for i, item := range resp.Items {
+		for _, r := range item {
+			if r.Error != nil {
+				errs[i] = &ItemError{Status: r.Status, Type: r.Error.Type, Reason: r.Error.Reason}
+			}
+		}
+	}
+	return errs, nil
+}
+
+// isTooManyRequests returns true if err is an HTTP 429 error for the request
+// or for a document.
+func isTooManyRequests(err error) bool {
+	var serr *StatusError
+	var ierr *ItemError
+	return (errors.As(err, &serr) && serr.StatusCode == 429) ||
+		(errors.As(err, &ierr) && ierr.Status == 429)
+}
+
+// write indexes the documents, retrying the documents rejected with HTTP
+// status 429, and handles the result for each message.
+func (s *Sink) write(ctx context.Context, batch []twitterstream.Message) error {
+	docs := s.documents(batch)
+	retries := s.Retries
+	if retries == 0 {
+		retries = 5
+	}
+	failed := make(map[int]error)
+	wait := time.Second
+	for attempt := 0; len(docs) > 0; attempt++ {
+		errs, err := s.bulk(ctx, docs)
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		var retry []document
+		for i, d := range docs {
+			derr := err
+			if err == nil {
+				derr = errs[i]
+			}
+			switch {
+			case derr == nil:
+			case attempt < retries && isTooManyRequests(derr):
+				retry = append(retry, d)
+			default:
+				failed[d.i] = derr
+			}
+		}
+		docs = retry
+		if len(docs) == 0 {
+			break
+		}
+		timer := time.NewTimer(wait)
+		select {
+		case <-timer.C:
+		case <-ctx.Done():
+			timer.Stop()
+			return ctx.Err()
+		}
+		if wait < time.Minute {
+			wait *= 2
+		}
+	}
+	for i, m := range batch {
+		if err := twitterstream.Settle(m, failed[i], s.OnError); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Write indexes a single message.
+func (s *Sink) Write(ctx context.Context, m twitterstream.Message) error {
+	return s.write(ctx, []twitterstream.Message{m})
+}
+
+// Run indexes the messages received from the channel until the channel is
+// closed or the context is done. Run sends the messages that are waiting on
+// the channel in one bulk request. Messages are acknowledged after the
+// cluster accepts the document or after OnError is called.
+func (s *Sink) Run(ctx context.Context, messages <-chan twitterstream.Message) error {
+	n := s.BatchSize
+	if n <= 0 {
+		n = 500
+	}
+	for {
+		batch, err := twitterstream.Batch(ctx, messages, n)
+		if err == io.EOF {
+			return nil
+		} else if err != nil {
+			return err
+		}
+		if err := s.write(ctx, batch); err != nil {
+			return err
+		}
+	}
+}
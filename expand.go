@@ -0,0 +1,171 @@
+// Copyright 2010 Gary Burd
+//
+// Licensed under the Apache License, Version 2.0 (the "License"): you may
+// not use this file except in compliance with the License. You may obtain
+// a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+// WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the
+// License for the specific language governing permissions and limitations
+// under the License.
+
+package twitterstream
+
+import (
+	"container/list"
+	"context"
+	"net/http"
+	"sync"
+)
+
+// URLExpander resolves t.co and other short links to their final
+// destination. The expander caches the results and limits the number of
+// concurrent requests. The fields must not be changed after the first call to
+// Expand.
+//
+//  x := &twitterstream.URLExpander{MaxConcurrent: 4, CacheSize: 10000}
+//  for {
+//      var t twitterstream.Tweet
+//      ...
+//      x.ExpandTweet(ctx, &t)
+//  }
+type URLExpander struct {
+	// HTTPClient is the client used for requests. The client follows
+	// redirects to the destination. If nil, then http.DefaultClient is used.
+	HTTPClient *http.Client
+
+	// MaxConcurrent is the maximum number of concurrent requests. If zero,
+	// then 8 requests are allowed.
+	MaxConcurrent int
+
+	// CacheSize is the number of resolved URLs to cache. If zero, then 1000
+	// URLs are cached.
+	CacheSize int
+
+	once sync.Once
+	sem  chan struct{}
+
+	mu    sync.Mutex
+	cache map[string]*list.Element
+	lru   list.List
+}
+
+type expandEntry struct {
+	short, long string
+}
+
+func (x *URLExpander) init() {
+	n := x.MaxConcurrent
+	if n <= 0 {
+		n = 8
+	}
+	x.sem = make(chan struct{}, n)
+	x.cache = make(map[string]*list.Element)
+}
+
+func (x *URLExpander) get(short string) (string, bool) {
+	x.mu.Lock()
+	defer x.mu.Unlock()
+	if e, ok := x.cache[short]; ok {
+		x.lru.MoveToFront(e)
+		return e.Value.(expandEntry).long, true
+	}
+	return "", false
+}
+
+func (x *URLExpander) put(short, long string) {
+	x.mu.Lock()
+	defer x.mu.Unlock()
+	if _, ok := x.cache[short]; ok {
+		return
+	}
+	x.cache[short] = x.lru.PushFront(expandEntry{short, long})
+	size := x.CacheSize
+	if size <= 0 {
+		size = 1000
+	}
+	if x.lru.Len() > size {
+		e := x.lru.Back()
+		x.lru.Remove(e)
+		delete(x.cache, e.Value.(expandEntry).short)
+	}
+}
+
+// Expand returns the destination of the short URL.
+func (x *URLExpander) Expand(ctx context.Context, shortURL string) (string, error) {
+	x.once.Do(x.init)
+	if long, ok := x.get(shortURL); ok {
+		return long, nil
+	}
+
+	select {
+	case x.sem <- struct{}{}:
+	case <-ctx.Done():
+		return "", ctx.Err()
+	}
+	defer func() { <-x.sem }()
+
+	req, err := http.NewRequestWithContext(ctx, "HEAD", shortURL, nil)
+	if err != nil {
+		return "", err
+	}
+	client := x.HTTPClient
+	if client == nil {
+		client = http.DefaultClient
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return "", err
+	}
+	resp.Body.Close()
+	long := resp.Request.URL.String()
+	x.put(shortURL, long)
+	return long, nil
+}
+
+// ExpandTweet replaces the ExpandedURL field of the URL entities in the
+// tweet, including the entities of the extended, retweeted and quoted
+// tweets, with the destination of the URL. Twitter sets ExpandedURL to the
+// URL submitted by the user, which is often another short link. URLs that
+// cannot be resolved are left unchanged. ExpandTweet returns the first error.
+func (x *URLExpander) ExpandTweet(ctx context.Context, t *Tweet) error {
+	var firstErr error
+	x.expandTweet(ctx, t, &firstErr)
+	return firstErr
+}
+
+func (x *URLExpander) expandTweet(ctx context.Context, t *Tweet, firstErr *error) {
+	if t == nil {
+		return
+	}
+	x.expandEntities(ctx, t.Entities, firstErr)
+	if t.ExtendedTweet != nil {
+		x.expandEntities(ctx, t.ExtendedTweet.Entities, firstErr)
+	}
+	x.expandTweet(ctx, t.RetweetedStatus, firstErr)
+	x.expandTweet(ctx, t.QuotedStatus, firstErr)
+}
+
+func (x *URLExpander) expandEntities(ctx context.Context, e *Entities, firstErr *error) {
+	if e == nil {
+		return
+	}
+	for i := range e.URLs {
+		u := &e.URLs[i]
+		short := u.ExpandedURL
+		if short == "" {
+			short = u.URL
+		}
+		long, err := x.Expand(ctx, short)
+		if err != nil {
+			if *firstErr == nil {
+				*firstErr = err
+			}
+			continue
+		}
+		u.ExpandedURL = long
+	}
+}
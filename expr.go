@@ -0,0 +1,507 @@
+// Copyright 2010 Gary Burd
+//
+// Licensed under the Apache License, Version 2.0 (the "License"): you may
+// not use this file except in compliance with the License. You may obtain
+// a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+// WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the
+// License for the specific language governing permissions and limitations
+// under the License.
+
+package twitterstream
+
+import (
+	"bytes"
+	"strconv"
+	"strings"
+	"sync/atomic"
+)
+
+// ParseFilter returns a filter for the expression. The filter evaluates the
+// expression against each tweet and delivers the tweets where the expression
+// is true. Notices are delivered.
+//
+// An expression compares fields of the tweet with literal values:
+//
+//  lang == "en" && user.followers_count > 1000 && !retweet
+//
+// Fields are named by JSON field names separated by dots. The fields of a
+// v2 message are relative to the data object. A missing field is null. The
+// names retweet, quote and reply are true if the tweet is a retweet, a quote
+// tweet or a reply.
+//
+// Literals are double quoted strings, numbers, true, false and null. The
+// operators are ==, !=, <, <=, >, >=, contains, &&, || and !. The operator !
+// binds tightest, followed by the comparison operators, then && and then ||,
+// so !a == b means (!a) == b. Comparisons do not chain. Parentheses group
+// subexpressions. The operator contains is
+// true if the string on the left contains the string on the right. Numbers
+// are compared as float64. Values of different types are not equal and are
+// not ordered. In a context requiring a boolean, null, false, zero, the
+// empty string and missing fields are false and other values are true.
+//
+// The filter finds the fields in the raw line without decoding the line.
+func ParseFilter(expr string) (Filter, error) {
+	p := &exprParser{s: expr}
+	p.next()
+	n, err := p.parseOr()
+	if err != nil {
+		return nil, err
+	}
+	if p.tok != tokEOF {
+		return nil, p.errorf("unexpected " + p.text)
+	}
+	return func(line []byte) bool {
+		if isNotice(line) {
+			return true
+		}
+		return truthy(n.eval(tweetObject(line)))
+	}, nil
+}
+
+// DynamicFilter is a filter that can be replaced while the stream is
+// running. The methods are safe to call from multiple goroutines.
+//
+//  df := twitterstream.NewDynamicFilter(nil)
+//  ts, err := twitterstream.Open(client, cred, url, params,
+//      twitterstream.OpenMessageFilter(df.Filter))
+//  ...
+//  err = df.SetExpr(`lang == "en" && !retweet`)
+type DynamicFilter struct {
+	f atomic.Pointer[Filter]
+}
+
+// NewDynamicFilter returns a dynamic filter with the initial filter f. A nil
+// filter delivers all lines.
+func NewDynamicFilter(f Filter) *DynamicFilter {
+	df := &DynamicFilter{}
+	df.Set(f)
+	return df
+}
+
+// Set replaces the filter. A nil filter delivers all lines.
+func (df *DynamicFilter) Set(f Filter) {
+	df.f.Store(&f)
+}
+
+// SetExpr replaces the filter with the filter for the expression. See
+// ParseFilter for the syntax of the expression. The filter is not changed if
+// the expression is not valid.
+func (df *DynamicFilter) SetExpr(expr string) error {
+	f, err := ParseFilter(expr)
+	if err != nil {
+		return err
+	}
+	df.Set(f)
+	return nil
+}
+
+// Filter applies the current filter to the line. The zero value of
+// DynamicFilter delivers all lines.
+func (df *DynamicFilter) Filter(p []byte) bool {
+	f := df.f.Load()
+	return f == nil || *f == nil || (*f)(p)
+}
+
+// ExprError is the error for an invalid filter expression.
+type ExprError struct {
+	// Pos is the byte offset of the error in the expression.
+	Pos     int
+	Message string
+}
+
+func (err *ExprError) Error() string {
+	return "twitterstream: filter expression: " + err.Message + " at offset " + strconv.Itoa(err.Pos)
+}
+
+// Expression tokens.
+const (
+	tokEOF = iota
+	tokIdent
+	tokString
+	tokNumber
+	tokOp
+)
+
+type exprParser struct {
+	s    string
+	pos  int // offset after the current token
+	tok  int
+	text string // text of the current token
+	at   int    // offset of the current token
+	err  error
+}
+
+func (p *exprParser) errorf(msg string) error {
+	return &ExprError{Pos: p.at, Message: msg}
+}
+
+// next scans the next token.
+func (p *exprParser) next() {
+	for p.pos < len(p.s) && strings.IndexByte(" \t\r\n", p.s[p.pos]) >= 0 {
+		p.pos++
+	}
+	p.at = p.pos
+	if p.pos >= len(p.s) {
+		p.tok, p.text = tokEOF, "end of expression"
+		return
+	}
+	c := p.s[p.pos]
+	switch {
+	case c == '"':
+		i := p.pos + 1
+		for i < len(p.s) && p.s[i] != '"' {
+			if p.s[i] == '\\' {
+				i++
+			}
+			i++
+		}
+		if i >= len(p.s) {
+			p.tok, p.text = tokOp, "unterminated string"
+			p.err = p.errorf("unterminated string")
+			p.pos = len(p.s)
+			return
+		}
+		p.tok, p.text = tokString, p.s[p.pos:i+1]
+		p.pos = i + 1
+	case c == '-' || c == '.' || c >= '0' && c <= '9':
+		i := p.pos + 1
+		for i < len(p.s) && strings.IndexByte("0123456789.eE+-", p.s[i]) >= 0 {
+			i++
+		}
+		p.tok, p.text = tokNumber, p.s[p.pos:i]
+		p.pos = i
+	case c == '_' || c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z':
+		i := p.pos + 1
+		for i < len(p.s) {
+			c := p.s[i]
+			if c == '_' || c == '.' || c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= '0' && c <= '9' {
+				i++
+				continue
+			}
+			break
+		}
+		p.tok, p.text = tokIdent, p.s[p.pos:i]
+		p.pos = i
+	default:
+		for _, op := range []string{"&&", "||", "==", "!=", "<=", ">=", "<", ">", "!", "(", ")"} {
+			if strings.HasPrefix(p.s[p.pos:], op) {
+				p.tok, p.text = tokOp, op
+				p.pos += len(op)
+				return
+			}
+		}
+		p.tok, p.text = tokOp, p.s[p.pos:p.pos+1]
+		p.err = p.errorf("unexpected " + p.text)
+		p.pos = len(p.s)
+	}
+}
+
+func (p *exprParser) parseOr() (exprNode, error) {
+	left, err := p.parseAnd()
+	if err != nil {
+		return nil, err
+	}
+	for p.tok == tokOp && p.text == "||" {
+		p.next()
+		right, err := p.parseAnd()
+		if err != nil {
+			return nil, err
+		}
+		left = &logicalNode{or: true, left: left, right: right}
+	}
+	return left, nil
+}
+
+func (p *exprParser) parseAnd() (exprNode, error) {
+	left, err := p.parseCompare()
+	if err != nil {
+		return nil, err
+	}
+	for p.tok == tokOp && p.text == "&&" {
+		p.next()
+		right, err := p.parseCompare()
+		if err != nil {
+			return nil, err
+		}
+		left = &logicalNode{left: left, right: right}
+	}
+	return left, nil
+}
+
+func (p *exprParser) parseCompare() (exprNode, error) {
+	left, err := p.parseUnary()
+	if err != nil {
+		return nil, err
+	}
+	if p.tok == tokOp || p.tok == tokIdent {
+		switch op := p.text; op {
+		case "==", "!=", "<", "<=", ">", ">=", "contains":
+			p.next()
+			right, err := p.parseUnary()
+			if err != nil {
+				return nil, err
+			}
+			return &compareNode{op: op, left: left, right: right}, nil
+		}
+	}
+	return left, nil
+}
+
+func (p *exprParser) parseUnary() (exprNode, error) {
+	if p.tok == tokOp && p.text == "!" {
+		p.next()
+		n, err := p.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+		return &notNode{n}, nil
+	}
+	return p.parsePrimary()
+}
+
+func (p *exprParser) parsePrimary() (exprNode, error) {
+	if p.err != nil {
+		return nil, p.err
+	}
+	text := p.text
+	switch p.tok {
+	case tokOp:
+		if text == "(" {
+			p.next()
+			n, err := p.parseOr()
+			if err != nil {
+				return nil, err
+			}
+			if p.tok != tokOp || p.text != ")" {
+				return nil, p.errorf("expected )")
+			}
+			p.next()
+			return n, nil
+		}
+	case tokString:
+		s, err := strconv.Unquote(text)
+		if err != nil {
+			return nil, p.errorf("invalid string " + text)
+		}
+		p.next()
+		return literalNode{s}, nil
+	case tokNumber:
+		f, err := strconv.ParseFloat(text, 64)
+		if err != nil {
+			return nil, p.errorf("invalid number " + text)
+		}
+		p.next()
+		return literalNode{f}, nil
+	case tokIdent:
+		if text == "contains" {
+			return nil, p.errorf("unexpected contains")
+		}
+		p.next()
+		switch text {
+		case "true":
+			return literalNode{true}, nil
+		case "false":
+			return literalNode{false}, nil
+		case "null":
+			return literalNode{nil}, nil
+		case "retweet":
+			return predicateNode(isRetweet), nil
+		case "quote":
+			return predicateNode(isQuote), nil
+		case "reply":
+			return predicateNode(isReply), nil
+		}
+		return fieldNode(strings.Split(text, ".")), nil
+	}
+	return nil, p.errorf("unexpected " + text)
+}
+
+// exprNode is a node in the expression tree. The eval method returns nil,
+// bool, float64, string or []byte for objects and arrays.
+type exprNode interface {
+	eval(p []byte) interface{}
+}
+
+type literalNode struct{ v interface{} }
+
+func (n literalNode) eval(p []byte) interface{} { return n.v }
+
+type fieldNode []string
+
+func (n fieldNode) eval(p []byte) interface{} {
+	v, ok := lookupPath(p, n)
+	if !ok {
+		return nil
+	}
+	return rawValue(v)
+}
+
+type predicateNode func(p []byte) bool
+
+func (n predicateNode) eval(p []byte) interface{} { return n(p) }
+
+type notNode struct{ n exprNode }
+
+func (n *notNode) eval(p []byte) interface{} { return !truthy(n.n.eval(p)) }
+
+type logicalNode struct {
+	or          bool
+	left, right exprNode
+}
+
+func (n *logicalNode) eval(p []byte) interface{} {
+	if truthy(n.left.eval(p)) == n.or {
+		return n.or
+	}
+	return truthy(n.right.eval(p))
+}
+
+type compareNode struct {
+	op          string
+	left, right exprNode
+}
+
+func (n *compareNode) eval(p []byte) interface{} {
+	a, b := n.left.eval(p), n.right.eval(p)
+	switch n.op {
+	case "==":
+		return valuesEqual(a, b)
+	case "!=":
+		return !valuesEqual(a, b)
+	case "contains":
+		as, ok1 := a.(string)
+		bs, ok2 := b.(string)
+		return ok1 && ok2 && strings.Contains(as, bs)
+	}
+	var c int
+	switch a := a.(type) {
+	case float64:
+		b, ok := b.(float64)
+		if !ok {
+			return false
+		}
+		switch {
+		case a < b:
+			c = -1
+		case a > b:
+			c = 1
+		}
+	case string:
+		b, ok := b.(string)
+		if !ok {
+			return false
+		}
+		c = strings.Compare(a, b)
+	default:
+		return false
+	}
+	switch n.op {
+	case "<":
+		return c < 0
+	case "<=":
+		return c <= 0
+	case ">":
+		return c > 0
+	case ">=":
+		return c >= 0
+	}
+	return false
+}
+
+func valuesEqual(a, b interface{}) bool {
+	if ab, ok := a.([]byte); ok {
+		bb, ok := b.([]byte)
+		return ok && bytes.Equal(ab, bb)
+	}
+	if _, ok := b.([]byte); ok {
+		return false
+	}
+	return a == b
+}
+
+// rawValue converts a raw JSON value to an expression value.
+func rawValue(v []byte) interface{} {
+	if len(v) == 0 {
+		return nil
+	}
+	switch v[0] {
+	case '"':
+		s, _ := rawString(v)
+		return s
+	case 't':
+		return true
+	case 'f':
+		return false
+	case 'n':
+		return nil
+	case '{', '[':
+		return v
+	}
+	f, err := strconv.ParseFloat(string(v), 64)
+	if err != nil {
+		return nil
+	}
+	return f
+}
+
+func truthy(v interface{}) bool {
+	switch v := v.(type) {
+	case nil:
+		return false
+	case bool:
+		return v
+	case float64:
+		return v != 0
+	case string:
+		return v != ""
+	}
+	return true
+}
+
+// isRetweet returns true if the v1.1 or v2 tweet is a retweet.
+func isRetweet(p []byte) bool {
+	if v, ok := objectField(p, "retweeted_status"); ok {
+		return truthy(rawValue(v))
+	}
+	return hasReferencedTweet(p, "retweeted")
+}
+
+// isQuote returns true if the v1.1 or v2 tweet quotes a tweet.
+func isQuote(p []byte) bool {
+	if v, ok := objectField(p, "is_quote_status"); ok {
+		return truthy(rawValue(v))
+	}
+	return hasReferencedTweet(p, "quoted")
+}
+
+// isReply returns true if the v1.1 or v2 tweet is a reply.
+func isReply(p []byte) bool {
+	if v, ok := objectField(p, "in_reply_to_status_id_str"); ok {
+		return truthy(rawValue(v))
+	}
+	return hasReferencedTweet(p, "replied_to")
+}
+
+// hasReferencedTweet returns true if the v2 tweet references a tweet with
+// the given type.
+func hasReferencedTweet(p []byte, typ string) bool {
+	v, ok := objectField(p, "referenced_tweets")
+	if !ok {
+		return false
+	}
+	found := false
+	arrayElements(v, func(e []byte) bool {
+		t, ok := objectField(e, "type")
+		if ok {
+			s, _ := rawString(t)
+			found = s == typ
+		}
+		return !found
+	})
+	return found
+}
@@ -0,0 +1,170 @@
+// Copyright 2010 Gary Burd
+//
+// Licensed under the Apache License, Version 2.0 (the "License"): you may
+// not use this file except in compliance with the License. You may obtain
+// a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+// WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the
+// License for the specific language governing permissions and limitations
+// under the License.
+
+package twitterstream
+
+import (
+	"errors"
+	"testing"
+)
+
+var exprLines = map[string]string{
+	"tweet":     `{"id_str":"1","lang":"en","text":"Hello, gophers","user":{"id_str":"9","screen_name":"gopher","followers_count":2000,"verified":false},"entities":{"hashtags":[{"text":"golang","indices":[0,7]}]},"retweeted_status":null,"is_quote_status":false,"in_reply_to_status_id_str":null,"possibly_sensitive":false}`,
+	"retweet":   `{"id_str":"2","lang":"en","text":"RT @gopher: Hello","user":{"id_str":"8","followers_count":10},"retweeted_status":{"id_str":"1"},"is_quote_status":false,"in_reply_to_status_id_str":null}`,
+	"quote":     `{"id_str":"3","lang":"fr","text":"Bonjour","user":{"id_str":"8"},"is_quote_status":true,"quoted_status_id_str":"1"}`,
+	"reply":     `{"id_str":"4","lang":"en","text":"@gopher hi","user":{"id_str":"8"},"in_reply_to_status_id_str":"1"}`,
+	"v2":        `{"data":{"id":"5","lang":"fr","text":"Bonjour \"le\" monde","author_id":"7","public_metrics":{"retweet_count":5}},"matching_rules":[{"id":"1","tag":"fr"}]}`,
+	"v2retweet": `{"data":{"id":"6","text":"RT","referenced_tweets":[{"type":"retweeted","id":"5"}]}}`,
+	"v2quote":   `{"data":{"id":"7","text":"Q","referenced_tweets":[{"type":"replied_to","id":"4"},{"type":"quoted","id":"5"}]}}`,
+	"v2reply":   `{"data":{"id":"8","text":"R","referenced_tweets":[{"type":"replied_to","id":"4"}]}}`,
+	"delete":    `{"delete":{"status":{"id":1,"id_str":"1","user_id":9,"user_id_str":"9"}}}`,
+}
+
+var exprTests = []struct {
+	expr string
+	line string
+	want bool
+}{
+	{`lang == "en"`, "tweet", true},
+	{`lang == "en"`, "quote", false},
+	{`lang != "en"`, "quote", true},
+	{`user.followers_count > 1000`, "tweet", true},
+	{`user.followers_count > 1000`, "retweet", false},
+	{`user.followers_count >= 2000 && user.followers_count <= 2000`, "tweet", true},
+	{`user.followers_count < 1e4`, "tweet", true},
+	{`user.screen_name < "h"`, "tweet", true},
+	{`user.missing`, "tweet", false},
+	{`user.missing == null`, "tweet", true},
+	{`user.verified == false`, "tweet", true},
+	{`user.followers_count == "2000"`, "tweet", false},
+	{`user.followers_count > "1"`, "tweet", false},
+	{`text contains "gopher"`, "tweet", true},
+	{`text contains "rust"`, "tweet", false},
+	{`entities.hashtags.0.text == "golang"`, "tweet", true},
+	{`entities.hashtags.1.text == "golang"`, "tweet", false},
+	{`entities.hashtags`, "tweet", true},
+
+	// Precedence.
+	{`!lang == "fr"`, "tweet", false},
+	{`!(lang == "fr")`, "tweet", true},
+	{`!retweet == true`, "tweet", true},
+	{`!!retweet`, "retweet", true},
+	{`lang == "fr" || lang == "en" && retweet`, "tweet", false},
+	{`lang == "fr" || lang == "en" && retweet`, "quote", true},
+	{`(lang == "fr" || lang == "en") && retweet`, "retweet", true},
+	{`lang == "en" && !retweet || quote`, "quote", true},
+	{`lang == "en" && !retweet || quote`, "retweet", false},
+
+	// v2 fields are relative to the data object.
+	{`lang == "fr" && author_id == "7"`, "v2", true},
+	{`public_metrics.retweet_count > 4`, "v2", true},
+	{`text contains "\"le\""`, "v2", true},
+	{`matching_rules`, "v2", false},
+
+	// Predicates.
+	{`retweet`, "tweet", false},
+	{`retweet`, "retweet", true},
+	{`retweet`, "v2retweet", true},
+	{`retweet`, "v2quote", false},
+	{`quote`, "tweet", false},
+	{`quote`, "quote", true},
+	{`quote`, "v2quote", true},
+	{`quote`, "v2reply", false},
+	{`reply`, "tweet", false},
+	{`reply`, "reply", true},
+	{`reply`, "v2reply", true},
+	{`reply`, "v2retweet", false},
+	{`!retweet && !quote && !reply`, "tweet", true},
+
+	// Notices are delivered.
+	{`lang == "xx"`, "delete", true},
+}
+
+func TestParseFilter(t *testing.T) {
+	for _, tt := range exprTests {
+		f, err := ParseFilter(tt.expr)
+		if err != nil {
+			t.Errorf("ParseFilter(%q) returned error %v", tt.expr, err)
+			continue
+		}
+		if got := f([]byte(exprLines[tt.line])); got != tt.want {
+			t.Errorf("ParseFilter(%q) on %s = %v, want %v", tt.expr, tt.line, got, tt.want)
+		}
+	}
+}
+
+var exprErrorTests = []struct {
+	expr string
+	pos  int
+}{
+	{``, 0},
+	{`lang ==`, 7},
+	{`lang == "en`, 8},
+	{`lang == "en" lang`, 13},
+	{`(lang == "en"`, 13},
+	{`lang == "en")`, 12},
+	{`lang = "en"`, 5},
+	{`lang == "\q"`, 8},
+	{`count > 1.2.3`, 8},
+	{`a == b == c`, 7},
+	{`contains`, 0},
+	{`lang == "en" &&`, 15},
+	{`!`, 1},
+	{`#`, 0},
+}
+
+func TestParseFilterErrors(t *testing.T) {
+	for _, tt := range exprErrorTests {
+		_, err := ParseFilter(tt.expr)
+		var e *ExprError
+		if !errors.As(err, &e) {
+			t.Errorf("ParseFilter(%q) returned error %v, want *ExprError", tt.expr, err)
+			continue
+		}
+		if e.Pos != tt.pos {
+			t.Errorf("ParseFilter(%q) error %q at %d, want %d", tt.expr, e.Message, e.Pos, tt.pos)
+		}
+	}
+}
+
+func TestDynamicFilter(t *testing.T) {
+	en := []byte(exprLines["tweet"])
+	fr := []byte(exprLines["quote"])
+
+	var zero DynamicFilter
+	if !zero.Filter(en) || !zero.Filter(fr) {
+		t.Error("zero DynamicFilter rejected a line")
+	}
+
+	df := NewDynamicFilter(nil)
+	if !df.Filter(en) {
+		t.Error("nil filter rejected a line")
+	}
+	if err := df.SetExpr(`lang == "fr"`); err != nil {
+		t.Fatal(err)
+	}
+	if df.Filter(en) || !df.Filter(fr) {
+		t.Error("filter not applied")
+	}
+	if err := df.SetExpr(`lang ==`); err == nil {
+		t.Fatal("SetExpr returned nil error for invalid expression")
+	}
+	if df.Filter(en) || !df.Filter(fr) {
+		t.Error("filter changed by invalid expression")
+	}
+	df.Set(nil)
+	if !df.Filter(en) {
+		t.Error("nil filter rejected a line")
+	}
+}
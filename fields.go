@@ -0,0 +1,128 @@
+// Copyright 2010 Gary Burd
+//
+// Licensed under the Apache License, Version 2.0 (the "License"): you may
+// not use this file except in compliance with the License. You may obtain
+// a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+// WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the
+// License for the specific language governing permissions and limitations
+// under the License.
+
+package twitterstream
+
+import (
+	"net/url"
+	"strings"
+)
+
+// Expansions for v2 endpoints.
+const (
+	ExpansionAuthorID                 = "author_id"
+	ExpansionReferencedTweetsID       = "referenced_tweets.id"
+	ExpansionReferencedTweetsAuthorID = "referenced_tweets.id.author_id"
+	ExpansionInReplyToUserID          = "in_reply_to_user_id"
+	ExpansionAttachmentsMediaKeys     = "attachments.media_keys"
+	ExpansionAttachmentsPollIDs       = "attachments.poll_ids"
+	ExpansionGeoPlaceID               = "geo.place_id"
+	ExpansionEntitiesMentionsUsername = "entities.mentions.username"
+)
+
+// Tweet fields for v2 endpoints.
+const (
+	TweetFieldAttachments       = "attachments"
+	TweetFieldAuthorID          = "author_id"
+	TweetFieldConversationID    = "conversation_id"
+	TweetFieldCreatedAt         = "created_at"
+	TweetFieldEntities          = "entities"
+	TweetFieldGeo               = "geo"
+	TweetFieldInReplyToUserID   = "in_reply_to_user_id"
+	TweetFieldLang              = "lang"
+	TweetFieldPossiblySensitive = "possibly_sensitive"
+	TweetFieldPublicMetrics     = "public_metrics"
+	TweetFieldReferencedTweets  = "referenced_tweets"
+	TweetFieldSource            = "source"
+)
+
+// User fields for v2 endpoints.
+const (
+	UserFieldCreatedAt     = "created_at"
+	UserFieldDescription   = "description"
+	UserFieldLocation      = "location"
+	UserFieldProtected     = "protected"
+	UserFieldPublicMetrics = "public_metrics"
+	UserFieldVerified      = "verified"
+)
+
+// Media fields for v2 endpoints.
+const (
+	MediaFieldAltText         = "alt_text"
+	MediaFieldDurationMs      = "duration_ms"
+	MediaFieldHeight          = "height"
+	MediaFieldPreviewImageURL = "preview_image_url"
+	MediaFieldURL             = "url"
+	MediaFieldWidth           = "width"
+)
+
+// Place fields for v2 endpoints.
+const (
+	PlaceFieldContainedWithin = "contained_within"
+	PlaceFieldCountry         = "country"
+	PlaceFieldCountryCode     = "country_code"
+	PlaceFieldGeo             = "geo"
+	PlaceFieldName            = "name"
+	PlaceFieldPlaceType       = "place_type"
+)
+
+// Poll fields for v2 endpoints.
+const (
+	PollFieldDurationMinutes = "duration_minutes"
+	PollFieldEndDatetime     = "end_datetime"
+	PollFieldVotingStatus    = "voting_status"
+)
+
+// FieldsV2 specifies the expansions and fields requested from a v2 endpoint.
+//
+//  params := twitterstream.FieldsV2{
+//      Expansions:  []string{twitterstream.ExpansionAuthorID},
+//      TweetFields: []string{twitterstream.TweetFieldCreatedAt, twitterstream.TweetFieldLang},
+//      UserFields:  []string{twitterstream.UserFieldVerified},
+//  }.Values()
+//  ts, err := twitterstream.OpenFilteredV2(ctx, token, params)
+type FieldsV2 struct {
+	Expansions  []string
+	TweetFields []string
+	UserFields  []string
+	MediaFields []string
+	PlaceFields []string
+	PollFields  []string
+}
+
+// Values returns the expansions and fields encoded as request parameters.
+func (f FieldsV2) Values() url.Values {
+	params := url.Values{}
+	f.AddTo(params)
+	return params
+}
+
+// AddTo adds the expansions and fields to params.
+func (f FieldsV2) AddTo(params url.Values) {
+	for _, p := range []struct {
+		key    string
+		values []string
+	}{
+		{"expansions", f.Expansions},
+		{"tweet.fields", f.TweetFields},
+		{"user.fields", f.UserFields},
+		{"media.fields", f.MediaFields},
+		{"place.fields", f.PlaceFields},
+		{"poll.fields", f.PollFields},
+	} {
+		if len(p.values) > 0 {
+			params.Set(p.key, strings.Join(p.values, ","))
+		}
+	}
+}
@@ -0,0 +1,127 @@
+// Copyright 2010 Gary Burd
+//
+// Licensed under the Apache License, Version 2.0 (the "License"): you may
+// not use this file except in compliance with the License. You may obtain
+// a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+// WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the
+// License for the specific language governing permissions and limitations
+// under the License.
+
+package twitterstream
+
+import (
+	"bytes"
+	"regexp"
+)
+
+// Filter returns true if a line read from the stream should be delivered to
+// the application. Filters run on the raw line before the application decodes
+// the line. Filters should deliver notices and other messages that the filter
+// does not understand.
+//
+// Use the OpenMessageFilter option to filter the lines returned by Next or
+// use FilterMessages to filter a channel of messages.
+type Filter func(p []byte) bool
+
+// AllFilters returns a filter that delivers a line if all of the filters
+// deliver the line.
+func AllFilters(filters ...Filter) Filter {
+	return func(p []byte) bool {
+		for _, f := range filters {
+			if !f(p) {
+				return false
+			}
+		}
+		return true
+	}
+}
+
+// AnyFilter returns a filter that delivers a line if one of the filters
+// delivers the line.
+func AnyFilter(filters ...Filter) Filter {
+	return func(p []byte) bool {
+		for _, f := range filters {
+			if f(p) {
+				return true
+			}
+		}
+		return false
+	}
+}
+
+// FilterMessages starts a goroutine that sends the messages from messages
+// accepted by the filter to the returned channel. Rejected messages are
+// acknowledged and released. The returned channel is closed after messages
+// is closed.
+func FilterMessages(messages <-chan Message, f Filter) <-chan Message {
+	c := make(chan Message)
+	go func() {
+		defer close(c)
+		for m := range messages {
+			if f(m.Raw) {
+				c <- m
+			} else {
+				m.Ack()
+				m.Release()
+			}
+		}
+	}()
+	return c
+}
+
+// LangFilter returns a filter that delivers tweets with a lang field equal
+// to one of the given BCP 47 language tags. Twitter sets the lang field to
+// "und" when the language is not detected. The filter finds the field
+// without decoding the line. Lines without a lang field, such as notices,
+// are delivered.
+func LangFilter(langs ...string) Filter {
+	allow := make(map[string]bool, len(langs))
+	for _, lang := range langs {
+		allow[lang] = true
+	}
+	return func(p []byte) bool {
+		v, ok := objectField(tweetObject(p), "lang")
+		if !ok {
+			return true
+		}
+		lang, ok := rawString(v)
+		return !ok || allow[lang]
+	}
+}
+
+// KeywordFilter returns a filter that delivers tweets containing one of the
+// keywords anywhere in the raw line. The filter is much cheaper than decoding
+// the line and is useful for discarding most of a high volume stream before
+// decoding. Because the filter matches the raw JSON, a keyword can match a
+// field other than the text, such as the user's description, and a keyword
+// does not match text that Twitter escapes in the JSON, such as "/" sent as
+// "\/" and non-ASCII characters sent as \u escapes. Check the decoded tweet
+// to confirm the match. Notices are delivered.
+func KeywordFilter(keywords ...string) Filter {
+	bkeywords := make([][]byte, len(keywords))
+	for i, k := range keywords {
+		bkeywords[i] = []byte(k)
+	}
+	return func(p []byte) bool {
+		for _, k := range bkeywords {
+			if bytes.Contains(p, k) {
+				return true
+			}
+		}
+		return isNotice(p)
+	}
+}
+
+// RegexpFilter returns a filter that delivers tweets where the raw line
+// matches the regular expression. The caveats for KeywordFilter apply.
+// Notices are delivered.
+func RegexpFilter(re *regexp.Regexp) Filter {
+	return func(p []byte) bool {
+		return re.Match(p) || isNotice(p)
+	}
+}
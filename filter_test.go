@@ -0,0 +1,56 @@
+// Copyright 2010 Gary Burd
+//
+// Licensed under the Apache License, Version 2.0 (the "License"): you may
+// not use this file except in compliance with the License. You may obtain
+// a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+// WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the
+// License for the specific language governing permissions and limitations
+// under the License.
+
+package twitterstream
+
+import (
+	"testing"
+)
+
+func TestOpenMessageFilterReapplied(t *testing.T) {
+	var a, b int
+	options := []OpenOption{
+		OpenMessageFilter(func(p []byte) bool { a++; return true }),
+		OpenMessageFilter(func(p []byte) bool { b++; return true }),
+	}
+	// The options are applied again on each connect.
+	for i := 1; i <= 5; i++ {
+		do := newOpenOptions(options)
+		a, b = 0, 0
+		if !do.filter([]byte(`{}`)) {
+			t.Fatalf("connect %d: filter rejected line", i)
+		}
+		if a != 1 || b != 1 {
+			t.Fatalf("connect %d: filters called %d and %d times, want 1 and 1", i, a, b)
+		}
+	}
+}
+
+func TestLangFilter(t *testing.T) {
+	f := LangFilter("en", "fr")
+	tests := []struct {
+		p    string
+		want bool
+	}{
+		{`{"id_str":"1","lang":"en"}`, true},
+		{`{"id_str":"1","lang":"de"}`, false},
+		{`{"data":{"id":"1","lang":"fr"}}`, true},
+		{`{"delete":{}}`, true},
+	}
+	for _, tt := range tests {
+		if got := f([]byte(tt.p)); got != tt.want {
+			t.Errorf("LangFilter(%s) = %v, want %v", tt.p, got, tt.want)
+		}
+	}
+}
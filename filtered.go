@@ -0,0 +1,150 @@
+// Copyright 2010 Gary Burd
+//
+// Licensed under the Apache License, Version 2.0 (the "License"): you may
+// not use this file except in compliance with the License. You may obtain
+// a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+// WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the
+// License for the specific language governing permissions and limitations
+// under the License.
+
+package twitterstream
+
+import (
+	"context"
+	"encoding/json"
+	"net/url"
+	"sync"
+)
+
+// FilteredStreamV2 is a reconnecting v2 filtered stream with a client for the
+// stream's rules. Twitter applies rule changes to the open connection, so the
+// rules can be changed without reconnecting. The stream keeps a copy of the
+// rules for resolving the matching rules of delivered tweets.
+//
+//  fs := twitterstream.NewFilteredStreamV2(token, nil)
+//  defer fs.Close()
+//  if _, err := fs.AddRules(ctx, twitterstream.Rule{Value: "golang", Tag: "go"}); err != nil {
+//      log.Fatal(err)
+//  }
+//  for {
+//      r, rules, err := fs.NextResponse()
+//      ...
+//  }
+type FilteredStreamV2 struct {
+	*ReconnectingStream
+
+	// Client is the client for the rules endpoint.
+	Client *RulesClient
+
+	mu    sync.Mutex
+	rules map[string]Rule
+}
+
+// NewFilteredStreamV2 returns a reconnecting stream for the v2 filtered
+// stream endpoint. The arguments have the same meaning as the arguments to
+// OpenFilteredV2.
+func NewFilteredStreamV2(bearerToken string, params url.Values, options ...OpenOption) *FilteredStreamV2 {
+	return &FilteredStreamV2{
+		ReconnectingStream: NewReconnectingStreamV2(bearerToken, FilteredStreamV2URL, params, options...),
+		Client:             &RulesClient{BearerToken: bearerToken},
+		rules:              make(map[string]Rule),
+	}
+}
+
+// RefreshRules fetches the application's rules and returns the rules.
+func (fs *FilteredStreamV2) RefreshRules(ctx context.Context) ([]Rule, error) {
+	rules, err := fs.Client.Rules(ctx)
+	if err != nil {
+		return nil, err
+	}
+	fs.mu.Lock()
+	fs.rules = make(map[string]Rule, len(rules))
+	for _, r := range rules {
+		fs.rules[r.ID] = r
+	}
+	fs.mu.Unlock()
+	return rules, nil
+}
+
+// AddRules adds rules to the application's rule set. The rules apply to the
+// open connection. See RulesClient.AddRules for details.
+func (fs *FilteredStreamV2) AddRules(ctx context.Context, rules ...Rule) ([]Rule, error) {
+	added, err := fs.Client.AddRules(ctx, rules, false)
+	fs.mu.Lock()
+	for _, r := range added {
+		fs.rules[r.ID] = r
+	}
+	fs.mu.Unlock()
+	return added, err
+}
+
+// DeleteRules deletes the rules with the given IDs from the application's rule
+// set. The change applies to the open connection.
+func (fs *FilteredStreamV2) DeleteRules(ctx context.Context, ids ...string) error {
+	if err := fs.Client.DeleteRules(ctx, ids, false); err != nil {
+		return err
+	}
+	fs.mu.Lock()
+	for _, id := range ids {
+		delete(fs.rules, id)
+	}
+	fs.mu.Unlock()
+	return nil
+}
+
+// Rule returns the rule with the given ID. Rule returns false if the rule is
+// not known to the stream. Call RefreshRules to load rules added by other
+// clients.
+func (fs *FilteredStreamV2) Rule(id string) (Rule, bool) {
+	fs.mu.Lock()
+	defer fs.mu.Unlock()
+	r, ok := fs.rules[id]
+	return r, ok
+}
+
+// NextResponse reads and decodes the next line from the stream. The function
+// returns the rules matched by the tweet. A matching rule not known to the
+// stream is returned with the ID and tag sent by Twitter.
+func (fs *FilteredStreamV2) NextResponse() (*ResponseV2, []Rule, error) {
+	p, err := fs.Next()
+	if err != nil {
+		return nil, nil, err
+	}
+	var r ResponseV2
+	if err := json.Unmarshal(p, &r); err != nil {
+		return nil, nil, err
+	}
+	rules := make([]Rule, len(r.MatchingRules))
+	for i, mr := range r.MatchingRules {
+		if rule, ok := fs.Rule(mr.ID); ok {
+			rules[i] = rule
+		} else {
+			rules[i] = Rule{ID: mr.ID, Tag: mr.Tag}
+		}
+	}
+	return &r, rules, nil
+}
+
+// RuleIDs returns the IDs of the rules matched by the tweet.
+func (r *ResponseV2) RuleIDs() []string {
+	ids := make([]string, len(r.MatchingRules))
+	for i, mr := range r.MatchingRules {
+		ids[i] = mr.ID
+	}
+	return ids
+}
+
+// MatchesRule returns true if the tweet matched the rule with the given ID.
+func (r *ResponseV2) MatchesRule(id string) bool {
+	for _, mr := range r.MatchingRules {
+		if mr.ID == id {
+			return true
+		}
+	}
+	return false
+}
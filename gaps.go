@@ -0,0 +1,100 @@
+// Copyright 2010 Gary Burd
+//
+// Licensed under the Apache License, Version 2.0 (the "License"): you may
+// not use this file except in compliance with the License. You may obtain
+// a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+// WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the
+// License for the specific language governing permissions and limitations
+// under the License.
+
+package twitterstream
+
+import (
+	"time"
+)
+
+// GapKind is the cause of a gap in a stream.
+type GapKind int
+
+const (
+	// GapDisconnect is a period when the stream was not connected.
+	GapDisconnect GapKind = iota
+
+	// GapLimit is a period in which Twitter did not deliver matching tweets
+	// because of rate limits.
+	GapLimit
+)
+
+// Gap is an estimated period of missing data in a stream.
+type Gap struct {
+	Kind GapKind
+
+	// Start and End are the estimated bounds of the gap. For a disconnect,
+	// Start is the time the last message was received on the dropped
+	// connection and End is the time the stream reconnected. For a limit
+	// notice, the gap is the time between the notice and the previous
+	// notice or the start of the connection.
+	Start, End time.Time
+
+	// Missed is the number of undelivered tweets reported by a limit notice.
+	// Missed is zero for disconnects because the count is not known.
+	Missed int64
+
+	// Err is the error that closed the connection for a disconnect.
+	Err error
+}
+
+// maxGaps is the maximum number of gaps recorded by a stream. Older gaps are
+// discarded.
+const maxGaps = 1000
+
+func appendGap(gaps []Gap, g Gap) []Gap {
+	if len(gaps) >= maxGaps {
+		gaps = append(gaps[:0], gaps[len(gaps)-maxGaps+1:]...)
+	}
+	return append(gaps, g)
+}
+
+// Gaps returns the gaps reported by limit notices on the connection, oldest
+// first. Gaps can be called concurrently with Next.
+func (ts *Stream) Gaps() []Gap {
+	ts.gapsMu.Lock()
+	defer ts.gapsMu.Unlock()
+	return append([]Gap(nil), ts.gaps...)
+}
+
+// limitGap records the gap for a limit notice with cumulative count track.
+func (ts *Stream) limitGap(track int64) {
+	now := time.Now()
+	ts.gapsMu.Lock()
+	defer ts.gapsMu.Unlock()
+	start := ts.lastLimit
+	if start.IsZero() {
+		start = loadTime(&ts.stats.connected)
+	}
+	if missed := track - ts.limitTrack; missed > 0 {
+		ts.gaps = appendGap(ts.gaps, Gap{Kind: GapLimit, Start: start, End: now, Missed: missed})
+		ts.limitTrack = track
+	}
+	ts.lastLimit = now
+}
+
+// Gaps returns the gaps caused by disconnects and limit notices over all
+// connections, oldest first. At most the last 1000 gaps are returned. Gaps can
+// be called concurrently with Next.
+func (rs *ReconnectingStream) Gaps() []Gap {
+	rs.mu.Lock()
+	defer rs.mu.Unlock()
+	gaps := append([]Gap(nil), rs.gaps...)
+	if rs.ts != nil {
+		for _, g := range rs.ts.Gaps() {
+			gaps = appendGap(gaps, g)
+		}
+	}
+	return gaps
+}
@@ -0,0 +1,296 @@
+// Copyright 2010 Gary Burd
+//
+// Licensed under the Apache License, Version 2.0 (the "License"): you may
+// not use this file except in compliance with the License. You may obtain
+// a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+// WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the
+// License for the specific language governing permissions and limitations
+// under the License.
+
+package twitterstream
+
+import (
+	"encoding/json"
+	"math"
+)
+
+// Region is a geographic area used by GeoFilter. BoundingBox and *Polygon
+// implement Region.
+type Region interface {
+	// Contains returns true if the point is in the region.
+	Contains(p Point) bool
+
+	// Intersects returns true if the box and the region overlap.
+	Intersects(b BoundingBox) bool
+}
+
+// Intersects returns true if the boxes overlap.
+func (b BoundingBox) Intersects(o BoundingBox) bool {
+	return b.West <= o.East && o.West <= b.East && b.South <= o.North && o.South <= b.North
+}
+
+// pointFromGeoJSON converts a GeoJSON position in longitude, latitude order
+// to a point.
+func pointFromGeoJSON(c [2]float64) Point {
+	return Point{Lat: c[1], Lon: c[0]}
+}
+
+// Point returns the location of the coordinates.
+func (c *Coordinates) Point() Point {
+	return pointFromGeoJSON(c.Coordinates)
+}
+
+// Points returns the vertices of the outer ring of the polygon.
+func (p *Polygon) Points() []Point {
+	if len(p.Coordinates) == 0 {
+		return nil
+	}
+	ring := p.Coordinates[0]
+	points := make([]Point, len(ring))
+	for i, c := range ring {
+		points[i] = pointFromGeoJSON(c)
+	}
+	return points
+}
+
+// Bounds returns the smallest box containing the polygon. Bounds returns
+// false if the polygon does not have any vertices.
+func (p *Polygon) Bounds() (BoundingBox, bool) {
+	points := p.Points()
+	if len(points) == 0 {
+		return BoundingBox{}, false
+	}
+	b := BoundingBox{West: points[0].Lon, South: points[0].Lat, East: points[0].Lon, North: points[0].Lat}
+	for _, pt := range points[1:] {
+		b.West = math.Min(b.West, pt.Lon)
+		b.South = math.Min(b.South, pt.Lat)
+		b.East = math.Max(b.East, pt.Lon)
+		b.North = math.Max(b.North, pt.Lat)
+	}
+	return b, true
+}
+
+// Contains returns true if the point is inside the outer ring of the polygon
+// or on the boundary of a degenerate polygon. Twitter represents the bounding
+// box of a place with a point of interest type as four identical vertices.
+func (p *Polygon) Contains(pt Point) bool {
+	b, ok := p.Bounds()
+	if !ok || !b.Contains(pt) {
+		return false
+	}
+	points := p.Points()
+	if b.West == b.East || b.South == b.North {
+		return true
+	}
+	in := false
+	for i, j := 0, len(points)-1; i < len(points); j, i = i, i+1 {
+		a, c := points[i], points[j]
+		if (a.Lat > pt.Lat) != (c.Lat > pt.Lat) &&
+			pt.Lon < (c.Lon-a.Lon)*(pt.Lat-a.Lat)/(c.Lat-a.Lat)+a.Lon {
+			in = !in
+		}
+	}
+	return in || onBoundary(points, pt)
+}
+
+// Intersects returns true if the box and the polygon overlap.
+func (p *Polygon) Intersects(b BoundingBox) bool {
+	bounds, ok := p.Bounds()
+	if !ok || !bounds.Intersects(b) {
+		return false
+	}
+	points := p.Points()
+	for _, pt := range points {
+		if b.Contains(pt) {
+			return true
+		}
+	}
+	corners := []Point{
+		{Lat: b.South, Lon: b.West},
+		{Lat: b.South, Lon: b.East},
+		{Lat: b.North, Lon: b.East},
+		{Lat: b.North, Lon: b.West},
+	}
+	for _, pt := range corners {
+		if p.Contains(pt) {
+			return true
+		}
+	}
+	for i, j := 0, len(points)-1; i < len(points); j, i = i, i+1 {
+		for k, l := 0, len(corners)-1; k < len(corners); l, k = k, k+1 {
+			if segmentsCross(points[i], points[j], corners[k], corners[l]) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// segmentsCross returns true if segment ab properly crosses segment cd.
+func segmentsCross(a, b, c, d Point) bool {
+	orient := func(p, q, r Point) float64 {
+		return (q.Lon-p.Lon)*(r.Lat-p.Lat) - (q.Lat-p.Lat)*(r.Lon-p.Lon)
+	}
+	d1, d2 := orient(a, b, c), orient(a, b, d)
+	d3, d4 := orient(c, d, a), orient(c, d, b)
+	return ((d1 > 0 && d2 < 0) || (d1 < 0 && d2 > 0)) &&
+		((d3 > 0 && d4 < 0) || (d3 < 0 && d4 > 0))
+}
+
+// onBoundary returns true if pt is on an edge of the ring.
+func onBoundary(points []Point, pt Point) bool {
+	for i, j := 0, len(points)-1; i < len(points); j, i = i, i+1 {
+		a, c := points[i], points[j]
+		cross := (c.Lon-a.Lon)*(pt.Lat-a.Lat) - (c.Lat-a.Lat)*(pt.Lon-a.Lon)
+		if cross == 0 &&
+			pt.Lon >= math.Min(a.Lon, c.Lon) && pt.Lon <= math.Max(a.Lon, c.Lon) &&
+			pt.Lat >= math.Min(a.Lat, c.Lat) && pt.Lat <= math.Max(a.Lat, c.Lat) {
+			return true
+		}
+	}
+	return false
+}
+
+// Centroid returns the centroid of the outer ring of the polygon. The
+// centroid of a degenerate polygon is the mean of the vertices. Centroid
+// returns false if the polygon does not have any vertices.
+func (p *Polygon) Centroid() (Point, bool) {
+	points := p.Points()
+	if len(points) == 0 {
+		return Point{}, false
+	}
+	// Translate the vertices to the first vertex for numerical stability.
+	o := points[0]
+	var area, lat, lon float64
+	for i, j := 0, len(points)-1; i < len(points); j, i = i, i+1 {
+		a := Point{Lat: points[j].Lat - o.Lat, Lon: points[j].Lon - o.Lon}
+		c := Point{Lat: points[i].Lat - o.Lat, Lon: points[i].Lon - o.Lon}
+		cross := a.Lon*c.Lat - c.Lon*a.Lat
+		area += cross
+		lon += (a.Lon + c.Lon) * cross
+		lat += (a.Lat + c.Lat) * cross
+	}
+	if area == 0 {
+		for _, pt := range points {
+			lat += pt.Lat
+			lon += pt.Lon
+		}
+		n := float64(len(points))
+		return Point{Lat: lat / n, Lon: lon / n}, true
+	}
+	return Point{Lat: o.Lat + lat/(3*area), Lon: o.Lon + lon/(3*area)}, true
+}
+
+// Contains returns true if the point is inside the place's bounding box.
+func (pl *Place) Contains(pt Point) bool {
+	return pl.BoundingBox != nil && pl.BoundingBox.Contains(pt)
+}
+
+// Centroid returns the center of the place's bounding box. Centroid returns
+// false if the place does not have a bounding box.
+func (pl *Place) Centroid() (Point, bool) {
+	if pl.BoundingBox == nil {
+		return Point{}, false
+	}
+	return pl.BoundingBox.Centroid()
+}
+
+// Location returns the location of the tweet. The location is the exact
+// coordinates of the tweet if set or the centroid of the tagged place. The
+// function returns false if the tweet does not have a location.
+func (t *Tweet) Location() (Point, bool) {
+	if t.Coordinates != nil {
+		return t.Coordinates.Point(), true
+	}
+	if t.Place != nil {
+		return t.Place.Centroid()
+	}
+	return Point{}, false
+}
+
+// GeoFilter returns a filter that delivers tweets located in one of the
+// regions. A tweet with exact coordinates is delivered if a region contains
+// the coordinates. Other tweets are delivered if the bounding box of the
+// tweet's place intersects a region. Tweets without a location are
+// rejected. Notices are delivered.
+//
+// The locations parameter of the filter endpoint delivers tweets with
+// coordinates or a place in the boxes. Use GeoFilter to discard the tweets
+// that Twitter matched by a large place overlapping the edge of a box or to
+// match regions that are not boxes.
+//
+// The filter decodes only the location fields of the line. For v2 tweets,
+// request the geo tweet field and the geo.place_id expansion with the geo
+// place field.
+func GeoFilter(regions ...Region) Filter {
+	return func(p []byte) bool {
+		if isNotice(p) {
+			return true
+		}
+		pt, box, ok := messageLocation(p)
+		if !ok {
+			return false
+		}
+		for _, r := range regions {
+			if box == nil && r.Contains(pt) || box != nil && r.Intersects(*box) {
+				return true
+			}
+		}
+		return false
+	}
+}
+
+// messageLocation returns the coordinates or place bounding box of the tweet
+// in a v1.1 or v2 message. The box is nil if the tweet has coordinates.
+func messageLocation(p []byte) (Point, *BoundingBox, bool) {
+	if v, ok := objectField(p, "data"); ok {
+		return messageLocationV2(p, v)
+	}
+	if v, ok := objectField(p, "coordinates"); ok {
+		var c *Coordinates
+		if json.Unmarshal(v, &c) == nil && c != nil {
+			return c.Point(), nil, true
+		}
+	}
+	if v, ok := objectField(p, "place"); ok {
+		var place *struct {
+			BoundingBox *Polygon `json:"bounding_box"`
+		}
+		if json.Unmarshal(v, &place) == nil && place != nil && place.BoundingBox != nil {
+			if b, ok := place.BoundingBox.Bounds(); ok {
+				return Point{}, &b, true
+			}
+		}
+	}
+	return Point{}, nil, false
+}
+
+func messageLocationV2(p, data []byte) (Point, *BoundingBox, bool) {
+	if v, ok := objectField(data, "geo"); ok {
+		var geo struct {
+			Coordinates *Coordinates `json:"coordinates"`
+		}
+		if json.Unmarshal(v, &geo) == nil && geo.Coordinates != nil {
+			return geo.Coordinates.Point(), nil, true
+		}
+	}
+	if v, ok := objectField(p, "includes"); ok {
+		if v, ok := objectField(v, "places"); ok {
+			var places []PlaceV2
+			if json.Unmarshal(v, &places) == nil {
+				for _, pl := range places {
+					if pl.Geo != nil && len(pl.Geo.BBox) == 4 {
+						bb := pl.Geo.BBox
+						return Point{}, &BoundingBox{West: bb[0], South: bb[1], East: bb[2], North: bb[3]}, true
+					}
+				}
+			}
+		}
+	}
+	return Point{}, nil, false
+}
@@ -0,0 +1,101 @@
+// Copyright 2010 Gary Burd
+//
+// Licensed under the Apache License, Version 2.0 (the "License"): you may
+// not use this file except in compliance with the License. You may obtain
+// a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+// WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the
+// License for the specific language governing permissions and limitations
+// under the License.
+
+package twitterstream
+
+import (
+	"iter"
+)
+
+// StreamReader is the interface for reading lines from a stream. Stream and
+// ReconnectingStream implement StreamReader.
+type StreamReader interface {
+	// Next returns the next line from the stream.
+	Next() ([]byte, error)
+
+	// UnmarshalNext reads the next line from the stream and decodes the
+	// line to data.
+	UnmarshalNext(data interface{}) error
+
+	// Err returns the permanent error that stopped the stream or nil if
+	// the stream is usable.
+	Err() error
+}
+
+// All returns an iterator over the lines read from the stream. The
+// iterator yields the errors returned by Next. Iteration stops after a
+// permanent error. The lines alias the stream's buffer as described for
+// Next.
+//
+//  for line, err := range ts.All() {
+//      if err != nil {
+//          log.Print(err)
+//          continue
+//      }
+//      ...
+//  }
+func (ts *Stream) All() iter.Seq2[[]byte, error] {
+	return allLines(ts)
+}
+
+// All returns an iterator over the lines read from the stream. See
+// Stream.All for details.
+func (rs *ReconnectingStream) All() iter.Seq2[[]byte, error] {
+	return allLines(rs)
+}
+
+func allLines(r StreamReader) iter.Seq2[[]byte, error] {
+	return func(yield func([]byte, error) bool) {
+		for {
+			p, err := r.Next()
+			if !yield(p, err) {
+				return
+			}
+			if err != nil && r.Err() != nil {
+				return
+			}
+		}
+	}
+}
+
+// Next reads the next line from the stream and decodes the line to a new
+// value of type T.
+//
+//  t, err := twitterstream.Next[twitterstream.Tweet](ts)
+func Next[T any](r StreamReader) (T, error) {
+	var v T
+	err := r.UnmarshalNext(&v)
+	return v, err
+}
+
+// AllOf returns an iterator over the lines read from the stream decoded to
+// values of type T. The iterator yields decoding errors and continues.
+// Iteration stops after a permanent error.
+//
+//  for t, err := range twitterstream.AllOf[twitterstream.Tweet](ts) {
+//      ...
+//  }
+func AllOf[T any](r StreamReader) iter.Seq2[T, error] {
+	return func(yield func(T, error) bool) {
+		for {
+			v, err := Next[T](r)
+			if !yield(v, err) {
+				return
+			}
+			if err != nil && r.Err() != nil {
+				return
+			}
+		}
+	}
+}
@@ -0,0 +1,137 @@
+// Copyright 2010 Gary Burd
+//
+// Licensed under the Apache License, Version 2.0 (the "License"): you may
+// not use this file except in compliance with the License. You may obtain
+// a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+// WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the
+// License for the specific language governing permissions and limitations
+// under the License.
+
+// Package kafkasink publishes the messages read from a twitterstream stream
+// to a Kafka topic.
+//
+// The brokers, topic, partitioning and retries are configured on the
+// kafka.Writer. Use a hashing balancer to send the messages with the same
+// key to the same partition:
+//
+//  w := &kafka.Writer{
+//      Addr:        kafka.TCP("localhost:9092"),
+//      Topic:       "tweets",
+//      Balancer:    &kafka.Hash{},
+//      MaxAttempts: 5,
+//  }
+//  s := &kafkasink.Sink{
+//      Writer:  w,
+//      OnError: func(m twitterstream.Message, err error) { log.Print(err) },
+//  }
+//  err := s.Run(ctx, ts.Messages(1000))
+//
+// This repository does not have module files. Add the package's
+// dependency to the application's module to select its version:
+//
+//  go get github.com/segmentio/kafka-go
+package kafkasink
+
+import (
+	"context"
+	"errors"
+	"github.com/garyburd/twitterstream"
+	"github.com/segmentio/kafka-go"
+	"io"
+)
+
+// KindHeader is the header set to the kind of the message, for example
+// "tweet" or "delete".
+const KindHeader = "twitterstream-kind"
+
+// Sink publishes messages to Kafka. The fields must not be changed after the
+// first message is published.
+type Sink struct {
+	// Writer is the Kafka writer. The writer retries failed writes up to
+	// the writer's MaxAttempts.
+	Writer *kafka.Writer
+
+	// Key returns the key of a message. If nil, then twitterstream.TweetKey
+	// is used. Use twitterstream.UserKey to partition by user.
+	Key func(m twitterstream.Message) string
+
+	// BatchSize is the maximum number of messages written with one call to
+	// the writer. If zero, then 100 is used.
+	BatchSize int
+
+	// OnError is called with each message that could not be delivered
+	// after the writer's retries. See twitterstream.Settle.
+	OnError func(m twitterstream.Message, err error)
+}
+
+func (s *Sink) message(m twitterstream.Message) kafka.Message {
+	key := s.Key
+	if key == nil {
+		key = twitterstream.TweetKey
+	}
+	km := kafka.Message{
+		Value:   m.Raw,
+		Time:    m.Received,
+		Headers: []kafka.Header{{Key: KindHeader, Value: []byte(m.Kind.String())}},
+	}
+	if k := key(m); k != "" {
+		km.Key = []byte(k)
+	}
+	return km
+}
+
+// publish writes a batch of messages. Delivered messages and messages passed
+// to OnError are acknowledged and released.
+func (s *Sink) publish(ctx context.Context, batch []twitterstream.Message) error {
+	kms := make([]kafka.Message, len(batch))
+	for i, m := range batch {
+		kms[i] = s.message(m)
+	}
+	err := s.Writer.WriteMessages(ctx, kms...)
+	if err != nil && ctx.Err() != nil {
+		return ctx.Err()
+	}
+	var werrs kafka.WriteErrors
+	errors.As(err, &werrs)
+	for i, m := range batch {
+		merr := err
+		if werrs != nil {
+			merr = werrs[i]
+		}
+		if err := twitterstream.Settle(m, merr, s.OnError); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Publish publishes a single message.
+func (s *Sink) Publish(ctx context.Context, m twitterstream.Message) error {
+	return s.publish(ctx, []twitterstream.Message{m})
+}
+
+// Run publishes the messages received from the channel until the channel is
+// closed or the context is done. Run batches the messages that are waiting
+// on the channel. Messages are acknowledged after they are delivered.
+func (s *Sink) Run(ctx context.Context, messages <-chan twitterstream.Message) error {
+	n := s.BatchSize
+	if n <= 0 {
+		n = 100
+	}
+	for {
+		batch, err := twitterstream.Batch(ctx, messages, n)
+		if err == io.EOF {
+			return nil
+		} else if err != nil {
+			return err
+		}
+		if err := s.publish(ctx, batch); err != nil {
+			return err
+		}
+	}
+}
@@ -0,0 +1,131 @@
+// Copyright 2010 Gary Burd
+//
+// Licensed under the Apache License, Version 2.0 (the "License"): you may
+// not use this file except in compliance with the License. You may obtain
+// a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+// WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the
+// License for the specific language governing permissions and limitations
+// under the License.
+
+package twitterstream
+
+import (
+	"time"
+)
+
+// MessageKind is the type of a message read from the stream.
+type MessageKind int
+
+// Message kinds.
+const (
+	KindUnknown        MessageKind = iota // Not recognized.
+	KindTweet                             // A v1.1 tweet or a v2 response with data.
+	KindDelete                            // Tweet deletion notice.
+	KindLimit                             // Undelivered tweets notice.
+	KindScrubGeo                          // Location deletion notice.
+	KindDisconnect                        // Disconnect notice.
+	KindWarning                           // Stall or follows warning.
+	KindStatusWithheld                    // Withheld tweet notice.
+	KindUserWithheld                      // Withheld user notice.
+	KindFriends                           // Friends list at the start of a user stream.
+	KindEvent                             // User stream event.
+	KindControl                           // Site stream control message.
+)
+
+var kindNames = []string{
+	KindUnknown:        "unknown",
+	KindTweet:          "tweet",
+	KindDelete:         "delete",
+	KindLimit:          "limit",
+	KindScrubGeo:       "scrub_geo",
+	KindDisconnect:     "disconnect",
+	KindWarning:        "warning",
+	KindStatusWithheld: "status_withheld",
+	KindUserWithheld:   "user_withheld",
+	KindFriends:        "friends",
+	KindEvent:          "event",
+	KindControl:        "control",
+}
+
+func (k MessageKind) String() string {
+	if k < 0 || int(k) >= len(kindNames) {
+		return "unknown"
+	}
+	return kindNames[k]
+}
+
+// noticeKinds maps the first key of a notice to the notice's kind.
+var noticeKinds = map[string]MessageKind{
+	"delete":          KindDelete,
+	"limit":           KindLimit,
+	"scrub_geo":       KindScrubGeo,
+	"disconnect":      KindDisconnect,
+	"warning":         KindWarning,
+	"status_withheld": KindStatusWithheld,
+	"user_withheld":   KindUserWithheld,
+	"friends":         KindFriends,
+	"friends_str":     KindFriends,
+	"event":           KindEvent,
+	"control":         KindControl,
+}
+
+// KindOf returns the kind of the line p read from the stream. Notices are
+// recognized by the first key of the object. Tweets are recognized by the
+// id_str and user fields or, for v2 streams, by the data field.
+func KindOf(p []byte) MessageKind {
+	i := skipSpace(p, 0)
+	if i >= len(p) || p[i] != '{' {
+		return KindUnknown
+	}
+	i = skipSpace(p, i+1)
+	if i < len(p) && p[i] == '"' {
+		if end, ok := skipString(p, i); ok {
+			if k, ok := noticeKinds[string(p[i+1:end-1])]; ok {
+				return k
+			}
+		}
+	}
+	if _, ok := objectField(p, "data"); ok {
+		return KindTweet
+	}
+	if _, ok := objectField(p, "id_str"); ok {
+		if _, ok := objectField(p, "user"); ok {
+			return KindTweet
+		}
+	}
+	return KindUnknown
+}
+
+// message returns a message for line p. The message holds a copy of p in a
+// buffer from the line pool.
+func (ts *Stream) message(p []byte) Message {
+	l := newLine(p)
+	return Message{Kind: KindOf(l.Bytes), Raw: l.Bytes, Received: time.Now(), Source: ts.source, line: l}
+}
+
+// NextMessage returns the next line from the stream as a message. The
+// application owns the message's Raw field; call Release on the message to
+// return the buffer to the pool.
+func (ts *Stream) NextMessage() (Message, error) {
+	p, err := ts.Next()
+	if err != nil {
+		return Message{}, err
+	}
+	return ts.message(p), nil
+}
+
+// NextMessage returns the next line from the stream as a message. The
+// application owns the message's Raw field; call Release on the message to
+// return the buffer to the pool.
+func (rs *ReconnectingStream) NextMessage() (Message, error) {
+	ts, p, err := rs.next()
+	if err != nil {
+		return Message{}, err
+	}
+	return ts.message(p), nil
+}
@@ -0,0 +1,116 @@
+// Copyright 2010 Gary Burd
+//
+// Licensed under the Apache License, Version 2.0 (the "License"): you may
+// not use this file except in compliance with the License. You may obtain
+// a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+// WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the
+// License for the specific language governing permissions and limitations
+// under the License.
+
+package twitterstream
+
+import (
+	"strconv"
+	"strings"
+)
+
+// LazyMessage is a line read from the stream with methods for getting
+// individual fields without decoding the line. Each call scans the line
+// from the start, so decode the line when many fields are needed.
+//
+// A path names a field with JSON field names and array indices separated by
+// dots:
+//
+//  m, err := ts.NextLazy()
+//  ...
+//  if m.String("lang") == "en" {
+//      id := m.String("id_str")
+//      followers, _ := m.Int("user.followers_count")
+//      firstTag := m.String("entities.hashtags.0.text")
+//      ...
+//  }
+type LazyMessage []byte
+
+// Get returns the raw JSON value at the path. Get returns false if the field
+// does not exist.
+func (m LazyMessage) Get(path string) ([]byte, bool) {
+	return lookupPath(m, strings.Split(path, "."))
+}
+
+// Has returns true if the field at the path exists.
+func (m LazyMessage) Has(path string) bool {
+	_, ok := m.Get(path)
+	return ok
+}
+
+// String returns the string at the path or "" if the field does not exist
+// or is not a string.
+func (m LazyMessage) String(path string) string {
+	v, ok := m.Get(path)
+	if !ok {
+		return ""
+	}
+	s, _ := rawString(v)
+	return s
+}
+
+// Int returns the integer at the path. Int returns false if the field does
+// not exist or is not an integer. Integers in strings, such as the id_str
+// fields, are also converted.
+func (m LazyMessage) Int(path string) (int64, bool) {
+	v, ok := m.Get(path)
+	if !ok {
+		return 0, false
+	}
+	s := string(v)
+	if len(v) > 0 && v[0] == '"' {
+		if s, ok = rawString(v); !ok {
+			return 0, false
+		}
+	}
+	n, err := strconv.ParseInt(s, 10, 64)
+	return n, err == nil
+}
+
+// Float returns the number at the path. Float returns false if the field
+// does not exist or is not a number.
+func (m LazyMessage) Float(path string) (float64, bool) {
+	v, ok := m.Get(path)
+	if !ok {
+		return 0, false
+	}
+	f, err := strconv.ParseFloat(string(v), 64)
+	return f, err == nil
+}
+
+// Bool returns the boolean at the path or false if the field does not exist
+// or is not a boolean.
+func (m LazyMessage) Bool(path string) bool {
+	v, _ := m.Get(path)
+	return string(v) == "true"
+}
+
+// IsNotice returns true if the message is a v1.1 notice such as a delete or
+// limit notice.
+func (m LazyMessage) IsNotice() bool {
+	return isNotice(m)
+}
+
+// NextLazy reads the next line from the stream and returns the line as a
+// LazyMessage. The message is valid until the next call to a Next method.
+func (ts *Stream) NextLazy() (LazyMessage, error) {
+	p, err := ts.Next()
+	return LazyMessage(p), err
+}
+
+// NextLazy reads the next line from the stream and returns the line as a
+// LazyMessage. The message is valid until the next call to a Next method.
+func (rs *ReconnectingStream) NextLazy() (LazyMessage, error) {
+	p, err := rs.Next()
+	return LazyMessage(p), err
+}
@@ -0,0 +1,65 @@
+// Copyright 2010 Gary Burd
+//
+// Licensed under the Apache License, Version 2.0 (the "License"): you may
+// not use this file except in compliance with the License. You may obtain
+// a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+// WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the
+// License for the specific language governing permissions and limitations
+// under the License.
+
+package twitterstream
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+)
+
+// Logger is the interface used by the package to log connection events.
+// Keepalives are logged at the debug level, connections, reconnects and
+// notices from Twitter at the info level, and HTTP and connection errors at
+// the error level. Use the OpenLogger option to set the logger.
+type Logger interface {
+	Debugf(format string, args ...interface{})
+	Infof(format string, args ...interface{})
+	Errorf(format string, args ...interface{})
+}
+
+type nopLogger struct{}
+
+func (nopLogger) Debugf(format string, args ...interface{}) {}
+func (nopLogger) Infof(format string, args ...interface{})  {}
+func (nopLogger) Errorf(format string, args ...interface{}) {}
+
+// SlogLogger returns a Logger that writes to l.
+func SlogLogger(l *slog.Logger) Logger {
+	return slogLogger{l}
+}
+
+type slogLogger struct {
+	l *slog.Logger
+}
+
+func (sl slogLogger) logf(level slog.Level, format string, args []interface{}) {
+	ctx := context.Background()
+	if sl.l.Enabled(ctx, level) {
+		sl.l.Log(ctx, level, fmt.Sprintf(format, args...))
+	}
+}
+
+func (sl slogLogger) Debugf(format string, args ...interface{}) {
+	sl.logf(slog.LevelDebug, format, args)
+}
+
+func (sl slogLogger) Infof(format string, args ...interface{}) {
+	sl.logf(slog.LevelInfo, format, args)
+}
+
+func (sl slogLogger) Errorf(format string, args ...interface{}) {
+	sl.logf(slog.LevelError, format, args)
+}
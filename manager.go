@@ -0,0 +1,187 @@
+// Copyright 2010 Gary Burd
+//
+// Licensed under the Apache License, Version 2.0 (the "License"): you may
+// not use this file except in compliance with the License. You may obtain
+// a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+// WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the
+// License for the specific language governing permissions and limitations
+// under the License.
+
+package twitterstream
+
+import (
+	"encoding/json"
+	"github.com/garyburd/go-oauth/oauth"
+	"net/url"
+	"sync"
+	"time"
+)
+
+// Manager maintains a reconnecting stream for each of several accounts and
+// merges the messages from the streams into one channel. The Source field of
+// each message is the name of the account that owns the stream.
+//
+//  m := twitterstream.NewManager(client, twitterstream.UserStreamURL, params)
+//  defer m.Close()
+//  m.Add("alice", aliceCred)
+//  m.Add("bob", bobCred)
+//  for msg := range m.Messages() {
+//      process(msg.Source, msg.Raw)
+//  }
+type Manager struct {
+	oauthClient *oauth.Client
+	urlStr      string
+	params      url.Values
+	options     []OpenOption
+
+	messages chan Message
+	wg       sync.WaitGroup
+
+	mu       sync.Mutex
+	accounts map[string]*managedStream
+	errs     map[string]error
+	closed   bool
+}
+
+type managedStream struct {
+	rs   *ReconnectingStream
+	done chan struct{}
+}
+
+// NewManager returns a manager for streams with the given endpoint,
+// parameters and options. The arguments have the same meaning as the
+// arguments to Open.
+func NewManager(oauthClient *oauth.Client, urlStr string, params url.Values, options ...OpenOption) *Manager {
+	return &Manager{
+		oauthClient: oauthClient,
+		urlStr:      urlStr,
+		params:      params,
+		options:     options,
+		messages:    make(chan Message),
+		accounts:    make(map[string]*managedStream),
+		errs:        make(map[string]error),
+	}
+}
+
+// Add starts a stream for the named account. If the account already has a
+// stream, then the stream is replaced.
+func (m *Manager) Add(name string, accessToken *oauth.Credentials) {
+	ms := &managedStream{
+		rs:   NewReconnectingStream(m.oauthClient, accessToken, m.urlStr, m.params, m.options...),
+		done: make(chan struct{}),
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.closed {
+		ms.rs.Close()
+		return
+	}
+	if old := m.accounts[name]; old != nil {
+		old.close()
+	}
+	m.accounts[name] = ms
+	delete(m.errs, name)
+	m.wg.Add(1)
+	go m.run(name, ms)
+}
+
+func (m *Manager) run(name string, ms *managedStream) {
+	defer m.wg.Done()
+	for {
+		p, err := ms.rs.Next()
+		if err != nil {
+			if err := ms.rs.Err(); err != nil {
+				m.mu.Lock()
+				if m.accounts[name] == ms {
+					delete(m.accounts, name)
+					if err != ErrStreamClosed {
+						m.errs[name] = err
+					}
+				}
+				m.mu.Unlock()
+				return
+			}
+			continue
+		}
+		msg := Message{Kind: KindOf(p), Raw: append(json.RawMessage(nil), p...), Received: time.Now(), Source: name}
+		select {
+		case m.messages <- msg:
+		case <-ms.done:
+			return
+		}
+	}
+}
+
+func (ms *managedStream) close() {
+	close(ms.done)
+	ms.rs.Close()
+}
+
+// Remove stops the stream for the named account.
+func (m *Manager) Remove(name string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if ms := m.accounts[name]; ms != nil {
+		ms.close()
+		delete(m.accounts, name)
+	}
+}
+
+// Accounts returns the names of the accounts with running streams.
+func (m *Manager) Accounts() []string {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	names := make([]string, 0, len(m.accounts))
+	for name := range m.accounts {
+		names = append(names, name)
+	}
+	return names
+}
+
+// Err returns the permanent error that stopped the stream for the named
+// account, or nil if the stream is running or was removed.
+func (m *Manager) Err(name string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.errs[name]
+}
+
+// Stream returns the stream for the named account or nil if the account does
+// not have a running stream.
+func (m *Manager) Stream(name string) *ReconnectingStream {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if ms := m.accounts[name]; ms != nil {
+		return ms.rs
+	}
+	return nil
+}
+
+// Messages returns the channel of messages from all of the streams. The
+// channel is closed by Close.
+func (m *Manager) Messages() <-chan Message {
+	return m.messages
+}
+
+// Close stops all of the streams and closes the messages channel.
+func (m *Manager) Close() error {
+	m.mu.Lock()
+	if m.closed {
+		m.mu.Unlock()
+		return nil
+	}
+	m.closed = true
+	for name, ms := range m.accounts {
+		ms.close()
+		delete(m.accounts, name)
+	}
+	m.mu.Unlock()
+	m.wg.Wait()
+	close(m.messages)
+	return nil
+}
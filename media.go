@@ -0,0 +1,205 @@
+// Copyright 2010 Gary Burd
+//
+// Licensed under the Apache License, Version 2.0 (the "License"): you may
+// not use this file except in compliance with the License. You may obtain
+// a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+// WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the
+// License for the specific language governing permissions and limitations
+// under the License.
+
+package twitterstream
+
+import (
+	"context"
+	"errors"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+// MediaDownloader downloads the photos, videos and animated GIFs attached to
+// tweets. The downloader limits the rate of requests and retries temporary
+// failures. The fields must not be changed after the first download.
+//
+//  d := &twitterstream.MediaDownloader{Interval: 100 * time.Millisecond}
+//  names, err := d.DownloadTweet(ctx, &t, "media")
+type MediaDownloader struct {
+	// HTTPClient is the client used for requests. If nil, then
+	// http.DefaultClient is used.
+	HTTPClient *http.Client
+
+	// Interval is the minimum time between the start of requests.
+	Interval time.Duration
+
+	// Retries is the number of times a request is retried after a network
+	// error or a temporary HTTP error. If zero, then requests are retried
+	// three times. Use a negative value to disable retries.
+	Retries int
+
+	mu   sync.Mutex
+	next time.Time
+}
+
+// MediaURL returns the URL of the best version of the media. For video and
+// animated GIFs, the URL is the MP4 variant with the highest bitrate. For
+// photos, the URL is the media URL.
+func (m *MediaEntity) MediaURL() string {
+	if m.VideoInfo == nil {
+		return m.MediaURLHTTPS
+	}
+	var best *VideoVariant
+	for i := range m.VideoInfo.Variants {
+		v := &m.VideoInfo.Variants[i]
+		if v.ContentType != "video/mp4" {
+			continue
+		}
+		if best == nil || v.Bitrate > best.Bitrate {
+			best = v
+		}
+	}
+	if best == nil {
+		return m.MediaURLHTTPS
+	}
+	return best.URL
+}
+
+// wait blocks until the next request is allowed by the interval.
+func (d *MediaDownloader) wait(ctx context.Context) error {
+	d.mu.Lock()
+	now := time.Now()
+	t := d.next
+	if t.Before(now) {
+		t = now
+	}
+	d.next = t.Add(d.Interval)
+	d.mu.Unlock()
+	if delay := time.Until(t); delay > 0 {
+		timer := time.NewTimer(delay)
+		defer timer.Stop()
+		select {
+		case <-timer.C:
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+	return nil
+}
+
+// get returns the response for a successful request to urlStr. Network
+// errors and temporary HTTP errors are retried.
+func (d *MediaDownloader) get(ctx context.Context, urlStr string) (*http.Response, error) {
+	client := d.HTTPClient
+	if client == nil {
+		client = http.DefaultClient
+	}
+	retries := d.Retries
+	if retries == 0 {
+		retries = 3
+	}
+	var b backoff
+	for attempt := 0; ; attempt++ {
+		if err := d.wait(ctx); err != nil {
+			return nil, err
+		}
+		req, err := http.NewRequestWithContext(ctx, "GET", urlStr, nil)
+		if err != nil {
+			return nil, err
+		}
+		resp, err := client.Do(req)
+		if err == nil {
+			if resp.StatusCode == 200 {
+				return resp, nil
+			}
+			p, _ := ioutil.ReadAll(io.LimitReader(resp.Body, 4096))
+			resp.Body.Close()
+			err = newHTTPStatusError(resp, p)
+		}
+		if attempt >= retries || !IsTemporary(err) {
+			return nil, err
+		}
+		timer := time.NewTimer(b.next(err))
+		select {
+		case <-timer.C:
+		case <-ctx.Done():
+			timer.Stop()
+			return nil, ctx.Err()
+		}
+	}
+}
+
+// Download writes the best version of the media to w. Failures are not
+// retried after data is written to w.
+func (d *MediaDownloader) Download(ctx context.Context, m *MediaEntity, w io.Writer) error {
+	urlStr := m.MediaURL()
+	if urlStr == "" {
+		return errors.New("twitterstream: media does not have a URL")
+	}
+	resp, err := d.get(ctx, urlStr)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	_, err = io.Copy(w, resp.Body)
+	return err
+}
+
+// DownloadFile downloads the best version of the media to a file in dir and
+// returns the path of the file. The file name is the base name of the media
+// URL. An existing file is not downloaded again.
+func (d *MediaDownloader) DownloadFile(ctx context.Context, m *MediaEntity, dir string) (string, error) {
+	u, err := url.Parse(m.MediaURL())
+	if err != nil {
+		return "", err
+	}
+	name := path.Base(u.Path)
+	if name == "/" || name == "." {
+		return "", errors.New("twitterstream: media does not have a URL")
+	}
+	name = filepath.Join(dir, name)
+	if _, err := os.Stat(name); err == nil {
+		return name, nil
+	}
+	f, err := ioutil.TempFile(dir, ".media")
+	if err != nil {
+		return "", err
+	}
+	err = d.Download(ctx, m, f)
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	if err == nil {
+		err = os.Rename(f.Name(), name)
+	}
+	if err != nil {
+		os.Remove(f.Name())
+		return "", err
+	}
+	return name, nil
+}
+
+// DownloadTweet downloads the media attached to the tweet to files in dir
+// and returns the paths of the files. The media are the media returned by
+// Tweet.Media.
+func (d *MediaDownloader) DownloadTweet(ctx context.Context, t *Tweet, dir string) ([]string, error) {
+	var names []string
+	media := t.Media()
+	for i := range media {
+		name, err := d.DownloadFile(ctx, &media[i], dir)
+		if err != nil {
+			return names, err
+		}
+		names = append(names, name)
+	}
+	return names, nil
+}
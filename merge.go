@@ -0,0 +1,98 @@
+// Copyright 2010 Gary Burd
+//
+// Licensed under the Apache License, Version 2.0 (the "License"): you may
+// not use this file except in compliance with the License. You may obtain
+// a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+// WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the
+// License for the specific language governing permissions and limitations
+// under the License.
+
+package twitterstream
+
+import (
+	"strconv"
+	"sync"
+)
+
+// mergeDepth is the queue depth of the streams started by Merge.
+const mergeDepth = 100
+
+// MergedStream interleaves the messages from several streams.
+type MergedStream struct {
+	streams []*Stream
+	c       chan Message
+	done    chan struct{}
+	once    sync.Once
+}
+
+// Merge interleaves the messages from several streams into one channel. The
+// Source field of each message is the label specified with the OpenSource
+// option, or the index of the stream in the arguments if the stream does not
+// have a label. Merge calls Messages on each stream. The merged channel is
+// closed after the channels of all of the streams are closed or when the
+// merged stream is closed.
+//
+//  a, err := twitterstream.OpenFilter(ctx, client, cred, golangParams, twitterstream.OpenSource("golang"))
+//  b, err := twitterstream.OpenFilter(ctx, client, cred, rustParams, twitterstream.OpenSource("rust"))
+//  ms := twitterstream.Merge(a, b)
+//  defer ms.Close()
+//  for m := range ms.C() {
+//      process(m.Source, m.Raw)
+//  }
+func Merge(streams ...*Stream) *MergedStream {
+	ms := &MergedStream{
+		streams: streams,
+		c:       make(chan Message),
+		done:    make(chan struct{}),
+	}
+	var wg sync.WaitGroup
+	wg.Add(len(streams))
+	for i, ts := range streams {
+		label := ts.source
+		if label == "" {
+			label = strconv.Itoa(i)
+		}
+		go func(c <-chan Message, label string) {
+			defer wg.Done()
+			for m := range c {
+				m.Source = label
+				select {
+				case ms.c <- m:
+				case <-ms.done:
+					m.Release()
+					return
+				}
+			}
+		}(ts.Messages(mergeDepth), label)
+	}
+	go func() {
+		wg.Wait()
+		close(ms.c)
+	}()
+	return ms
+}
+
+// C returns the merged channel.
+func (ms *MergedStream) C() <-chan Message {
+	return ms.c
+}
+
+// Close stops the merge and closes the streams. Close returns the first error
+// returned from closing the streams.
+func (ms *MergedStream) Close() error {
+	var err error
+	ms.once.Do(func() {
+		close(ms.done)
+		for _, ts := range ms.streams {
+			if e := ts.Close(); e != nil && err == nil {
+				err = e
+			}
+		}
+	})
+	return err
+}
@@ -0,0 +1,66 @@
+// Copyright 2010 Gary Burd
+//
+// Licensed under the Apache License, Version 2.0 (the "License"): you may
+// not use this file except in compliance with the License. You may obtain
+// a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+// WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the
+// License for the specific language governing permissions and limitations
+// under the License.
+
+package twitterstream
+
+import (
+	"runtime"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestMerge(t *testing.T) {
+	a := newTestStream(strings.NewReader("a1\r\na2\r\n"))
+	a.source = "a"
+	b := newTestStream(strings.NewReader("b1\r\n"))
+	ms := Merge(a, b)
+	defer ms.Close()
+	got := make(map[string]int)
+	for m := range ms.C() {
+		got[m.Source+":"+string(m.Raw)]++
+	}
+	want := map[string]int{"a:a1": 1, "a:a2": 1, "1:b1": 1}
+	if len(got) != len(want) {
+		t.Fatalf("got %v, want %v", got, want)
+	}
+	for k, n := range want {
+		if got[k] != n {
+			t.Fatalf("got %v, want %v", got, want)
+		}
+	}
+}
+
+func TestMergeCloseWithoutReading(t *testing.T) {
+	n := runtime.NumGoroutine()
+	a := newTestStream(&repeatReader{line: []byte(benchmarkLine)})
+	b := newTestStream(&repeatReader{line: []byte(benchmarkLine)})
+	ms := Merge(a, b)
+	<-ms.C()
+	ms.Close()
+	timeout := time.After(5 * time.Second)
+	for range ms.C() {
+		select {
+		case <-timeout:
+			t.Fatal("merged channel not closed")
+		default:
+		}
+	}
+	for i := 0; runtime.NumGoroutine() > n; i++ {
+		if i == 100 {
+			t.Fatalf("%d goroutines running after Close, want %d", runtime.NumGoroutine(), n)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
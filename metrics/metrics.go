@@ -0,0 +1,95 @@
+// Copyright 2010 Gary Burd
+//
+// Licensed under the Apache License, Version 2.0 (the "License"): you may
+// not use this file except in compliance with the License. You may obtain
+// a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+// WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the
+// License for the specific language governing permissions and limitations
+// under the License.
+
+// Package metrics reports the statistics of a twitterstream stream to a
+// metrics sink such as StatsD or Datadog.
+//
+//  sink, err := metrics.DialStatsD("127.0.0.1:8125", "ingest.", "stream:filter")
+//  if err != nil {
+//      log.Fatal(err)
+//  }
+//  go metrics.Report(ctx, ts, sink, 10*time.Second)
+package metrics
+
+import (
+	"context"
+	"github.com/garyburd/twitterstream"
+	"time"
+)
+
+// Sink receives metrics.
+type Sink interface {
+	// Count adds delta to the counter with the given name.
+	Count(name string, delta int64)
+
+	// Gauge sets the gauge with the given name to value.
+	Gauge(name string, value float64)
+}
+
+// Source is the interface implemented by twitterstream.Stream and
+// twitterstream.ReconnectingStream.
+type Source interface {
+	Stats() twitterstream.Stats
+}
+
+// Metric names.
+const (
+	MessagesName     = "twitterstream.messages"
+	BytesName        = "twitterstream.bytes"
+	ReconnectsName   = "twitterstream.reconnects"
+	DroppedName      = "twitterstream.dropped_tweets"
+	DecodeErrorsName = "twitterstream.decode_errors"
+	UptimeName       = "twitterstream.connection_uptime_seconds"
+	IdleName         = "twitterstream.seconds_since_last_message"
+)
+
+// Report sends the source's Stats to the sink every interval until the
+// context is done. Counters are sent as the change since the previous report.
+func Report(ctx context.Context, source Source, sink Sink, interval time.Duration) {
+	t := time.NewTicker(interval)
+	defer t.Stop()
+	var prev twitterstream.Stats
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-t.C:
+		}
+		s := source.Stats()
+		report(sink, prev, s)
+		prev = s
+	}
+}
+
+func report(sink Sink, prev, s twitterstream.Stats) {
+	count := func(name string, prev, cur int64) {
+		if cur > prev {
+			sink.Count(name, cur-prev)
+		}
+	}
+	count(MessagesName, prev.Messages, s.Messages)
+	count(BytesName, prev.Bytes, s.Bytes)
+	count(ReconnectsName, prev.Reconnects, s.Reconnects)
+	count(DroppedName, prev.Dropped, s.Dropped)
+	count(DecodeErrorsName, prev.DecodeErrors, s.DecodeErrors)
+
+	var uptime float64
+	if !s.ConnectedSince.IsZero() {
+		uptime = time.Since(s.ConnectedSince).Seconds()
+	}
+	sink.Gauge(UptimeName, uptime)
+	if !s.LastMessage.IsZero() {
+		sink.Gauge(IdleName, time.Since(s.LastMessage).Seconds())
+	}
+}
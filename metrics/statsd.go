@@ -0,0 +1,63 @@
+// Copyright 2010 Gary Burd
+//
+// Licensed under the Apache License, Version 2.0 (the "License"): you may
+// not use this file except in compliance with the License. You may obtain
+// a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+// WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the
+// License for the specific language governing permissions and limitations
+// under the License.
+
+package metrics
+
+import (
+	"net"
+	"strconv"
+	"strings"
+)
+
+// StatsD is a Sink that sends metrics to a StatsD server over UDP. Errors
+// sending metrics are ignored.
+type StatsD struct {
+	conn   net.Conn
+	prefix string
+	tags   string
+}
+
+// DialStatsD returns a sink for the StatsD server at addr. The metric names
+// are prefixed with prefix. If tags are specified, then the tags are added to
+// each metric using the Datadog extension to the StatsD protocol.
+func DialStatsD(addr string, prefix string, tags ...string) (*StatsD, error) {
+	conn, err := net.Dial("udp", addr)
+	if err != nil {
+		return nil, err
+	}
+	s := &StatsD{conn: conn, prefix: prefix}
+	if len(tags) > 0 {
+		s.tags = "|#" + strings.Join(tags, ",")
+	}
+	return s, nil
+}
+
+func (s *StatsD) send(name, value, kind string) {
+	s.conn.Write([]byte(s.prefix + name + ":" + value + "|" + kind + s.tags))
+}
+
+// Count implements the Sink interface.
+func (s *StatsD) Count(name string, delta int64) {
+	s.send(name, strconv.FormatInt(delta, 10), "c")
+}
+
+// Gauge implements the Sink interface.
+func (s *StatsD) Gauge(name string, value float64) {
+	s.send(name, strconv.FormatFloat(value, 'f', -1, 64), "g")
+}
+
+// Close closes the connection to the server.
+func (s *StatsD) Close() error {
+	return s.conn.Close()
+}
@@ -0,0 +1,150 @@
+// Copyright 2010 Gary Burd
+//
+// Licensed under the Apache License, Version 2.0 (the "License"): you may
+// not use this file except in compliance with the License. You may obtain
+// a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+// WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the
+// License for the specific language governing permissions and limitations
+// under the License.
+
+// Package natssink publishes the messages read from a twitterstream stream
+// to NATS subjects.
+//
+// The subject is a template. The sink replaces {kind} in the template with
+// the kind of the message and {source} with the source of the message. Use
+// the kind to route tweets and deletes to different subjects:
+//
+//  nc, err := nats.Connect(nats.DefaultURL)
+//  s := &natssink.Sink{Conn: nc, Subject: "twitter.{kind}"}
+//  err = s.Run(ctx, ts.Messages(1000))
+//
+// Set JetStream to publish to a stream with acknowledgements. The tweet ID
+// is sent as the message ID so that JetStream discards duplicates.
+//
+//  js, err := nc.JetStream()
+//  s := &natssink.Sink{JetStream: js, Subject: "twitter.{kind}"}
+//
+// This repository does not have module files. Add the package's
+// dependency to the application's module to select its version:
+//
+//  go get github.com/nats-io/nats.go
+package natssink
+
+import (
+	"context"
+	"errors"
+	"github.com/garyburd/twitterstream"
+	"github.com/nats-io/nats.go"
+	"io"
+	"strings"
+)
+
+// Sink publishes messages to NATS. The fields must not be changed after the
+// first message is published.
+type Sink struct {
+	// Conn is the connection for publishing with core NATS.
+	Conn *nats.Conn
+
+	// JetStream is the context for publishing to JetStream. If set, then
+	// each message is published with an acknowledgement and Conn is not
+	// used.
+	JetStream nats.JetStreamContext
+
+	// Subject is the subject template. See the package documentation for
+	// the replacements.
+	Subject string
+
+	// OnError is called with each message that could not be published.
+	// See twitterstream.Settle.
+	OnError func(m twitterstream.Message, err error)
+}
+
+var errNoConn = errors.New("natssink: Conn or JetStream not set")
+
+// subject returns the subject for message m.
+func (s *Sink) subject(m twitterstream.Message) string {
+	if !strings.Contains(s.Subject, "{") {
+		return s.Subject
+	}
+	return strings.NewReplacer("{kind}", m.Kind.String(), "{source}", m.Source).Replace(s.Subject)
+}
+
+// publish publishes m. Messages published with core NATS are delivered to
+// the server by the next flush.
+func (s *Sink) publish(ctx context.Context, m twitterstream.Message) error {
+	msg := nats.NewMsg(s.subject(m))
+	msg.Data = m.Raw
+	switch {
+	case s.JetStream != nil:
+		if id := twitterstream.TweetKey(m); id != "" {
+			msg.Header.Set(nats.MsgIdHdr, id)
+		}
+		_, err := s.JetStream.PublishMsg(msg, nats.Context(ctx))
+		return err
+	case s.Conn != nil:
+		return s.Conn.PublishMsg(msg)
+	}
+	return errNoConn
+}
+
+// Publish publishes a single message and waits for the server to receive the
+// message.
+func (s *Sink) Publish(ctx context.Context, m twitterstream.Message) error {
+	err := s.publish(ctx, m)
+	if err == nil && s.JetStream == nil {
+		err = s.Conn.FlushWithContext(ctx)
+	}
+	return err
+}
+
+// batchSize is the maximum number of messages published between flushes of
+// the connection.
+const batchSize = 1000
+
+// Run publishes the messages received from the channel until the channel is
+// closed or the context is done. Messages published with JetStream are
+// acknowledged after JetStream acknowledges the message. Messages published
+// with core NATS are acknowledged after the connection is flushed; Run
+// flushes the connection when no message is waiting on the channel.
+func (s *Sink) Run(ctx context.Context, messages <-chan twitterstream.Message) error {
+	var pending []twitterstream.Message
+	for {
+		batch, err := twitterstream.Batch(ctx, messages, batchSize)
+		if err == io.EOF {
+			return nil
+		} else if err != nil {
+			return err
+		}
+		pending = pending[:0]
+		for _, m := range batch {
+			err := s.publish(ctx, m)
+			if ctx.Err() != nil {
+				return ctx.Err()
+			}
+			if err != nil || s.JetStream != nil {
+				if err := twitterstream.Settle(m, err, s.OnError); err != nil {
+					return err
+				}
+				continue
+			}
+			pending = append(pending, m)
+		}
+		if len(pending) == 0 {
+			continue
+		}
+		err = s.Conn.FlushWithContext(ctx)
+		if err != nil && ctx.Err() != nil {
+			return ctx.Err()
+		}
+		for _, m := range pending {
+			if err := twitterstream.Settle(m, err, s.OnError); err != nil {
+				return err
+			}
+		}
+	}
+}
@@ -0,0 +1,156 @@
+// Copyright 2010 Gary Burd
+//
+// Licensed under the Apache License, Version 2.0 (the "License"): you may
+// not use this file except in compliance with the License. You may obtain
+// a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+// WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the
+// License for the specific language governing permissions and limitations
+// under the License.
+
+// Package nsqsink publishes the messages read from a twitterstream stream to
+// an NSQ topic.
+//
+//  p, err := nsq.NewProducer("127.0.0.1:4150", nsq.NewConfig())
+//  s := &nsqsink.Sink{Producer: p, Topic: "tweets"}
+//  err = s.Run(ctx, ts.Messages(1000))
+//
+// The sink publishes batches of messages asynchronously and limits the
+// number of batches waiting for a response from nsqd. When the limit is
+// reached, the sink stops reading the channel and the messages are held in
+// the stream's queue until nsqd catches up. The stream's overflow policy
+// applies if the queue fills.
+//
+// This repository does not have module files. Add the package's
+// dependency to the application's module to select its version:
+//
+//  go get github.com/nsqio/go-nsq
+package nsqsink
+
+import (
+	"context"
+	"github.com/garyburd/twitterstream"
+	"github.com/nsqio/go-nsq"
+	"io"
+)
+
+// Sink publishes messages to NSQ. The fields must not be changed after the
+// first message is published.
+type Sink struct {
+	// Producer is the connection to nsqd.
+	Producer *nsq.Producer
+
+	// Topic is the topic for the messages.
+	Topic string
+
+	// BatchSize is the maximum number of messages in one publish command.
+	// If zero, then 100 is used.
+	BatchSize int
+
+	// MaxInFlight is the maximum number of batches waiting for a response
+	// from nsqd. If zero, then 4 is used.
+	MaxInFlight int
+
+	// OnError is called with each message that could not be published.
+	// See twitterstream.Settle.
+	OnError func(m twitterstream.Message, err error)
+}
+
+// Publish publishes a single message and waits for the response from nsqd.
+func (s *Sink) Publish(m twitterstream.Message) error {
+	return twitterstream.Settle(m, s.Producer.Publish(s.Topic, m.Raw), s.OnError)
+}
+
+// Run publishes the messages received from the channel until the channel is
+// closed or the context is done. Messages are acknowledged after nsqd
+// accepts the batch containing the message. When the channel is closed, Run
+// waits for the responses to the batches in flight.
+func (s *Sink) Run(ctx context.Context, messages <-chan twitterstream.Message) error {
+	n := s.BatchSize
+	if n <= 0 {
+		n = 100
+	}
+	maxInFlight := s.MaxInFlight
+	if maxInFlight <= 0 {
+		maxInFlight = 4
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	// A slot in inFlight is held for each batch waiting for a response. The
+	// goroutine handles the responses and releases the slots. The first
+	// error is sent to errc before the goroutine cancels ctx.
+	inFlight := make(chan struct{}, maxInFlight)
+	done := make(chan *nsq.ProducerTransaction, maxInFlight)
+	errc := make(chan error, 1)
+	stop := make(chan struct{})
+	defer close(stop)
+	go func() {
+		failed := false
+		for {
+			select {
+			case t := <-done:
+				for _, m := range t.Args[0].([]twitterstream.Message) {
+					if failed {
+						break
+					}
+					if err := twitterstream.Settle(m, t.Error, s.OnError); err != nil {
+						failed = true
+						errc <- err
+						cancel()
+					}
+				}
+				<-inFlight
+			case <-stop:
+				return
+			}
+		}
+	}()
+
+	result := func(err error) error {
+		select {
+		case err := <-errc:
+			return err
+		default:
+			return err
+		}
+	}
+
+	for {
+		batch, err := twitterstream.Batch(ctx, messages, n)
+		if err == io.EOF {
+			for i := 0; i < maxInFlight; i++ {
+				select {
+				case inFlight <- struct{}{}:
+				case <-ctx.Done():
+					return result(ctx.Err())
+				}
+			}
+			return result(nil)
+		} else if err != nil {
+			return result(err)
+		}
+		select {
+		case inFlight <- struct{}{}:
+		case <-ctx.Done():
+			return result(ctx.Err())
+		}
+		bodies := make([][]byte, len(batch))
+		for i, m := range batch {
+			bodies[i] = m.Raw
+		}
+		if err := s.Producer.MultiPublishAsync(s.Topic, bodies, done, batch); err != nil {
+			<-inFlight
+			for _, m := range batch {
+				if err := twitterstream.Settle(m, err, s.OnError); err != nil {
+					return err
+				}
+			}
+		}
+	}
+}
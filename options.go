@@ -0,0 +1,404 @@
+// Copyright 2010 Gary Burd
+//
+// Licensed under the Apache License, Version 2.0 (the "License"): you may
+// not use this file except in compliance with the License. You may obtain
+// a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+// WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the
+// License for the specific language governing permissions and limitations
+// under the License.
+
+package twitterstream
+
+import (
+	"crypto/tls"
+	"io"
+	"net/http"
+	"net/http/httptrace"
+	"net/url"
+	"time"
+)
+
+// OpenOption specifies an option for opening a stream.
+type OpenOption struct {
+	f func(*openOptions)
+}
+
+type openOptions struct {
+	connectTimeout time.Duration
+	readTimeout    time.Duration
+	bufferSize     int
+	maxMessageSize int
+	userAgent      string
+	method         string
+	httpClient     *http.Client
+	compression    bool
+	stallWarnings  bool
+	onWarning      func(*Warning)
+	onDelete       func(*Delete)
+	onLimit        func(*Limit)
+	onKeepalive    func(time.Time)
+	backfill       bool
+	proxyURL       *url.URL
+	tlsConfig      *tls.Config
+	pinnedKeys     []string
+	logger         Logger
+	debugWriter    io.Writer
+	tee            io.Writer
+	clientTrace    *httptrace.ClientTrace
+	onReconnect    func(gap time.Duration)
+	checkpoint     *checkpoint
+	deduper        Deduper
+	overflow       OverflowPolicy
+	queueBytes     int64
+	spillDir       string
+	atLeastOnce    bool
+	source         string
+	useNumber      bool
+	decoder        Decoder
+	filter         Filter
+}
+
+func newOpenOptions(options []OpenOption) *openOptions {
+	do := &openOptions{
+		connectTimeout: 60 * time.Second,
+		readTimeout:    90 * time.Second,
+		bufferSize:     8192,
+		maxMessageSize: 1 << 20,
+		compression:    true,
+		logger:         nopLogger{},
+	}
+	for _, option := range options {
+		option.f(do)
+	}
+	return do
+}
+
+// OpenConnectTimeout specifies the timeout for connecting to the endpoint and
+// reading the response headers. The timeout applies to clients specified with
+// the OpenHTTPClient option. The default is 60 seconds.
+func OpenConnectTimeout(d time.Duration) OpenOption {
+	return OpenOption{func(do *openOptions) {
+		do.connectTimeout = d
+	}}
+}
+
+// OpenReadTimeout specifies the stall timeout for the stream. The stream is
+// closed with ErrStalled if no data, including keepalive lines, arrives
+// within the timeout. Twitter sends a keepalive line every 30 seconds and
+// recommends a timeout of 90 seconds. A zero timeout disables stall
+// detection. The default is 90 seconds.
+func OpenReadTimeout(d time.Duration) OpenOption {
+	return OpenOption{func(do *openOptions) {
+		do.readTimeout = d
+	}}
+}
+
+// OpenBufferSize specifies the size of the buffer used to read the stream.
+// Lines longer than the buffer are assembled in a separate buffer. Use a
+// buffer larger than the typical line to avoid copying. The default is 8192
+// bytes.
+func OpenBufferSize(n int) OpenOption {
+	return OpenOption{func(do *openOptions) {
+		do.bufferSize = n
+	}}
+}
+
+// OpenMaxMessageSize specifies the maximum length of a line. Next discards
+// a longer line and returns ErrMessageTooLarge. Use the limit to protect the
+// application from unbounded memory use. The default is 1 MiB.
+func OpenMaxMessageSize(n int) OpenOption {
+	return OpenOption{func(do *openOptions) {
+		do.maxMessageSize = n
+	}}
+}
+
+// OpenUserAgent specifies the User-Agent header sent with the request.
+func OpenUserAgent(userAgent string) OpenOption {
+	return OpenOption{func(do *openOptions) {
+		do.userAgent = userAgent
+	}}
+}
+
+// OpenMethod specifies the HTTP method used for the request. If the method is
+// "GET", the parameters are sent in the query string. Otherwise, the
+// parameters are sent in a form encoded request body. The method is also used
+// to sign the request. The default is "GET" for the sample, firehose, user,
+// site and v2 endpoints and "POST" for other endpoints.
+func OpenMethod(method string) OpenOption {
+	return OpenOption{func(do *openOptions) {
+		do.method = method
+	}}
+}
+
+// OpenHTTPClient specifies the client used to make the streaming request.
+// Use this option to configure proxies, TLS and other transport settings. The
+// client's Timeout field must be zero because the timeout includes the time
+// spent reading the response body. The default client uses a transport with
+// the connect timeout specified by OpenConnectTimeout.
+func OpenHTTPClient(client *http.Client) OpenOption {
+	return OpenOption{func(do *openOptions) {
+		do.httpClient = client
+	}}
+}
+
+// OpenCompression specifies whether the stream is requested with gzip or
+// deflate compression. Compression reduces bandwidth at the cost of CPU. The
+// default is true.
+func OpenCompression(compression bool) OpenOption {
+	return OpenOption{func(do *openOptions) {
+		do.compression = compression
+	}}
+}
+
+// OpenStallWarnings requests stall warnings from the endpoint. Twitter sends a
+// stall warning when the application falls behind reading the stream. If
+// onWarning is not nil, then the stream calls onWarning from Next with each
+// warning read from the stream. The warning line is also returned from Next.
+func OpenStallWarnings(onWarning func(*Warning)) OpenOption {
+	return OpenOption{func(do *openOptions) {
+		do.stallWarnings = true
+		do.onWarning = onWarning
+	}}
+}
+
+// OpenDeletes separates delete notices from the other messages in the stream.
+// The stream calls onDelete from Next with each delete notice read from the
+// stream. Next does not return delete notice lines to the application.
+func OpenDeletes(onDelete func(*Delete)) OpenOption {
+	return OpenOption{func(do *openOptions) {
+		do.onDelete = onDelete
+	}}
+}
+
+// OpenLimits specifies a function that the stream calls from Next with each
+// limit notice read from the stream. The limit notice line is also returned
+// from Next. Use Stream.DroppedCount to get the total number of undelivered
+// tweets.
+func OpenLimits(onLimit func(*Limit)) OpenOption {
+	return OpenOption{func(do *openOptions) {
+		do.onLimit = onLimit
+	}}
+}
+
+// OpenKeepalives specifies a function that the stream calls from Next with
+// the time that each blank keepalive line is read from the stream. Twitter
+// sends a keepalive every 30 seconds on an idle stream. Use the function to
+// implement a liveness check for a low volume stream. The function is called
+// from the goroutine started by Messages when using the channel API and
+// should not block. The time of the last keepalive is also reported by
+// Stats.
+func OpenKeepalives(onKeepalive func(t time.Time)) OpenOption {
+	return OpenOption{func(do *openOptions) {
+		do.onKeepalive = onKeepalive
+	}}
+}
+
+// OpenBackfill specifies whether a reconnecting v2 stream requests the tweets
+// missed while disconnected. See NewReconnectingStreamV2 for details. The
+// default is false.
+func OpenBackfill(backfill bool) OpenOption {
+	return OpenOption{func(do *openOptions) {
+		do.backfill = backfill
+	}}
+}
+
+// OpenProxyURL specifies the proxy for the connection to the endpoint. The
+// scheme of the URL is "http" or "https" for an HTTP CONNECT proxy or
+// "socks5" for a SOCKS5 proxy. Specify credentials for an authenticated proxy
+// in the user information of the URL. The option is ignored when the
+// OpenHTTPClient option is specified. The default is the proxy specified by
+// the HTTPS_PROXY, HTTP_PROXY and NO_PROXY environment variables.
+func OpenProxyURL(proxyURL *url.URL) OpenOption {
+	return OpenOption{func(do *openOptions) {
+		do.proxyURL = proxyURL
+	}}
+}
+
+// OpenTLSConfig specifies the TLS configuration for the connection to the
+// endpoint. Use this option to specify custom root CAs or a minimum TLS
+// version. The option is ignored when the OpenHTTPClient option is
+// specified.
+func OpenTLSConfig(config *tls.Config) OpenOption {
+	return OpenOption{func(do *openOptions) {
+		do.tlsConfig = config
+	}}
+}
+
+// OpenPinnedKeys pins the public keys trusted for the connection to the
+// endpoint. Each pin is the base64 encoded SHA-256 hash of a DER encoded
+// SubjectPublicKeyInfo, the format used by HTTP public key pinning. The
+// connection fails unless a certificate in the verified chain matches one of
+// the pins. The option is ignored when the OpenHTTPClient option is
+// specified.
+func OpenPinnedKeys(pins ...string) OpenOption {
+	return OpenOption{func(do *openOptions) {
+		do.pinnedKeys = pins
+	}}
+}
+
+// OpenLogger specifies the logger for connection events. A reconnecting stream
+// also logs reconnect attempts to the logger. The default is to not log.
+func OpenLogger(logger Logger) OpenOption {
+	return OpenOption{func(do *openOptions) {
+		do.logger = logger
+	}}
+}
+
+// OpenDebugWriter specifies a writer for debugging the stream. The stream
+// writes every line read from the connection, including keepalive and message
+// length lines, to the writer. Each line is prefixed with the time the line
+// was read in RFC 3339 format. Errors writing to the writer are ignored.
+func OpenDebugWriter(w io.Writer) OpenOption {
+	return OpenOption{func(do *openOptions) {
+		do.debugWriter = w
+	}}
+}
+
+// OpenTee specifies a writer for archiving the stream. The stream writes
+// every message read from the connection to the writer before the message is
+// deduplicated, filtered or returned to the application. Each message is
+// followed by '\n'. Keepalive and message length lines are not written. An
+// error from the writer closes the stream with a TeeError so that gaps in the
+// archive are not silent. Wrap the writer with a bufio.Writer or a
+// gzip.Writer as needed; the stream does not flush the writer.
+func OpenTee(w io.Writer) OpenOption {
+	return OpenOption{func(do *openOptions) {
+		do.tee = w
+	}}
+}
+
+// OpenClientTrace specifies hooks for tracing the connection to the endpoint.
+// Use the hooks to observe DNS, connect, TLS handshake and time to first byte
+// timings of the streaming connection.
+func OpenClientTrace(trace *httptrace.ClientTrace) OpenOption {
+	return OpenOption{func(do *openOptions) {
+		do.clientTrace = trace
+	}}
+}
+
+// OpenOnReconnect specifies a function that a reconnecting stream calls after
+// each successful reconnect. The gap argument is the time since the last
+// message was received on the previous connection. Use the function to start
+// a backfill of the tweets missed while disconnected. The function is called
+// from Next and should not block. The option is ignored by Open.
+func OpenOnReconnect(onReconnect func(gap time.Duration)) OpenOption {
+	return OpenOption{func(do *openOptions) {
+		do.onReconnect = onReconnect
+	}}
+}
+
+// OpenCheckpointer specifies a checkpointer for the ID of the newest tweet
+// returned by Next. The stream saves the ID at most once per interval and when
+// the stream is closed. The connections of a reconnecting stream share the
+// checkpoint. Errors saving the ID are logged to the logger.
+func OpenCheckpointer(c Checkpointer, interval time.Duration) OpenOption {
+	cp := &checkpoint{c: c, interval: interval}
+	return OpenOption{func(do *openOptions) {
+		do.checkpoint = cp
+	}}
+}
+
+// OpenDedupe specifies a deduper for filtering repeated tweets. Next skips
+// tweets that the deduper has seen. Use the same deduper for the connections
+// of a reconnecting stream and for backfill.
+func OpenDedupe(d Deduper) OpenOption {
+	return OpenOption{func(do *openOptions) {
+		do.deduper = d
+	}}
+}
+
+// OpenOverflowPolicy specifies what the goroutine started by Stream.Messages
+// does when the queue of messages is full. The number of discarded messages
+// is reported in Stats. The default is OverflowBlock.
+func OpenOverflowPolicy(policy OverflowPolicy) OpenOption {
+	return OpenOption{func(do *openOptions) {
+		do.overflow = policy
+	}}
+}
+
+// OpenQueueBytes limits the total size of the messages queued by the
+// goroutine started by Stream.Messages. The limit bounds the memory used when
+// the application falls behind. When the limit is reached, the goroutine
+// applies the policy specified by OpenOverflowPolicy. A message larger than
+// the limit is queued when the queue is empty. The default is no limit.
+func OpenQueueBytes(n int64) OpenOption {
+	return OpenOption{func(do *openOptions) {
+		do.queueBytes = n
+	}}
+}
+
+// OpenSpillDir specifies a directory for a disk queue used by the goroutine
+// started by Stream.Messages. When the queue in memory is full, the goroutine
+// appends messages to segment files in the directory instead of applying the
+// overflow policy. The messages are delivered from disk in order when the
+// application catches up. Messages left on disk when the stream is closed are
+// delivered first by the next stream opened with the directory. A directory
+// must not be used by more than one stream at a time.
+func OpenSpillDir(dir string) OpenOption {
+	return OpenOption{func(do *openOptions) {
+		do.spillDir = dir
+	}}
+}
+
+// OpenAtLeastOnce specifies at-least-once delivery for the goroutine started
+// by Stream.Messages. The goroutine writes every message to the disk queue
+// specified by OpenSpillDir before delivering the message. The application
+// must call Ack on each message after processing the message. Messages that
+// are not acknowledged when the process exits are delivered again by the next
+// stream opened with the directory. Messages are committed in order, so a
+// message that is never acknowledged causes all later messages to be
+// delivered again.
+func OpenAtLeastOnce() OpenOption {
+	return OpenOption{func(do *openOptions) {
+		do.atLeastOnce = true
+	}}
+}
+
+// OpenSource specifies a label for the stream. The label is set in the Source
+// field of the messages returned from Stream.Messages. Use the label to
+// identify the stream when messages from several streams are merged.
+func OpenSource(label string) OpenOption {
+	return OpenOption{func(do *openOptions) {
+		do.source = label
+	}}
+}
+
+// OpenUseNumber specifies that UnmarshalNext decodes numbers to interface{}
+// values as json.Number instead of float64. A float64 cannot represent tweet
+// and user IDs greater than 2^53. Use this option when decoding to maps or
+// to structs with interface{} fields. Numbers decoded to int64 fields, such
+// as the ID fields of the Tweet and User types, are exact without this
+// option. The option is ignored when a decoder is specified with
+// OpenDecoder.
+func OpenUseNumber() OpenOption {
+	return OpenOption{func(do *openOptions) {
+		do.useNumber = true
+	}}
+}
+
+// OpenDecoder specifies the decoder used by UnmarshalNext. The default
+// decoder is encoding/json.
+func OpenDecoder(d Decoder) OpenOption {
+	return OpenOption{func(do *openOptions) {
+		do.decoder = d
+	}}
+}
+
+// OpenMessageFilter specifies a filter for the lines returned by Next. Lines
+// rejected by the filter are skipped. If the option is specified more than
+// once, then a line is delivered only if all of the filters deliver the line.
+// Checkpoints and deduplication see the rejected lines.
+func OpenMessageFilter(f Filter) OpenOption {
+	return OpenOption{func(do *openOptions) {
+		g := f
+		if do.filter != nil {
+			g = AllFilters(do.filter, f)
+		}
+		do.filter = g
+	}}
+}
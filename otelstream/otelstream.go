@@ -0,0 +1,101 @@
+// Copyright 2010 Gary Burd
+//
+// Licensed under the Apache License, Version 2.0 (the "License"): you may
+// not use this file except in compliance with the License. You may obtain
+// a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+// WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the
+// License for the specific language governing permissions and limitations
+// under the License.
+
+// Package otelstream traces twitterstream connection attempts and message
+// handling with OpenTelemetry.
+//
+//  c := &twitterstream.Connector{...}
+//  rs := twitterstream.NewReconnectingStreamFunc(otelstream.TraceConnect(tracer, c.URL, c.Connect))
+//
+// This repository does not have module files. Add the package's
+// dependency to the application's module to select its version:
+//
+//  go get go.opentelemetry.io/otel
+package otelstream
+
+import (
+	"context"
+	"errors"
+	"github.com/garyburd/twitterstream"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+	"sync"
+)
+
+// Attribute keys set on the spans.
+const (
+	EndpointKey    = "twitterstream.endpoint"
+	AttemptKey     = "twitterstream.attempt"
+	StatusCodeKey  = "http.response.status_code"
+	MessageSizeKey = "twitterstream.message.size"
+)
+
+// TraceConnect returns a connect function that records a span for each call
+// to connect. The span has the endpoint, the attempt number and the HTTP
+// status code of a failed attempt as attributes. The attempt number counts the
+// attempts since the last successful connection, starting at one.
+func TraceConnect(tracer trace.Tracer, endpoint string, connect func(ctx context.Context) (*twitterstream.Stream, error)) func(ctx context.Context) (*twitterstream.Stream, error) {
+	var (
+		mu      sync.Mutex
+		attempt int
+	)
+	return func(ctx context.Context) (*twitterstream.Stream, error) {
+		mu.Lock()
+		attempt++
+		n := attempt
+		mu.Unlock()
+
+		ctx, span := tracer.Start(ctx, "twitterstream.connect",
+			trace.WithSpanKind(trace.SpanKindClient),
+			trace.WithAttributes(
+				attribute.String(EndpointKey, endpoint),
+				attribute.Int(AttemptKey, n)))
+		defer span.End()
+
+		ts, err := connect(ctx)
+		if err != nil {
+			var herr twitterstream.HTTPStatusError
+			if errors.As(err, &herr) {
+				span.SetAttributes(attribute.Int(StatusCodeKey, herr.StatusCode))
+			}
+			span.RecordError(err)
+			span.SetStatus(codes.Error, err.Error())
+			return nil, err
+		}
+		span.SetAttributes(attribute.Int(StatusCodeKey, 200))
+
+		mu.Lock()
+		attempt = 0
+		mu.Unlock()
+		return ts, nil
+	}
+}
+
+// TraceHandler returns a message handler that records a span named name for
+// each call to handle.
+func TraceHandler(tracer trace.Tracer, name string, handle func(ctx context.Context, p []byte) error) func(ctx context.Context, p []byte) error {
+	return func(ctx context.Context, p []byte) error {
+		ctx, span := tracer.Start(ctx, name,
+			trace.WithSpanKind(trace.SpanKindConsumer),
+			trace.WithAttributes(attribute.Int(MessageSizeKey, len(p))))
+		defer span.End()
+		err := handle(ctx, p)
+		if err != nil {
+			span.RecordError(err)
+			span.SetStatus(codes.Error, err.Error())
+		}
+		return err
+	}
+}
@@ -0,0 +1,312 @@
+// Copyright 2010 Gary Burd
+//
+// Licensed under the Apache License, Version 2.0 (the "License"): you may
+// not use this file except in compliance with the License. You may obtain
+// a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+// WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the
+// License for the specific language governing permissions and limitations
+// under the License.
+
+package twitterstream
+
+import (
+	"math"
+	"net/url"
+	"strconv"
+	"strings"
+)
+
+// BoundingBox is a geographic area for the locations filter parameter. The
+// box is specified by the longitude of the west and east edges and the
+// latitude of the south and north edges.
+type BoundingBox struct {
+	West, South, East, North float64
+}
+
+// String returns the box in the format used by the locations parameter.
+func (b BoundingBox) String() string {
+	return formatCoordinate(b.West) + "," + formatCoordinate(b.South) + "," +
+		formatCoordinate(b.East) + "," + formatCoordinate(b.North)
+}
+
+func formatCoordinate(f float64) string {
+	return strconv.FormatFloat(f, 'f', -1, 64)
+}
+
+// Point is a geographic location.
+type Point struct {
+	Lat, Lon float64
+}
+
+// Validate returns an error if the latitude or longitude is out of range.
+func (p Point) Validate() error {
+	if p.Lat < -90 || p.Lat > 90 || math.IsNaN(p.Lat) {
+		return &ParamError{"locations", "latitude " + formatCoordinate(p.Lat) + " is not between -90 and 90"}
+	}
+	if p.Lon < -180 || p.Lon > 180 || math.IsNaN(p.Lon) {
+		return &ParamError{"locations", "longitude " + formatCoordinate(p.Lon) + " is not between -180 and 180"}
+	}
+	return nil
+}
+
+// NewBoundingBox returns the box with the given southwest and northeast
+// corners.
+func NewBoundingBox(sw, ne Point) BoundingBox {
+	return BoundingBox{West: sw.Lon, South: sw.Lat, East: ne.Lon, North: ne.Lat}
+}
+
+// SouthWest returns the southwest corner of the box.
+func (b BoundingBox) SouthWest() Point {
+	return Point{Lat: b.South, Lon: b.West}
+}
+
+// NorthEast returns the northeast corner of the box.
+func (b BoundingBox) NorthEast() Point {
+	return Point{Lat: b.North, Lon: b.East}
+}
+
+// Contains returns true if the point is in the box.
+func (b BoundingBox) Contains(p Point) bool {
+	return p.Lat >= b.South && p.Lat <= b.North && p.Lon >= b.West && p.Lon <= b.East
+}
+
+// Validate returns an error if a coordinate is out of range or if the corners
+// are not in southwest, northeast order. Twitter does not accept boxes that
+// cross the antimeridian. Split such a box into two boxes.
+func (b BoundingBox) Validate() error {
+	if err := b.SouthWest().Validate(); err != nil {
+		return err
+	}
+	if err := b.NorthEast().Validate(); err != nil {
+		return err
+	}
+	if b.West >= b.East {
+		return &ParamError{"locations", "box " + b.String() + " west edge is not west of the east edge"}
+	}
+	if b.South >= b.North {
+		return &ParamError{"locations", "box " + b.String() + " south edge is not south of the north edge"}
+	}
+	return nil
+}
+
+// earthRadiusKm is the mean radius of the earth.
+const earthRadiusKm = 6371.0
+
+// BoxAround returns the box enclosing the circle with the given center and
+// radius in kilometers. The box is clamped to the valid latitude and longitude
+// ranges.
+func BoxAround(lat, lon, radiusKm float64) BoundingBox {
+	dLat := radiusKm / earthRadiusKm * 180 / math.Pi
+	b := BoundingBox{South: lat - dLat, North: lat + dLat, West: -180, East: 180}
+	if cos := math.Cos(lat * math.Pi / 180); b.South > -90 && b.North < 90 && cos > 0 {
+		dLon := dLat / cos
+		if dLon < 180 {
+			b.West = lon - dLon
+			b.East = lon + dLon
+		}
+	}
+	b.South = math.Max(b.South, -90)
+	b.North = math.Min(b.North, 90)
+	b.West = math.Max(b.West, -180)
+	b.East = math.Min(b.East, 180)
+	return b
+}
+
+// FilterParams specifies the parameters for the statuses/filter endpoint.
+//
+//  params := twitterstream.FilterParams{
+//      Track:    []string{"golang", "gopher"},
+//      Language: []string{"en"},
+//  }.Values()
+//  ts, err := twitterstream.Open(client, cred, url, params)
+type FilterParams struct {
+	// Track is a list of phrases to match. A phrase is a list of terms
+	// separated by spaces. A tweet matches the phrase if the tweet contains
+	// all of the terms.
+	Track []string
+
+	// Follow is a list of user IDs to match. A tweet matches if the tweet is
+	// created by, retweeted by or replied to by one of the users.
+	Follow []int64
+
+	// Locations is a list of areas to match.
+	Locations []BoundingBox
+
+	// Language is a list of BCP 47 language identifiers such as "en" or
+	// "pt-BR". If set, then only tweets detected to be in one of the
+	// languages are delivered.
+	Language []string
+
+	// FilterLevel is the minimum filter_level attribute of delivered tweets.
+	FilterLevel FilterLevel
+
+	// ExtendedMode requests tweets in extended mode. In extended mode, the
+	// text of a tweet is sent in the full_text field instead of the text
+	// field.
+	ExtendedMode bool
+}
+
+// FilterLevel is the value of the filter_level parameter. Twitter assigns a
+// filter level to each tweet. The stream delivers only tweets at or above the
+// requested level.
+type FilterLevel string
+
+// Filter levels.
+const (
+	FilterLevelNone   FilterLevel = "none"
+	FilterLevelLow    FilterLevel = "low"
+	FilterLevelMedium FilterLevel = "medium"
+)
+
+// isLanguageTag returns true if s is a well formed BCP 47 language tag: a two
+// or three letter primary language subtag followed by subtags of one to eight
+// letters and digits.
+func isLanguageTag(s string) bool {
+	for i, subtag := range strings.Split(s, "-") {
+		if i == 0 && (len(subtag) < 2 || len(subtag) > 3) || len(subtag) < 1 || len(subtag) > 8 {
+			return false
+		}
+		for _, c := range subtag {
+			isLetter := 'a' <= c && c <= 'z' || 'A' <= c && c <= 'Z'
+			if !isLetter && (i == 0 || c < '0' || c > '9') {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+// Values returns the parameters encoded for use with Open.
+func (fp FilterParams) Values() url.Values {
+	params := url.Values{}
+	if len(fp.Track) > 0 {
+		params.Set("track", strings.Join(fp.Track, ","))
+	}
+	if len(fp.Follow) > 0 {
+		ids := make([]string, len(fp.Follow))
+		for i, id := range fp.Follow {
+			ids[i] = strconv.FormatInt(id, 10)
+		}
+		params.Set("follow", strings.Join(ids, ","))
+	}
+	if len(fp.Locations) > 0 {
+		boxes := make([]string, len(fp.Locations))
+		for i, b := range fp.Locations {
+			boxes[i] = b.String()
+		}
+		params.Set("locations", strings.Join(boxes, ","))
+	}
+	if len(fp.Language) > 0 {
+		params.Set("language", strings.Join(fp.Language, ","))
+	}
+	if fp.FilterLevel != "" {
+		params.Set("filter_level", string(fp.FilterLevel))
+	}
+	if fp.ExtendedMode {
+		params.Set("tweet_mode", "extended")
+	}
+	return params
+}
+
+// Limits on the parameters of the statuses/filter endpoint.
+const (
+	MaxTrackPhrases  = 400
+	MaxTrackLength   = 60
+	MaxFollowIDs     = 5000
+	MaxLocationBoxes = 25
+)
+
+// ParamError is returned when request parameters exceed the limits of the
+// endpoint. Twitter rejects such requests, so reconnecting does not help.
+type ParamError struct {
+	Param   string
+	Message string
+}
+
+func (err *ParamError) Error() string {
+	return "twitterstream: parameter " + err.Param + ": " + err.Message
+}
+
+// Temporary returns false.
+func (err *ParamError) Temporary() bool {
+	return false
+}
+
+// ValidateFilterParams checks the parameters for the statuses/filter
+// endpoint against the limits documented by Twitter. The function returns a
+// *ParamError describing the first problem found.
+func ValidateFilterParams(params url.Values) error {
+	track := params.Get("track")
+	follow := params.Get("follow")
+	locations := params.Get("locations")
+	if track == "" && follow == "" && locations == "" {
+		return &ParamError{"track", "one of track, follow or locations is required"}
+	}
+	if track != "" {
+		phrases := strings.Split(track, ",")
+		if len(phrases) > MaxTrackPhrases {
+			return &ParamError{"track", strconv.Itoa(len(phrases)) + " phrases exceeds the limit of " + strconv.Itoa(MaxTrackPhrases)}
+		}
+		for _, phrase := range phrases {
+			if len(phrase) > MaxTrackLength {
+				return &ParamError{"track", strconv.Quote(phrase) + " exceeds the limit of " + strconv.Itoa(MaxTrackLength) + " bytes"}
+			}
+		}
+	}
+	if follow != "" {
+		ids := strings.Split(follow, ",")
+		if len(ids) > MaxFollowIDs {
+			return &ParamError{"follow", strconv.Itoa(len(ids)) + " IDs exceeds the limit of " + strconv.Itoa(MaxFollowIDs)}
+		}
+		for _, id := range ids {
+			if _, err := strconv.ParseInt(strings.TrimSpace(id), 10, 64); err != nil {
+				return &ParamError{"follow", strconv.Quote(id) + " is not a user ID"}
+			}
+		}
+	}
+	if locations != "" {
+		coords := strings.Split(locations, ",")
+		if len(coords)%4 != 0 {
+			return &ParamError{"locations", "the number of coordinates is not a multiple of four"}
+		}
+		if n := len(coords) / 4; n > MaxLocationBoxes {
+			return &ParamError{"locations", strconv.Itoa(n) + " boxes exceeds the limit of " + strconv.Itoa(MaxLocationBoxes)}
+		}
+		f := make([]float64, len(coords))
+		for i, c := range coords {
+			var err error
+			if f[i], err = strconv.ParseFloat(strings.TrimSpace(c), 64); err != nil {
+				return &ParamError{"locations", strconv.Quote(c) + " is not a coordinate"}
+			}
+		}
+		for i := 0; i < len(f); i += 4 {
+			if err := (BoundingBox{West: f[i], South: f[i+1], East: f[i+2], North: f[i+3]}).Validate(); err != nil {
+				return err
+			}
+		}
+	}
+	if language := params.Get("language"); language != "" {
+		for _, tag := range strings.Split(language, ",") {
+			if !isLanguageTag(tag) {
+				return &ParamError{"language", strconv.Quote(tag) + " is not a BCP 47 language tag"}
+			}
+		}
+	}
+	switch level := FilterLevel(params.Get("filter_level")); level {
+	case "", FilterLevelNone, FilterLevelLow, FilterLevelMedium:
+	default:
+		return &ParamError{"filter_level", strconv.Quote(string(level)) + " is not none, low or medium"}
+	}
+	return nil
+}
+
+// Validate checks the parameters against the limits of the statuses/filter
+// endpoint. See ValidateFilterParams.
+func (fp FilterParams) Validate() error {
+	return ValidateFilterParams(fp.Values())
+}
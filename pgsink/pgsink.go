@@ -0,0 +1,289 @@
+// Copyright 2010 Gary Burd
+//
+// Licensed under the Apache License, Version 2.0 (the "License"): you may
+// not use this file except in compliance with the License. You may obtain
+// a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+// WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the
+// License for the specific language governing permissions and limitations
+// under the License.
+
+// Package pgsink inserts the tweets read from a twitterstream stream into a
+// PostgreSQL table.
+//
+// The sink uses database/sql. Import a PostgreSQL driver such as
+// github.com/lib/pq or github.com/jackc/pgx/v5/stdlib in the application.
+//
+//  db, err := sql.Open("postgres", "dbname=twitter sslmode=disable")
+//  s := &pgsink.Sink{DB: db}
+//  if err := s.CreateTable(ctx); err != nil {
+//      log.Fatal(err)
+//  }
+//  err = s.Run(ctx, ts.Messages(1000))
+//
+// The table has the following columns. The user_id and created_at columns
+// are indexed.
+//
+//  id          bigint PRIMARY KEY   -- ID of the tweet
+//  user_id     bigint               -- ID of the user who posted the tweet
+//  created_at  timestamptz          -- time the tweet was posted
+//  deleted_at  timestamptz          -- time of the delete notice or NULL
+//  data        jsonb NOT NULL       -- the message read from the stream
+//
+// The sink stores v1.1 tweets and v2 responses with data. Delete notices set
+// deleted_at for the deleted tweet. Applications that honor deletes should
+// exclude or purge rows where deleted_at is not NULL. Other messages are
+// ignored.
+//
+// The sink writes batches with multi-row INSERT statements instead of COPY
+// so that tweets already in the table are skipped with ON CONFLICT.
+package pgsink
+
+import (
+	"context"
+	"database/sql"
+	"github.com/garyburd/twitterstream"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Sink inserts tweets into PostgreSQL. The fields must not be changed after
+// the first message is written.
+type Sink struct {
+	// DB is the database.
+	DB *sql.DB
+
+	// Table is the name of the table. If empty, then "tweets" is used.
+	Table string
+
+	// BatchSize is the maximum number of messages written in one
+	// transaction. If zero, then 500 is used.
+	BatchSize int
+
+	// OnError is called with each message in a batch that could not be
+	// written. See twitterstream.Settle.
+	OnError func(m twitterstream.Message, err error)
+}
+
+// maxBatchSize keeps the number of parameters in a statement below the
+// PostgreSQL limit of 65535.
+const maxBatchSize = 10000
+
+func (s *Sink) table() string {
+	if s.Table == "" {
+		return "tweets"
+	}
+	return s.Table
+}
+
+func quoteIdent(s string) string {
+	return `"` + strings.ReplaceAll(s, `"`, `""`) + `"`
+}
+
+// CreateTable creates the table and indexes if they do not exist.
+func (s *Sink) CreateTable(ctx context.Context) error {
+	t := s.table()
+	stmts := []string{
+		`CREATE TABLE IF NOT EXISTS ` + quoteIdent(t) + ` (
+	id bigint PRIMARY KEY,
+	user_id bigint,
+	created_at timestamptz,
+	deleted_at timestamptz,
+	data jsonb NOT NULL
+)`,
+		`CREATE INDEX IF NOT EXISTS ` + quoteIdent(t+"_user_id_idx") + ` ON ` + quoteIdent(t) + ` (user_id)`,
+		`CREATE INDEX IF NOT EXISTS ` + quoteIdent(t+"_created_at_idx") + ` ON ` + quoteIdent(t) + ` (created_at)`,
+	}
+	for _, stmt := range stmts {
+		if _, err := s.DB.ExecContext(ctx, stmt); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// row is a tweet to insert.
+type row struct {
+	id        int64
+	userID    interface{}
+	createdAt interface{}
+	data      string
+}
+
+// deletion is a tweet to mark as deleted.
+type deletion struct {
+	id        int64
+	deletedAt time.Time
+}
+
+func parseTime(v []byte) interface{} {
+	var t twitterstream.TwitterTime
+	if t.UnmarshalJSON(v) != nil || t.IsZero() {
+		return nil
+	}
+	return t.Time
+}
+
+func parseID(lm twitterstream.LazyMessage, path string) (int64, bool) {
+	s := lm.String(path)
+	if s == "" {
+		return 0, false
+	}
+	id, err := strconv.ParseInt(s, 10, 64)
+	return id, err == nil
+}
+
+// classify adds message m to the rows or deletions.
+func classify(m twitterstream.Message, rows []row, dels []deletion) ([]row, []deletion) {
+	lm := twitterstream.LazyMessage(m.Raw)
+	switch twitterstream.KindOf(m.Raw) {
+	case twitterstream.KindTweet:
+		r := row{data: string(m.Raw)}
+		idPath, userPath, timePath := "id_str", "user.id_str", "created_at"
+		if lm.Has("data") {
+			idPath, userPath, timePath = "data.id", "data.author_id", "data.created_at"
+		}
+		var ok bool
+		if r.id, ok = parseID(lm, idPath); !ok {
+			return rows, dels
+		}
+		if id, ok := parseID(lm, userPath); ok {
+			r.userID = id
+		}
+		if v, ok := lm.Get(timePath); ok {
+			r.createdAt = parseTime(v)
+		}
+		rows = append(rows, r)
+	case twitterstream.KindDelete:
+		d := deletion{deletedAt: m.Received}
+		var ok bool
+		if d.id, ok = parseID(lm, "delete.status.id_str"); !ok {
+			return rows, dels
+		}
+		if v, ok := lm.Get("delete.timestamp_ms"); ok {
+			if t, ok := parseTime(v).(time.Time); ok {
+				d.deletedAt = t
+			}
+		}
+		dels = append(dels, d)
+	}
+	return rows, dels
+}
+
+// placeholders appends a parenthesized list of n placeholders starting at
+// $i+1 to buf.
+func placeholders(buf []byte, i, n int, casts ...string) []byte {
+	buf = append(buf, '(')
+	for j := 0; j < n; j++ {
+		if j > 0 {
+			buf = append(buf, ", "...)
+		}
+		buf = append(buf, '$')
+		buf = strconv.AppendInt(buf, int64(i+j+1), 10)
+		if j < len(casts) {
+			buf = append(buf, casts[j]...)
+		}
+	}
+	return append(buf, ')')
+}
+
+// write writes a batch of messages in a transaction.
+func (s *Sink) write(ctx context.Context, batch []twitterstream.Message) error {
+	var rows []row
+	var dels []deletion
+	for _, m := range batch {
+		rows, dels = classify(m, rows, dels)
+	}
+	if len(rows) == 0 && len(dels) == 0 {
+		return nil
+	}
+
+	tx, err := s.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	t := quoteIdent(s.table())
+	if len(rows) > 0 {
+		buf := []byte(`INSERT INTO ` + t + ` (id, user_id, created_at, data) VALUES `)
+		args := make([]interface{}, 0, 4*len(rows))
+		for i, r := range rows {
+			if i > 0 {
+				buf = append(buf, ", "...)
+			}
+			buf = placeholders(buf, len(args), 4, "", "", "", "::jsonb")
+			args = append(args, r.id, r.userID, r.createdAt, r.data)
+		}
+		buf = append(buf, ` ON CONFLICT (id) DO NOTHING`...)
+		if _, err := tx.ExecContext(ctx, string(buf), args...); err != nil {
+			return err
+		}
+	}
+	if len(dels) > 0 {
+		buf := []byte(`UPDATE ` + t + ` AS t SET deleted_at = v.deleted_at FROM (VALUES `)
+		args := make([]interface{}, 0, 2*len(dels))
+		for i, d := range dels {
+			if i > 0 {
+				buf = append(buf, ", "...)
+			}
+			buf = placeholders(buf, len(args), 2, "::bigint", "::timestamptz")
+			args = append(args, d.id, d.deletedAt)
+		}
+		buf = append(buf, `) AS v (id, deleted_at) WHERE t.id = v.id AND t.deleted_at IS NULL`...)
+		if _, err := tx.ExecContext(ctx, string(buf), args...); err != nil {
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+// flush writes a batch and handles the result for each message.
+func (s *Sink) flush(ctx context.Context, batch []twitterstream.Message) error {
+	err := s.write(ctx, batch)
+	if err != nil && ctx.Err() != nil {
+		return ctx.Err()
+	}
+	for _, m := range batch {
+		if err := twitterstream.Settle(m, err, s.OnError); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Write writes a single message.
+func (s *Sink) Write(ctx context.Context, m twitterstream.Message) error {
+	return s.flush(ctx, []twitterstream.Message{m})
+}
+
+// Run writes the messages received from the channel until the channel is
+// closed or the context is done. Run writes the messages that are waiting
+// on the channel in one transaction. Messages are acknowledged after the
+// transaction is committed.
+func (s *Sink) Run(ctx context.Context, messages <-chan twitterstream.Message) error {
+	n := s.BatchSize
+	if n <= 0 {
+		n = 500
+	}
+	if n > maxBatchSize {
+		n = maxBatchSize
+	}
+	for {
+		batch, err := twitterstream.Batch(ctx, messages, n)
+		if err == io.EOF {
+			return nil
+		} else if err != nil {
+			return err
+		}
+		if err := s.flush(ctx, batch); err != nil {
+			return err
+		}
+	}
+}
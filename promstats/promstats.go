@@ -0,0 +1,105 @@
+// Copyright 2010 Gary Burd
+//
+// Licensed under the Apache License, Version 2.0 (the "License"): you may
+// not use this file except in compliance with the License. You may obtain
+// a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+// WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the
+// License for the specific language governing permissions and limitations
+// under the License.
+
+// Package promstats exports the statistics of a twitterstream stream as
+// Prometheus metrics.
+//
+// The collector reads the stream's Stats on each scrape. Use rate() on the
+// counters to get messages and bytes per second.
+//
+//  ts := twitterstream.NewReconnectingStream(client, cred, url, params)
+//  reg.MustRegister(promstats.NewCollector(ts, "ingest", nil))
+//
+// This repository does not have module files. Add the package's
+// dependency to the application's module to select its version:
+//
+//  go get github.com/prometheus/client_golang
+package promstats
+
+import (
+	"github.com/garyburd/twitterstream"
+	"github.com/prometheus/client_golang/prometheus"
+	"time"
+)
+
+// Source is the interface implemented by twitterstream.Stream and
+// twitterstream.ReconnectingStream.
+type Source interface {
+	Stats() twitterstream.Stats
+}
+
+// Collector is a prometheus.Collector for the statistics of a stream.
+type Collector struct {
+	source Source
+
+	messages     *prometheus.Desc
+	bytes        *prometheus.Desc
+	reconnects   *prometheus.Desc
+	dropped      *prometheus.Desc
+	decodeErrors *prometheus.Desc
+	uptime       *prometheus.Desc
+	lastMessage  *prometheus.Desc
+}
+
+// NewCollector returns a collector for the stream. The metric names are
+// prefixed with namespace if namespace is not empty. The constLabels are
+// added to every metric.
+func NewCollector(source Source, namespace string, constLabels prometheus.Labels) *Collector {
+	desc := func(name, help string) *prometheus.Desc {
+		return prometheus.NewDesc(prometheus.BuildFQName(namespace, "twitterstream", name), help, nil, constLabels)
+	}
+	return &Collector{
+		source:       source,
+		messages:     desc("messages_total", "Number of messages read from the stream."),
+		bytes:        desc("bytes_total", "Number of bytes read from the stream."),
+		reconnects:   desc("reconnects_total", "Number of reconnections to the endpoint."),
+		dropped:      desc("dropped_tweets_total", "Number of undelivered tweets reported by limit notices."),
+		decodeErrors: desc("decode_errors_total", "Number of messages that could not be decoded."),
+		uptime:       desc("connection_uptime_seconds", "Time since the current connection was established."),
+		lastMessage:  desc("last_message_timestamp_seconds", "Unix time of the last message read from the stream."),
+	}
+}
+
+// Describe implements the prometheus.Collector interface.
+func (c *Collector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- c.messages
+	ch <- c.bytes
+	ch <- c.reconnects
+	ch <- c.dropped
+	ch <- c.decodeErrors
+	ch <- c.uptime
+	ch <- c.lastMessage
+}
+
+// Collect implements the prometheus.Collector interface.
+func (c *Collector) Collect(ch chan<- prometheus.Metric) {
+	s := c.source.Stats()
+	ch <- prometheus.MustNewConstMetric(c.messages, prometheus.CounterValue, float64(s.Messages))
+	ch <- prometheus.MustNewConstMetric(c.bytes, prometheus.CounterValue, float64(s.Bytes))
+	ch <- prometheus.MustNewConstMetric(c.reconnects, prometheus.CounterValue, float64(s.Reconnects))
+	ch <- prometheus.MustNewConstMetric(c.dropped, prometheus.CounterValue, float64(s.Dropped))
+	ch <- prometheus.MustNewConstMetric(c.decodeErrors, prometheus.CounterValue, float64(s.DecodeErrors))
+
+	var uptime float64
+	if !s.ConnectedSince.IsZero() {
+		uptime = time.Since(s.ConnectedSince).Seconds()
+	}
+	ch <- prometheus.MustNewConstMetric(c.uptime, prometheus.GaugeValue, uptime)
+
+	var last float64
+	if !s.LastMessage.IsZero() {
+		last = float64(s.LastMessage.UnixNano()) / 1e9
+	}
+	ch <- prometheus.MustNewConstMetric(c.lastMessage, prometheus.GaugeValue, last)
+}
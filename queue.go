@@ -0,0 +1,239 @@
+// Copyright 2010 Gary Burd
+//
+// Licensed under the Apache License, Version 2.0 (the "License"): you may
+// not use this file except in compliance with the License. You may obtain
+// a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+// WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the
+// License for the specific language governing permissions and limitations
+// under the License.
+
+package twitterstream
+
+import (
+	"sync"
+	"sync/atomic"
+)
+
+// OverflowPolicy specifies what the goroutine started by Messages does when
+// the application falls behind and the queue of read messages is full.
+type OverflowPolicy int
+
+const (
+	// OverflowBlock stops reading the stream until the application receives
+	// a message. If the application falls far enough behind, then Twitter
+	// sends stall warnings and closes the connection.
+	OverflowBlock OverflowPolicy = iota
+
+	// OverflowDropOldest discards the oldest message in the queue.
+	OverflowDropOldest
+
+	// OverflowDropNewest discards the message read from the stream.
+	OverflowDropNewest
+)
+
+// messageQueue is the bounded queue between the goroutine reading the stream
+// and the goroutine sending messages to the application.
+type messageQueue struct {
+	mu       sync.Mutex
+	cond     sync.Cond
+	items    []Message
+	depth    int
+	policy   OverflowPolicy
+	maxBytes int64
+
+	// Total size of the queued messages. Accessed atomically for Stats.
+	bytes int64
+
+	// Disk queue for messages that do not fit in memory and the number of
+	// messages in the disk queue. The count is accessed atomically for
+	// Stats.
+	spill   *spillQueue
+	spilled int64
+
+	// Error from the disk queue.
+	err error
+
+	// Positions of the delivered messages in ack mode, oldest first. The ID
+	// of the first pending message is ackBase.
+	pending []ackEntry
+	ackBase uint64
+
+	// The writer is done. Queued messages are delivered.
+	closed bool
+
+	// The stream is closed. Queued messages are discarded.
+	aborted bool
+
+	// Number of messages discarded by the overflow policy. Accessed
+	// atomically.
+	dropped int64
+}
+
+func newMessageQueue(depth int, policy OverflowPolicy, maxBytes int64) *messageQueue {
+	if depth < 1 {
+		depth = 1
+	}
+	q := &messageQueue{depth: depth, policy: policy, maxBytes: maxBytes}
+	q.cond.L = &q.mu
+	return q
+}
+
+// full returns true if the queue does not have room for a message of size n.
+// A message larger than the byte limit is accepted when the queue is empty.
+func (q *messageQueue) full(n int) bool {
+	if len(q.items) >= q.depth {
+		return true
+	}
+	return q.maxBytes > 0 && len(q.items) > 0 && q.bytes+int64(n) > q.maxBytes
+}
+
+// removeOldest removes the oldest message from the queue.
+func (q *messageQueue) removeOldest() Message {
+	m := q.items[0]
+	q.items[0] = Message{}
+	q.items = q.items[1:]
+	atomic.AddInt64(&q.bytes, -int64(len(m.Raw)))
+	return m
+}
+
+// put adds a message to the queue, applying the overflow policy if the queue
+// is full. The function returns false if the queue is aborted.
+func (q *messageQueue) put(m Message) bool {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	if q.spill != nil && !q.aborted && (q.spill.ack || q.spill.len() > 0 || q.full(len(m.Raw))) {
+		// Preserve order by spilling all messages until the disk queue
+		// is drained. In ack mode, all messages are written to disk.
+		if err := q.spill.push(m); err != nil {
+			q.err = err
+			q.aborted = true
+			q.cond.Broadcast()
+			return false
+		}
+		m.Release()
+		atomic.StoreInt64(&q.spilled, int64(q.spill.len()))
+		q.cond.Broadcast()
+		return true
+	}
+	for !q.aborted && q.full(len(m.Raw)) {
+		switch q.policy {
+		case OverflowDropOldest:
+			q.removeOldest().Release()
+			atomic.AddInt64(&q.dropped, 1)
+		case OverflowDropNewest:
+			m.Release()
+			atomic.AddInt64(&q.dropped, 1)
+			return true
+		default:
+			q.cond.Wait()
+		}
+	}
+	if q.aborted {
+		return false
+	}
+	q.items = append(q.items, m)
+	atomic.AddInt64(&q.bytes, int64(len(m.Raw)))
+	q.cond.Broadcast()
+	return true
+}
+
+// get removes the oldest message from the queue, waiting for a message as
+// needed. The function returns false if the queue is aborted or if the queue
+// is closed and empty.
+func (q *messageQueue) get() (Message, bool) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	for !q.aborted && !q.closed && len(q.items) == 0 && (q.spill == nil || q.spill.len() == 0) {
+		q.cond.Wait()
+	}
+	if q.aborted {
+		return Message{}, false
+	}
+	if len(q.items) == 0 && q.spill != nil && q.spill.len() > 0 {
+		m, pos, err := q.spill.pop()
+		if err != nil {
+			q.err = err
+			q.aborted = true
+			q.cond.Broadcast()
+			return Message{}, false
+		}
+		atomic.StoreInt64(&q.spilled, int64(q.spill.len()))
+		if q.spill.ack {
+			id := q.ackBase + uint64(len(q.pending))
+			q.pending = append(q.pending, ackEntry{pos: pos})
+			m.ack = func() { q.ack(id) }
+		}
+		return m, true
+	}
+	if len(q.items) == 0 {
+		return Message{}, false
+	}
+	m := q.removeOldest()
+	q.cond.Broadcast()
+	return m, true
+}
+
+// ack marks the message with the given ID as acknowledged and commits the
+// position after the acknowledged prefix of the delivered messages.
+func (q *messageQueue) ack(id uint64) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	if q.spill == nil || id < q.ackBase || id-q.ackBase >= uint64(len(q.pending)) {
+		return
+	}
+	q.pending[id-q.ackBase].acked = true
+	var pos spillPos
+	n := 0
+	for n < len(q.pending) && q.pending[n].acked {
+		pos = q.pending[n].pos
+		n++
+	}
+	if n == 0 {
+		return
+	}
+	q.pending = q.pending[n:]
+	q.ackBase += uint64(n)
+	if err := q.spill.commit(pos); err != nil && q.err == nil {
+		q.err = err
+	}
+}
+
+// error returns the error from the disk queue.
+func (q *messageQueue) error() error {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	return q.err
+}
+
+// close marks the end of the messages written to the queue.
+func (q *messageQueue) close() {
+	q.mu.Lock()
+	q.closed = true
+	q.cond.Broadcast()
+	q.mu.Unlock()
+}
+
+// abort discards the queued messages and wakes the waiting goroutines.
+func (q *messageQueue) abort() {
+	q.mu.Lock()
+	q.aborted = true
+	q.items = nil
+	atomic.StoreInt64(&q.bytes, 0)
+	if q.spill != nil {
+		q.spill.close()
+		q.spill = nil
+	}
+	q.cond.Broadcast()
+	q.mu.Unlock()
+}
+
+// ackEntry is the position of a delivered message in ack mode.
+type ackEntry struct {
+	pos   spillPos
+	acked bool
+}
@@ -0,0 +1,80 @@
+// Copyright 2010 Gary Burd
+//
+// Licensed under the Apache License, Version 2.0 (the "License"): you may
+// not use this file except in compliance with the License. You may obtain
+// a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+// WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the
+// License for the specific language governing permissions and limitations
+// under the License.
+
+package twitterstream
+
+import (
+	"io"
+)
+
+// Reader returns a reader of the messages in the stream as newline-delimited
+// JSON. The reader reads the stream with Next: keepalives are removed, the
+// response is decompressed, and the messages are filtered as specified by
+// the stream's options. Each message is followed by a single '\n'. Messages
+// larger than the limit set with OpenMaxMessageSize are skipped. The reader
+// returns io.EOF after the stream is closed.
+//
+// The reader can be passed to NDJSON tools or to a json.Decoder:
+//
+//  dec := json.NewDecoder(ts.Reader())
+//  for {
+//      var t twitterstream.Tweet
+//      if err := dec.Decode(&t); err != nil {
+//          break
+//      }
+//      ...
+//  }
+//
+// Do not call the stream's other read methods while using the reader.
+func (ts *Stream) Reader() io.Reader {
+	return &lineReader{r: ts}
+}
+
+// Reader returns a reader of the messages in the stream as newline-delimited
+// JSON. See Stream.Reader for details.
+func (rs *ReconnectingStream) Reader() io.Reader {
+	return &lineReader{r: rs}
+}
+
+// lineReader implements io.Reader over the lines read from a stream.
+type lineReader struct {
+	r   StreamReader
+	buf []byte
+	p   []byte
+	err error
+}
+
+func (lr *lineReader) Read(p []byte) (int, error) {
+	for len(lr.p) == 0 {
+		if lr.err != nil {
+			return 0, lr.err
+		}
+		line, err := lr.r.Next()
+		switch {
+		case err == ErrMessageTooLarge:
+			continue
+		case err == ErrStreamClosed:
+			lr.err = io.EOF
+			continue
+		case err != nil:
+			lr.err = err
+			continue
+		}
+		lr.buf = append(append(lr.buf[:0], line...), '\n')
+		lr.p = lr.buf
+	}
+	n := copy(p, lr.p)
+	lr.p = lr.p[n:]
+	return n, nil
+}
@@ -0,0 +1,450 @@
+// Copyright 2010 Gary Burd
+//
+// Licensed under the Apache License, Version 2.0 (the "License"): you may
+// not use this file except in compliance with the License. You may obtain
+// a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+// WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the
+// License for the specific language governing permissions and limitations
+// under the License.
+
+package twitterstream
+
+import (
+	"context"
+	"errors"
+	"github.com/garyburd/go-oauth/oauth"
+	"net/url"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Reconnect delays recommended by Twitter.
+const (
+	networkBackoffStep  = 250 * time.Millisecond
+	networkBackoffMax   = 16 * time.Second
+	httpBackoffMin      = 5 * time.Second
+	httpBackoffMax      = 320 * time.Second
+	rateLimitBackoffMin = time.Minute
+	rateLimitBackoffMax = 16 * time.Minute
+)
+
+// minHealthyConnection is the time that a connection must stay up to reset
+// the backoff if the connection does not deliver a message.
+const minHealthyConnection = time.Minute
+
+// backoff computes the delay between connection attempts.
+type backoff struct {
+	kind int
+	wait time.Duration
+}
+
+const (
+	backoffNone = iota
+	backoffNetwork
+	backoffHTTP
+	backoffRateLimit
+)
+
+// next returns the time to wait before the next connection attempt given the
+// error from the previous attempt. Network errors back off linearly. HTTP
+// errors and disconnect notices back off exponentially. HTTP 420 and 429 rate
+// limit errors back off exponentially starting from a longer delay. The
+// delay is at least the delay requested by the Retry-After and rate limit
+// headers.
+func (b *backoff) next(err error) time.Duration {
+	kind := backoffNetwork
+	var min time.Duration
+	switch err := err.(type) {
+	case HTTPStatusError:
+		kind = backoffHTTP
+		if err.StatusCode == 420 || err.StatusCode == 429 {
+			kind = backoffRateLimit
+		}
+		min = err.retryDelay()
+	case DisconnectError:
+		kind = backoffHTTP
+	}
+	if kind != b.kind {
+		b.kind = kind
+		b.wait = 0
+	}
+	switch kind {
+	case backoffNetwork:
+		b.wait += networkBackoffStep
+		if b.wait > networkBackoffMax {
+			b.wait = networkBackoffMax
+		}
+	case backoffHTTP:
+		b.wait = backoffDouble(b.wait, httpBackoffMin, httpBackoffMax)
+	case backoffRateLimit:
+		b.wait = backoffDouble(b.wait, rateLimitBackoffMin, rateLimitBackoffMax)
+	}
+	if min > b.wait {
+		return min
+	}
+	return b.wait
+}
+
+func (b *backoff) reset() {
+	b.kind = backoffNone
+	b.wait = 0
+}
+
+func backoffDouble(d, min, max time.Duration) time.Duration {
+	d *= 2
+	if d < min {
+		d = min
+	}
+	if d > max {
+		d = max
+	}
+	return d
+}
+
+// isOverloaded returns true if the connection was closed because Twitter or
+// the application could not keep up with the stream. Reconnects after these
+// errors are delayed.
+func isOverloaded(err error) bool {
+	if err, ok := err.(DisconnectError); ok {
+		switch err.Code {
+		case DisconnectStall, DisconnectMaxMessageLimit, DisconnectStreamException, DisconnectShedLoad:
+			return true
+		}
+	}
+	return false
+}
+
+// ReconnectingStream maintains a connection to a Twitter streaming endpoint.
+// When the connection is dropped, the stream reconnects immediately and then
+// slows down further attempts using the strategy recommended by Twitter:
+// linear backoff for network errors, exponential backoff for HTTP errors and
+// a longer exponential backoff for HTTP 420 and 429 rate limit errors. A
+// connection that is dropped before delivering a message or staying up for a
+// minute counts as a failed attempt, so a server that accepts connections and
+// then closes them is not reconnected in a tight loop.
+type ReconnectingStream struct {
+	// open opens a connection. The gap argument is the time since the last
+	// message was received on the previous connection, or zero for the first
+	// connection. The params argument is the current request parameters.
+	open func(ctx context.Context, gap time.Duration, params url.Values) (*Stream, error)
+
+	// Current request parameters and whether open uses the parameters.
+	params      url.Values
+	fixedParams bool
+
+	// Time that the last message was received. Accessed only from Next.
+	lastMessage time.Time
+
+	mu      sync.Mutex
+	ts      *Stream
+	err     error
+	ctx     context.Context
+	cancel  context.CancelFunc
+	backoff backoff
+
+	// Counters for previous connections.
+	stats Stats
+
+	// Number of successful connections.
+	connects int64
+
+	// Messages that UnmarshalNext could not decode. Accessed atomically.
+	decodeErrors int64
+
+	// Delay before the next connection attempt.
+	wait time.Duration
+
+	logger      Logger
+	onReconnect func(gap time.Duration)
+
+	// Gaps on previous connections and the start and cause of the current
+	// disconnect.
+	gaps      []Gap
+	downSince time.Time
+	downErr   error
+}
+
+// NewReconnectingStream returns a stream that connects to the endpoint on the
+// first call to Next and reconnects as needed. The arguments have the same
+// meaning as the arguments to Open.
+func NewReconnectingStream(oauthClient *oauth.Client, accessToken *oauth.Credentials, urlStr string, params url.Values, options ...OpenOption) *ReconnectingStream {
+	return newReconnectingStream(func(ctx context.Context, gap time.Duration, params url.Values) (*Stream, error) {
+		return OpenContext(ctx, oauthClient, accessToken, urlStr, params, options...)
+	}, params, options)
+}
+
+// NewReconnectingBearerStream returns a reconnecting stream that uses
+// application-only authentication. The arguments have the same meaning as
+// the arguments to OpenBearer.
+func NewReconnectingBearerStream(bearerToken string, urlStr string, params url.Values, options ...OpenOption) *ReconnectingStream {
+	return newReconnectingStream(func(ctx context.Context, gap time.Duration, params url.Values) (*Stream, error) {
+		return OpenBearer(ctx, bearerToken, urlStr, params, options...)
+	}, params, options)
+}
+
+// NewReconnectingStreamFunc returns a reconnecting stream that calls connect
+// to open each connection. The connect function must create a new signed
+// request on each call. Use this function to wrap connection attempts with
+// instrumentation.
+//
+//  rs := twitterstream.NewReconnectingStreamFunc(connector.Connect)
+func NewReconnectingStreamFunc(connect func(ctx context.Context) (*Stream, error)) *ReconnectingStream {
+	rs := newReconnectingStream(func(ctx context.Context, gap time.Duration, params url.Values) (*Stream, error) {
+		return connect(ctx)
+	}, nil, nil)
+	rs.fixedParams = true
+	return rs
+}
+
+// newReconnectingStream returns a reconnecting stream that calls open to
+// connect. The params and options are the initial parameters and the options
+// passed to open.
+func newReconnectingStream(open func(ctx context.Context, gap time.Duration, params url.Values) (*Stream, error), params url.Values, options []OpenOption) *ReconnectingStream {
+	ctx, cancel := context.WithCancel(context.Background())
+	do := newOpenOptions(options)
+	return &ReconnectingStream{
+		open:        open,
+		params:      params,
+		ctx:         ctx,
+		cancel:      cancel,
+		logger:      do.logger,
+		onReconnect: do.onReconnect,
+	}
+}
+
+// stream returns the current connection, connecting as needed.
+func (rs *ReconnectingStream) stream() (*Stream, error) {
+	rs.mu.Lock()
+	ts, err, wait := rs.ts, rs.err, rs.wait
+	rs.wait = 0
+	rs.mu.Unlock()
+	if ts != nil || err != nil {
+		return ts, err
+	}
+
+	for {
+		if wait > 0 {
+			t := time.NewTimer(wait)
+			select {
+			case <-t.C:
+			case <-rs.ctx.Done():
+				t.Stop()
+				return nil, ErrStreamClosed
+			}
+		}
+
+		var gap time.Duration
+		if !rs.lastMessage.IsZero() {
+			gap = time.Since(rs.lastMessage)
+		}
+		rs.mu.Lock()
+		params := rs.params
+		rs.mu.Unlock()
+		ts, err := rs.open(rs.ctx, gap, params)
+
+		reconnected := false
+		rs.mu.Lock()
+		switch {
+		case rs.err != nil:
+			// Closed while connecting.
+			err = rs.err
+			if ts != nil {
+				ts.Close()
+			}
+		case err == nil:
+			rs.ts = ts
+			rs.connects++
+			reconnected = rs.connects > 1
+			if !rs.downSince.IsZero() {
+				rs.gaps = appendGap(rs.gaps, Gap{Kind: GapDisconnect, Start: rs.downSince, End: time.Now(), Err: rs.downErr})
+				rs.downSince = time.Time{}
+			}
+		case !IsTemporary(err):
+			rs.logger.Errorf("twitterstream: giving up after permanent error: %v", err)
+			rs.err = err
+		default:
+			wait = rs.backoff.next(err)
+			rs.logger.Infof("twitterstream: reconnecting in %v after error: %v", wait, err)
+			err = nil
+		}
+		rs.mu.Unlock()
+
+		if reconnected && rs.onReconnect != nil {
+			rs.onReconnect(gap)
+		}
+
+		if ts != nil || err != nil {
+			return ts, err
+		}
+	}
+}
+
+// drop discards a failed connection. If Twitter sent a disconnect notice
+// before closing the connection, then the notice determines whether the stream
+// reconnects immediately, reconnects after a delay or gives up.
+func (rs *ReconnectingStream) drop(ts *Stream) {
+	err := ts.Err()
+	ts.Close()
+	rs.mu.Lock()
+	defer rs.mu.Unlock()
+	rs.addStats(ts)
+	for _, g := range ts.Gaps() {
+		rs.gaps = appendGap(rs.gaps, g)
+	}
+	if rs.ts != nil && rs.ts != ts {
+		// Replaced by UpdateParams.
+		return
+	}
+	rs.ts = nil
+	if rs.downSince.IsZero() {
+		rs.downSince = ts.Stats().LastMessage
+		if rs.downSince.IsZero() {
+			rs.downSince = time.Now()
+		}
+		rs.downErr = err
+	}
+	connected := loadTime(&ts.stats.connected)
+	healthy := atomic.LoadInt64(&ts.stats.messages) > 0 ||
+		(!connected.IsZero() && time.Since(connected) >= minHealthyConnection)
+	if healthy {
+		rs.backoff.reset()
+	}
+	switch {
+	case rs.err != nil:
+	case !IsTemporary(err):
+		rs.logger.Errorf("twitterstream: connection closed with permanent error: %v", err)
+		rs.err = err
+	case isOverloaded(err) || !healthy:
+		rs.wait = rs.backoff.next(err)
+		rs.logger.Infof("twitterstream: connection dropped, reconnecting in %v: %v", rs.wait, err)
+	default:
+		rs.logger.Infof("twitterstream: connection dropped, reconnecting: %v", err)
+	}
+}
+
+var errFixedParams = errors.New("twitterstream: stream does not support UpdateParams")
+
+// UpdateParams changes the request parameters of the stream, for example to
+// change the track or follow terms. UpdateParams opens a new connection with
+// the parameters. After the new connection is established, the stream
+// switches to the new connection and closes the old connection. If the new
+// connection fails, then the stream continues on the old connection and
+// UpdateParams returns the error. UpdateParams can be called concurrently
+// with Next.
+//
+// Streams created with NewReconnectingStreamFunc do not support UpdateParams.
+func (rs *ReconnectingStream) UpdateParams(params url.Values) error {
+	if rs.fixedParams {
+		return errFixedParams
+	}
+	ts, err := rs.open(rs.ctx, 0, params)
+	if err != nil {
+		return err
+	}
+	rs.mu.Lock()
+	if rs.err != nil {
+		err := rs.err
+		rs.mu.Unlock()
+		ts.Close()
+		return err
+	}
+	old := rs.ts
+	rs.ts = ts
+	rs.params = params
+	rs.connects++
+	rs.mu.Unlock()
+	rs.logger.Infof("twitterstream: switched to connection with updated parameters")
+	if old != nil {
+		// The goroutine calling Next drops the old connection.
+		old.cancel(ErrStreamClosed)
+	}
+	return nil
+}
+
+// Next returns the next line from the stream, reconnecting as needed. The
+// returned slice is overwritten by the next call to Next. Next returns an
+// error if the stream is closed or if the endpoint returns an error for which
+// reconnecting is not expected to succeed. Next also returns
+// ErrMessageTooLarge as described for Stream.Next. See Stream.Next for the
+// aliasing of the returned slice.
+func (rs *ReconnectingStream) Next() ([]byte, error) {
+	_, p, err := rs.next()
+	return p, err
+}
+
+// next returns the next line from the stream and the connection that the line
+// was read from.
+func (rs *ReconnectingStream) next() (*Stream, []byte, error) {
+	for {
+		ts, err := rs.stream()
+		if err != nil {
+			return nil, nil, err
+		}
+		p, err := ts.Next()
+		if err == nil {
+			rs.lastMessage = time.Now()
+			return ts, p, nil
+		}
+		if err == ErrMessageTooLarge {
+			return nil, nil, err
+		}
+		rs.drop(ts)
+	}
+}
+
+// UnmarshalNext reads the next line of from the stream and decodes the line as
+// JSON to data.
+func (rs *ReconnectingStream) UnmarshalNext(data interface{}) error {
+	ts, p, err := rs.next()
+	if err != nil {
+		return err
+	}
+	if err := ts.decoder.Unmarshal(p, data); err != nil {
+		atomic.AddInt64(&rs.decodeErrors, 1)
+		return err
+	}
+	return nil
+}
+
+// DroppedCount returns the number of tweets matching the stream's filter that
+// were not delivered because of rate limits, summed over all connections.
+func (rs *ReconnectingStream) DroppedCount() int64 {
+	rs.mu.Lock()
+	defer rs.mu.Unlock()
+	n := rs.stats.Dropped
+	if rs.ts != nil {
+		n += rs.ts.DroppedCount()
+	}
+	return n
+}
+
+// Err returns a non-nil value if the stream has a permanent error.
+func (rs *ReconnectingStream) Err() error {
+	rs.mu.Lock()
+	defer rs.mu.Unlock()
+	return rs.err
+}
+
+// Close closes the current connection and stops further reconnect attempts.
+// Close can be called from another goroutine to interrupt a pending
+// reconnect or a blocked call to Next.
+func (rs *ReconnectingStream) Close() error {
+	rs.mu.Lock()
+	defer rs.mu.Unlock()
+	if rs.err == ErrStreamClosed {
+		return nil
+	}
+	rs.err = ErrStreamClosed
+	rs.cancel()
+	if rs.ts != nil {
+		rs.ts.flushCheckpoint()
+	}
+	rs.ts = nil
+	return nil
+}
@@ -0,0 +1,103 @@
+// Copyright 2010 Gary Burd
+//
+// Licensed under the Apache License, Version 2.0 (the "License"): you may
+// not use this file except in compliance with the License. You may obtain
+// a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+// WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the
+// License for the specific language governing permissions and limitations
+// under the License.
+
+package twitterstream
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+)
+
+// connDecoder records the connection that decoded a message.
+type connDecoder int
+
+func (d connDecoder) Unmarshal(p []byte, v interface{}) error {
+	*v.(*string) = fmt.Sprintf("%d:%s", d, p)
+	return nil
+}
+
+func TestReconnectUnmarshalNextDecoder(t *testing.T) {
+	n := 0
+	rs := NewReconnectingStreamFunc(func(ctx context.Context) (*Stream, error) {
+		n++
+		ts := newTestStream(strings.NewReader(fmt.Sprintf("m%d\r\n", n)))
+		ts.decoder = connDecoder(n)
+		return ts, nil
+	})
+	defer rs.Close()
+	for i := 1; i <= 3; i++ {
+		var s string
+		if err := rs.UnmarshalNext(&s); err != nil {
+			t.Fatal(err)
+		}
+		if want := fmt.Sprintf("%d:m%d", i, i); s != want {
+			t.Fatalf("UnmarshalNext = %q, want %q", s, want)
+		}
+		rs.mu.Lock()
+		rs.wait = 0 // do not sleep in the test
+		rs.mu.Unlock()
+	}
+}
+
+func TestReconnectBackoffAfterEmptyConnection(t *testing.T) {
+	body := ""
+	rs := NewReconnectingStreamFunc(func(ctx context.Context) (*Stream, error) {
+		return newTestStream(strings.NewReader(body)), nil
+	})
+	defer rs.Close()
+
+	// Connections that close before delivering a message back off.
+	var last time.Duration
+	for i := 0; i < 3; i++ {
+		ts, err := rs.stream()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := ts.Next(); err == nil {
+			t.Fatal("Next returned nil error for empty stream")
+		}
+		rs.drop(ts)
+		rs.mu.Lock()
+		wait := rs.wait
+		rs.wait = 0 // do not sleep in the test
+		rs.mu.Unlock()
+		if wait <= last {
+			t.Fatalf("drop %d: wait = %v, want more than %v", i, wait, last)
+		}
+		last = wait
+	}
+
+	// A connection that delivers a message resets the backoff.
+	body = "{\"id\":1}\r\n"
+	ts, err := rs.stream()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := ts.Next(); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := ts.Next(); err == nil {
+		t.Fatal("Next returned nil error at end of stream")
+	}
+	rs.drop(ts)
+	rs.mu.Lock()
+	wait := rs.wait
+	rs.mu.Unlock()
+	if wait != 0 {
+		t.Fatalf("wait after healthy connection = %v, want 0", wait)
+	}
+}
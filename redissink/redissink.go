@@ -0,0 +1,164 @@
+// Copyright 2010 Gary Burd
+//
+// Licensed under the Apache License, Version 2.0 (the "License"): you may
+// not use this file except in compliance with the License. You may obtain
+// a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+// WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the
+// License for the specific language governing permissions and limitations
+// under the License.
+
+// Package redissink writes the messages read from a twitterstream stream to
+// a Redis stream or publishes the messages to a Redis channel.
+//
+// The sink adds each message to the stream with XADD. The entry has the
+// fields "kind", the kind of the message, and "data", the message. Set
+// MaxLen to trim the stream as entries are added:
+//
+//  pool := &redis.Pool{
+//      Dial: func() (redis.Conn, error) { return redis.Dial("tcp", ":6379") },
+//  }
+//  s := &redissink.Sink{Pool: pool, Stream: "tweets", MaxLen: 100000}
+//  err := s.Run(ctx, ts.Messages(1000))
+//
+// Set Channel instead of Stream to PUBLISH the messages to subscribers.
+// Messages published to a channel are not stored by Redis.
+//
+// This repository does not have module files. Add the package's
+// dependency to the application's module to select its version:
+//
+//  go get github.com/gomodule/redigo
+package redissink
+
+import (
+	"context"
+	"errors"
+	"github.com/garyburd/twitterstream"
+	"github.com/gomodule/redigo/redis"
+	"io"
+)
+
+// Sink writes messages to Redis. The fields must not be changed after the
+// first message is written.
+type Sink struct {
+	// Pool is the pool of connections to Redis.
+	Pool *redis.Pool
+
+	// Stream is the key of the stream for XADD.
+	Stream string
+
+	// Channel is the channel for PUBLISH. Set one of Stream and Channel.
+	Channel string
+
+	// MaxLen is the maximum length of the stream. If MaxLen is greater
+	// than zero, then XADD trims the oldest entries from the stream. The
+	// trimming is approximate unless ExactMaxLen is true. Approximate
+	// trimming is much more efficient.
+	MaxLen      int64
+	ExactMaxLen bool
+
+	// BatchSize is the maximum number of commands sent in one pipeline. If
+	// zero, then 100 is used.
+	BatchSize int
+
+	// OnError is called with each message that could not be written. See
+	// twitterstream.Settle.
+	OnError func(m twitterstream.Message, err error)
+}
+
+var errNoKey = errors.New("redissink: Stream or Channel not set")
+
+// send sends the command for m to the connection.
+func (s *Sink) send(c redis.Conn, m twitterstream.Message) error {
+	switch {
+	case s.Stream != "":
+		args := []interface{}{s.Stream}
+		if s.MaxLen > 0 {
+			if s.ExactMaxLen {
+				args = append(args, "MAXLEN", s.MaxLen)
+			} else {
+				args = append(args, "MAXLEN", "~", s.MaxLen)
+			}
+		}
+		args = append(args, "*", "kind", m.Kind.String(), "data", []byte(m.Raw))
+		return c.Send("XADD", args...)
+	case s.Channel != "":
+		return c.Send("PUBLISH", s.Channel, []byte(m.Raw))
+	}
+	return errNoKey
+}
+
+// write writes a batch of messages using a pipeline. An error reply from
+// Redis applies to one message. Other errors apply to the remaining messages
+// in the batch.
+func (s *Sink) write(ctx context.Context, batch []twitterstream.Message) error {
+	c, err := s.Pool.GetContext(ctx)
+	if err != nil {
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		for _, m := range batch {
+			if err := twitterstream.Settle(m, err, s.OnError); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+	defer c.Close()
+
+	n := 0
+	for _, m := range batch {
+		if err = s.send(c, m); err != nil {
+			break
+		}
+		n++
+	}
+	if err == nil {
+		err = c.Flush()
+	}
+	for i, m := range batch {
+		merr := err
+		if i < n && err == nil {
+			_, merr = c.Receive()
+			var rerr redis.Error
+			if merr != nil && !errors.As(merr, &rerr) {
+				err = merr
+			}
+		}
+		if err := twitterstream.Settle(m, merr, s.OnError); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Write writes a single message.
+func (s *Sink) Write(ctx context.Context, m twitterstream.Message) error {
+	return s.write(ctx, []twitterstream.Message{m})
+}
+
+// Run writes the messages received from the channel until the channel is
+// closed or the context is done. Run pipelines the commands for the messages
+// that are waiting on the channel. Messages are acknowledged after Redis
+// replies to the command for the message.
+func (s *Sink) Run(ctx context.Context, messages <-chan twitterstream.Message) error {
+	n := s.BatchSize
+	if n <= 0 {
+		n = 100
+	}
+	for {
+		batch, err := twitterstream.Batch(ctx, messages, n)
+		if err == io.EOF {
+			return nil
+		} else if err != nil {
+			return err
+		}
+		if err := s.write(ctx, batch); err != nil {
+			return err
+		}
+	}
+}
@@ -0,0 +1,169 @@
+// Copyright 2010 Gary Burd
+//
+// Licensed under the Apache License, Version 2.0 (the "License"): you may
+// not use this file except in compliance with the License. You may obtain
+// a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+// WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the
+// License for the specific language governing permissions and limitations
+// under the License.
+
+package twitterstream
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"strings"
+)
+
+// FilteredStreamRulesV2URL is the Twitter API v2 endpoint for managing the
+// filtered stream rules.
+const FilteredStreamRulesV2URL = "https://api.twitter.com/2/tweets/search/stream/rules"
+
+// Rule is a v2 filtered stream rule.
+type Rule struct {
+	// ID is assigned by Twitter when the rule is added.
+	ID    string `json:"id,omitempty"`
+	Value string `json:"value"`
+	Tag   string `json:"tag,omitempty"`
+}
+
+// RulesError is returned when Twitter rejects some or all of the rules in a
+// request.
+type RulesError struct {
+	Errors []ErrorV2
+}
+
+func (err *RulesError) Error() string {
+	var msgs []string
+	for _, e := range err.Errors {
+		msg := e.Title
+		if e.Detail != "" {
+			msg += ": " + e.Detail
+		}
+		msgs = append(msgs, msg)
+	}
+	return "twitterstream: rules rejected: " + strings.Join(msgs, "; ")
+}
+
+// RulesClient manages the rules for the v2 filtered stream.
+type RulesClient struct {
+	// BearerToken is the application's bearer token.
+	BearerToken string
+
+	// HTTPClient is the client used for requests. If nil, then
+	// http.DefaultClient is used.
+	HTTPClient *http.Client
+
+	// URL is the rules endpoint. If empty, then FilteredStreamRulesV2URL is
+	// used.
+	URL string
+}
+
+type rulesResponse struct {
+	Data   []Rule    `json:"data"`
+	Errors []ErrorV2 `json:"errors"`
+}
+
+func (c *RulesClient) do(ctx context.Context, method string, dryRun bool, body interface{}) (*rulesResponse, error) {
+	urlStr := c.URL
+	if urlStr == "" {
+		urlStr = FilteredStreamRulesV2URL
+	}
+	if dryRun {
+		urlStr += "?dry_run=true"
+	}
+
+	var r io.Reader
+	if body != nil {
+		p, err := json.Marshal(body)
+		if err != nil {
+			return nil, err
+		}
+		r = bytes.NewReader(p)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, method, urlStr, r)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Authorization", "Bearer "+c.BearerToken)
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+
+	client := c.HTTPClient
+	if client == nil {
+		client = http.DefaultClient
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	p, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode != 200 && resp.StatusCode != 201 {
+		return nil, newHTTPStatusError(resp, p)
+	}
+
+	var v rulesResponse
+	if err := json.Unmarshal(p, &v); err != nil {
+		return nil, err
+	}
+	if len(v.Errors) > 0 {
+		return &v, &RulesError{Errors: v.Errors}
+	}
+	return &v, nil
+}
+
+// Rules returns the application's current rules.
+func (c *RulesClient) Rules(ctx context.Context) ([]Rule, error) {
+	v, err := c.do(ctx, "GET", false, nil)
+	if err != nil {
+		return nil, err
+	}
+	return v.Data, nil
+}
+
+// AddRules adds rules to the application's rule set and returns the added
+// rules with their assigned IDs. If dryRun is true, then Twitter validates the
+// rules without adding them. If Twitter rejects some of the rules, then
+// AddRules returns the accepted rules and a *RulesError.
+func (c *RulesClient) AddRules(ctx context.Context, rules []Rule, dryRun bool) ([]Rule, error) {
+	add := make([]Rule, len(rules))
+	for i, rule := range rules {
+		add[i] = Rule{Value: rule.Value, Tag: rule.Tag}
+	}
+	v, err := c.do(ctx, "POST", dryRun, map[string]interface{}{"add": add})
+	if v == nil {
+		return nil, err
+	}
+	return v.Data, err
+}
+
+// ValidateRules checks the syntax of rules without adding them to the
+// application's rule set.
+func (c *RulesClient) ValidateRules(ctx context.Context, rules []Rule) error {
+	_, err := c.AddRules(ctx, rules, true)
+	return err
+}
+
+// DeleteRules deletes the rules with the given IDs from the application's rule
+// set. If dryRun is true, then Twitter validates the request without deleting
+// the rules.
+func (c *RulesClient) DeleteRules(ctx context.Context, ids []string, dryRun bool) error {
+	body := map[string]interface{}{"delete": map[string]interface{}{"ids": ids}}
+	_, err := c.do(ctx, "POST", dryRun, body)
+	return err
+}
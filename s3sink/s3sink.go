@@ -0,0 +1,426 @@
+// Copyright 2010 Gary Burd
+//
+// Licensed under the Apache License, Version 2.0 (the "License"): you may
+// not use this file except in compliance with the License. You may obtain
+// a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+// WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the
+// License for the specific language governing permissions and limitations
+// under the License.
+
+// Package s3sink archives the messages read from a twitterstream stream in
+// S3 or S3-compatible object storage.
+//
+// The sink groups the messages by the hour in UTC that the message was
+// received and uploads each group as gzip-compressed newline-delimited JSON
+// objects with keys of the form:
+//
+//  <prefix>2021/03/04/05/part-N.json.gz
+//
+// The sink starts a new part when the uncompressed size of the current part
+// reaches MaxSize or the part's age reaches MaxAge.
+//
+//  client, err := minio.New("s3.amazonaws.com", &minio.Options{...})
+//  s := &s3sink.Sink{Client: client, Bucket: "archive", Prefix: "tweets/", Dir: "/var/lib/archive"}
+//  err = s.Run(ctx, ts.Messages(1000))
+//
+// The messages are written to a part file in the staging directory Dir
+// before the part is uploaded. Messages are acknowledged after they are
+// written to the part file. When Run starts, the sink uploads the parts left
+// in the staging directory by a previous run, including a part that was
+// being written when the previous run stopped. Part numbers continue after
+// the numbers of the objects in the bucket and in the staging directory, so
+// a restart does not overwrite an uploaded part.
+//
+// This repository does not have module files. Add the package's
+// dependency to the application's module to select its version:
+//
+//  go get github.com/minio/minio-go/v7
+package s3sink
+
+import (
+	"bufio"
+	"compress/gzip"
+	"context"
+	"github.com/garyburd/twitterstream"
+	"github.com/minio/minio-go/v7"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// File name suffixes in the staging directory.
+const (
+	writingSuffix  = ".jsonl.tmp"    // part being written
+	compressSuffix = ".json.gz.part" // part being compressed
+	uploadSuffix   = ".json.gz"      // part ready for upload
+)
+
+// Sink uploads messages to object storage. The fields must not be changed
+// after Run is called. Run must not be called concurrently.
+type Sink struct {
+	// Client is the client for the object storage.
+	Client *minio.Client
+
+	// Bucket is the bucket for the objects.
+	Bucket string
+
+	// Prefix is prepended to the object keys.
+	Prefix string
+
+	// Dir is the staging directory. The directory is created as needed.
+	Dir string
+
+	// MaxSize is the uncompressed size in bytes at which the sink starts a
+	// new part. If zero, then 64 MiB is used.
+	MaxSize int64
+
+	// MaxAge is the age at which the sink starts a new part. If zero, then
+	// a part is uploaded at the end of the hour.
+	MaxAge time.Duration
+
+	// Retries is the number of times a failed upload is retried. If zero,
+	// then three retries are made. Use a negative value to disable retries.
+	Retries int
+
+	cur   *part
+	parts map[string]int
+}
+
+// part is the part being written.
+type part struct {
+	hour   string
+	name   string
+	f      *os.File
+	w      *bufio.Writer
+	size   int64
+	opened time.Time
+}
+
+func hourPath(t time.Time) string {
+	return t.UTC().Format("2006/01/02/15")
+}
+
+// partNumber returns the number of the part with file or object name name.
+func partNumber(name string) (int, bool) {
+	if !strings.HasPrefix(name, "part-") {
+		return 0, false
+	}
+	name = name[len("part-"):]
+	if i := strings.IndexByte(name, '.'); i >= 0 {
+		name = name[:i]
+	}
+	n, err := strconv.Atoi(name)
+	return n, err == nil
+}
+
+// nextPart returns the next part number for the hour.
+func (s *Sink) nextPart(ctx context.Context, hour string) (int, error) {
+	if s.parts == nil {
+		s.parts = make(map[string]int)
+	}
+	n, ok := s.parts[hour]
+	if !ok {
+		for obj := range s.Client.ListObjects(ctx, s.Bucket, minio.ListObjectsOptions{Prefix: s.Prefix + hour + "/"}) {
+			if obj.Err != nil {
+				return 0, obj.Err
+			}
+			if i, ok := partNumber(path.Base(obj.Key)); ok && i >= n {
+				n = i + 1
+			}
+		}
+		entries, _ := os.ReadDir(filepath.Join(s.Dir, filepath.FromSlash(hour)))
+		for _, e := range entries {
+			if i, ok := partNumber(e.Name()); ok && i >= n {
+				n = i + 1
+			}
+		}
+	}
+	s.parts[hour] = n + 1
+	return n, nil
+}
+
+// open starts a new part for the hour.
+func (s *Sink) open(ctx context.Context, hour string) error {
+	n, err := s.nextPart(ctx, hour)
+	if err != nil {
+		return err
+	}
+	dir := filepath.Join(s.Dir, filepath.FromSlash(hour))
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return err
+	}
+	name := filepath.Join(dir, "part-"+strconv.Itoa(n))
+	f, err := os.OpenFile(name+writingSuffix, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0644)
+	if err != nil {
+		return err
+	}
+	s.cur = &part{hour: hour, name: name, f: f, w: bufio.NewWriterSize(f, 64*1024), opened: time.Now()}
+	return nil
+}
+
+// due returns true if the current part should be finished before writing a
+// message received at t.
+func (s *Sink) due(t time.Time) bool {
+	maxSize := s.MaxSize
+	if maxSize == 0 {
+		maxSize = 64 << 20
+	}
+	return s.cur != nil &&
+		(s.cur.hour != hourPath(t) ||
+			s.cur.size >= maxSize ||
+			(s.MaxAge > 0 && time.Since(s.cur.opened) >= s.MaxAge))
+}
+
+// write writes message m to the current part, starting a new part as needed.
+func (s *Sink) write(ctx context.Context, m twitterstream.Message) error {
+	t := m.Received
+	if t.IsZero() {
+		t = time.Now()
+	}
+	if s.due(t) {
+		if err := s.finish(ctx); err != nil {
+			return err
+		}
+	}
+	if s.cur == nil {
+		if err := s.open(ctx, hourPath(t)); err != nil {
+			return err
+		}
+	}
+	n, err := s.cur.w.Write(m.Raw)
+	if err == nil {
+		err = s.cur.w.WriteByte('\n')
+	}
+	s.cur.size += int64(n) + 1
+	return err
+}
+
+// finish closes, compresses and uploads the current part.
+func (s *Sink) finish(ctx context.Context) error {
+	p := s.cur
+	if p == nil {
+		return nil
+	}
+	s.cur = nil
+	err := p.w.Flush()
+	if err1 := p.f.Sync(); err == nil {
+		err = err1
+	}
+	if err1 := p.f.Close(); err == nil {
+		err = err1
+	}
+	if err != nil {
+		return err
+	}
+	if err := compress(p.name); err != nil {
+		return err
+	}
+	return s.upload(ctx, p.name)
+}
+
+// completeLength returns the length of the complete lines in f.
+func completeLength(f *os.File) (int64, error) {
+	fi, err := f.Stat()
+	if err != nil {
+		return 0, err
+	}
+	buf := make([]byte, 4096)
+	for end := fi.Size(); end > 0; {
+		start := end - int64(len(buf))
+		if start < 0 {
+			start = 0
+		}
+		n, err := f.ReadAt(buf[:end-start], start)
+		if err != nil && err != io.EOF {
+			return 0, err
+		}
+		for i := n - 1; i >= 0; i-- {
+			if buf[i] == '\n' {
+				return start + int64(i) + 1, nil
+			}
+		}
+		end = start
+	}
+	return 0, nil
+}
+
+// compress compresses the complete lines in the part being written to the
+// file for upload and removes the part being written.
+func compress(name string) error {
+	src, err := os.Open(name + writingSuffix)
+	if err != nil {
+		return err
+	}
+	defer src.Close()
+	n, err := completeLength(src)
+	if err != nil {
+		return err
+	}
+	dst, err := os.Create(name + compressSuffix)
+	if err != nil {
+		return err
+	}
+	defer dst.Close()
+	bw := bufio.NewWriterSize(dst, 64*1024)
+	zw := gzip.NewWriter(bw)
+	if _, err := io.Copy(zw, io.NewSectionReader(src, 0, n)); err != nil {
+		return err
+	}
+	if err := zw.Close(); err != nil {
+		return err
+	}
+	if err := bw.Flush(); err != nil {
+		return err
+	}
+	if err := dst.Sync(); err != nil {
+		return err
+	}
+	if err := os.Rename(name+compressSuffix, name+uploadSuffix); err != nil {
+		return err
+	}
+	return os.Remove(name + writingSuffix)
+}
+
+// upload uploads the compressed part and removes the part from the staging
+// directory.
+func (s *Sink) upload(ctx context.Context, name string) error {
+	rel, err := filepath.Rel(s.Dir, name+uploadSuffix)
+	if err != nil {
+		return err
+	}
+	key := s.Prefix + filepath.ToSlash(rel)
+	retries := s.Retries
+	if retries == 0 {
+		retries = 3
+	}
+	wait := time.Second
+	for attempt := 0; ; attempt++ {
+		_, err = s.Client.FPutObject(ctx, s.Bucket, key, name+uploadSuffix, minio.PutObjectOptions{ContentType: "application/gzip"})
+		if err == nil {
+			return os.Remove(name + uploadSuffix)
+		}
+		if attempt >= retries || ctx.Err() != nil {
+			return err
+		}
+		timer := time.NewTimer(wait)
+		select {
+		case <-timer.C:
+		case <-ctx.Done():
+			timer.Stop()
+			return ctx.Err()
+		}
+		wait *= 2
+	}
+}
+
+// resume completes and uploads the parts left in the staging directory by a
+// previous run.
+func (s *Sink) resume(ctx context.Context) error {
+	var writing, ready []string
+	err := filepath.Walk(s.Dir, func(p string, fi os.FileInfo, err error) error {
+		switch {
+		case err != nil:
+			if os.IsNotExist(err) && p == s.Dir {
+				return filepath.SkipDir
+			}
+			return err
+		case fi.IsDir():
+		case strings.HasSuffix(p, compressSuffix):
+			return os.Remove(p)
+		case strings.HasSuffix(p, writingSuffix):
+			writing = append(writing, strings.TrimSuffix(p, writingSuffix))
+		case strings.HasSuffix(p, uploadSuffix):
+			ready = append(ready, strings.TrimSuffix(p, uploadSuffix))
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	for _, name := range writing {
+		if err := compress(name); err != nil {
+			return err
+		}
+		ready = append(ready, name)
+	}
+	for _, name := range ready {
+		if err := s.upload(ctx, name); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Run writes the messages received from the channel until the channel is
+// closed or the context is done. Run first uploads the parts left by a
+// previous run. When the channel is closed, Run uploads the current part.
+// When the context is done, the current part is left in the staging
+// directory for the next run.
+func (s *Sink) Run(ctx context.Context, messages <-chan twitterstream.Message) error {
+	if err := s.resume(ctx); err != nil {
+		return err
+	}
+
+	var pending []twitterstream.Message
+	flush := func() error {
+		if s.cur != nil {
+			if err := s.cur.w.Flush(); err != nil {
+				return err
+			}
+		}
+		for _, m := range pending {
+			m.Ack()
+			m.Release()
+		}
+		pending = pending[:0]
+		return nil
+	}
+
+	ticker := time.NewTicker(time.Minute)
+	defer ticker.Stop()
+	for {
+		select {
+		case m, ok := <-messages:
+			if !ok {
+				if err := flush(); err != nil {
+					return err
+				}
+				return s.finish(ctx)
+			}
+			if err := s.write(ctx, m); err != nil {
+				return err
+			}
+			pending = append(pending, m)
+			if len(messages) == 0 {
+				if err := flush(); err != nil {
+					return err
+				}
+			}
+		case <-ticker.C:
+			if s.due(time.Now()) {
+				if err := flush(); err != nil {
+					return err
+				}
+				if err := s.finish(ctx); err != nil {
+					return err
+				}
+			}
+		case <-ctx.Done():
+			flush()
+			if s.cur != nil {
+				s.cur.f.Close()
+				s.cur = nil
+			}
+			return ctx.Err()
+		}
+	}
+}
@@ -0,0 +1,85 @@
+// Copyright 2010 Gary Burd
+//
+// Licensed under the Apache License, Version 2.0 (the "License"): you may
+// not use this file except in compliance with the License. You may obtain
+// a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+// WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the
+// License for the specific language governing permissions and limitations
+// under the License.
+
+package twitterstream
+
+import (
+	"sync"
+	"time"
+)
+
+// sampleScale is the resolution of the sample percentage.
+const sampleScale = 1000000
+
+// SampleFilter returns a filter that delivers the given percentage of
+// tweets. The selection is a hash of the tweet ID, so every process sampling
+// a stream with the same percentage selects the same tweets, and a tweet
+// selected at a percentage is also selected at all higher percentages.
+// Notices and lines without a tweet ID are delivered.
+func SampleFilter(percent float64) Filter {
+	threshold := uint64(percent / 100 * sampleScale)
+	return func(p []byte) bool {
+		id, ok := tweetID(p)
+		if !ok {
+			return true
+		}
+		return mix64(uint64(id))%sampleScale < threshold
+	}
+}
+
+// RateFilter returns a filter that delivers at most perSecond tweets per
+// second on average with bursts of up to burst tweets. A burst less than one
+// is treated as one. Tweets over the rate are rejected. Notices are delivered
+// and do not count against the rate. Use RateFilter to protect a downstream
+// system that cannot accept the full volume of the stream.
+func RateFilter(perSecond float64, burst int) Filter {
+	if burst < 1 {
+		burst = 1
+	}
+	tb := &tokenBucket{rate: perSecond, burst: float64(burst), tokens: float64(burst)}
+	return func(p []byte) bool {
+		if isNotice(p) {
+			return true
+		}
+		return tb.take(time.Now())
+	}
+}
+
+// tokenBucket is a token bucket rate limiter.
+type tokenBucket struct {
+	mu     sync.Mutex
+	rate   float64
+	burst  float64
+	tokens float64
+	last   time.Time
+}
+
+// take removes a token from the bucket. The function returns false if the
+// bucket is empty.
+func (tb *tokenBucket) take(now time.Time) bool {
+	tb.mu.Lock()
+	defer tb.mu.Unlock()
+	if !tb.last.IsZero() {
+		tb.tokens += now.Sub(tb.last).Seconds() * tb.rate
+		if tb.tokens > tb.burst {
+			tb.tokens = tb.burst
+		}
+	}
+	tb.last = now
+	if tb.tokens < 1 {
+		return false
+	}
+	tb.tokens--
+	return true
+}
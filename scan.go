@@ -0,0 +1,399 @@
+// Copyright 2010 Gary Burd
+//
+// Licensed under the Apache License, Version 2.0 (the "License"): you may
+// not use this file except in compliance with the License. You may obtain
+// a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+// WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the
+// License for the specific language governing permissions and limitations
+// under the License.
+
+package twitterstream
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"strconv"
+	"unicode/utf16"
+	"unicode/utf8"
+)
+
+// The functions in this file find fields in a JSON document without decoding
+// the document. The functions assume that the document is valid JSON and
+// return false for documents that cannot be scanned.
+
+// skipSpace returns the index of the first non-whitespace byte in p at or
+// after i.
+func skipSpace(p []byte, i int) int {
+	for i < len(p) {
+		switch p[i] {
+		case ' ', '\t', '\r', '\n':
+			i++
+		default:
+			return i
+		}
+	}
+	return i
+}
+
+// skipString returns the index after the string starting at p[i].
+func skipString(p []byte, i int) (int, bool) {
+	start := i
+	for i++; i < len(p); i++ {
+		j := bytes.IndexByte(p[i:], '"')
+		if j < 0 {
+			break
+		}
+		i += j
+		// The quote ends the string if it is preceded by an even number
+		// of backslashes.
+		n := 0
+		for k := i - 1; k > start && p[k] == '\\'; k-- {
+			n++
+		}
+		if n%2 == 0 {
+			return i + 1, true
+		}
+	}
+	return 0, false
+}
+
+// skipValue returns the index after the value starting at p[i].
+func skipValue(p []byte, i int) (int, bool) {
+	if i >= len(p) {
+		return 0, false
+	}
+	switch p[i] {
+	case '"':
+		return skipString(p, i)
+	case '{', '[':
+		depth := 0
+		for i < len(p) {
+			switch p[i] {
+			case '"':
+				var ok bool
+				if i, ok = skipString(p, i); !ok {
+					return 0, false
+				}
+				continue
+			case '{', '[':
+				depth++
+			case '}', ']':
+				depth--
+				if depth == 0 {
+					return i + 1, true
+				}
+			}
+			i++
+		}
+		return 0, false
+	}
+	j := i
+	for j < len(p) {
+		switch p[j] {
+		case ',', '}', ']', ' ', '\t', '\r', '\n':
+			return j, j > i
+		}
+		j++
+	}
+	return j, j > i
+}
+
+// objectField returns the raw value of the named field in the JSON object p.
+// Nested objects are not searched.
+func objectField(p []byte, name string) ([]byte, bool) {
+	i := skipSpace(p, 0)
+	if i >= len(p) || p[i] != '{' {
+		return nil, false
+	}
+	i = skipSpace(p, i+1)
+	if i < len(p) && p[i] == '}' {
+		return nil, false
+	}
+	for i < len(p) && p[i] == '"' {
+		end, ok := skipString(p, i)
+		if !ok {
+			return nil, false
+		}
+		key := p[i+1 : end-1]
+		i = skipSpace(p, end)
+		if i >= len(p) || p[i] != ':' {
+			return nil, false
+		}
+		i = skipSpace(p, i+1)
+		end, ok = skipValue(p, i)
+		if !ok {
+			return nil, false
+		}
+		if string(key) == name {
+			return p[i:end], true
+		}
+		i = skipSpace(p, end)
+		if i >= len(p) || p[i] != ',' {
+			return nil, false
+		}
+		i = skipSpace(p, i+1)
+	}
+	return nil, false
+}
+
+// rawString decodes the raw JSON string v.
+func rawString(v []byte) (string, bool) {
+	if len(v) < 2 || v[0] != '"' {
+		return "", false
+	}
+	if s, ok := unquote(v); ok {
+		return s, true
+	}
+	var s string
+	if json.Unmarshal(v, &s) != nil {
+		return "", false
+	}
+	return s, true
+}
+
+// unquote decodes the raw JSON string v. The function returns false if the
+// string contains invalid UTF-8 or an invalid escape sequence.
+func unquote(v []byte) (string, bool) {
+	if len(v) < 2 || v[0] != '"' || v[len(v)-1] != '"' {
+		return "", false
+	}
+	v = v[1 : len(v)-1]
+	if !utf8.Valid(v) {
+		return "", false
+	}
+	i := bytes.IndexByte(v, '\\')
+	if i < 0 {
+		return string(v), true
+	}
+	buf := make([]byte, 0, len(v))
+	for {
+		buf = append(buf, v[:i]...)
+		v = v[i:]
+		if len(v) < 2 {
+			return "", false
+		}
+		switch c := v[1]; c {
+		case '"', '\\', '/':
+			buf = append(buf, c)
+		case 'b':
+			buf = append(buf, '\b')
+		case 'f':
+			buf = append(buf, '\f')
+		case 'n':
+			buf = append(buf, '\n')
+		case 'r':
+			buf = append(buf, '\r')
+		case 't':
+			buf = append(buf, '\t')
+		case 'u':
+			r, n := unquoteRune(v)
+			if n == 0 {
+				return "", false
+			}
+			buf = utf8.AppendRune(buf, r)
+			v = v[n-2:]
+		default:
+			return "", false
+		}
+		v = v[2:]
+		i = bytes.IndexByte(v, '\\')
+		if i < 0 {
+			buf = append(buf, v...)
+			return string(buf), true
+		}
+	}
+}
+
+// unquoteRune decodes the \u escape sequence at the start of v and a
+// following low surrogate escape sequence. The function returns the rune and
+// the number of bytes consumed or zero if the sequence is not valid.
+func unquoteRune(v []byte) (rune, int) {
+	r := hex4(v, 2)
+	if r < 0 {
+		return 0, 0
+	}
+	if utf16.IsSurrogate(r) {
+		if len(v) >= 12 && v[6] == '\\' && v[7] == 'u' {
+			if r2 := hex4(v, 8); r2 >= 0 {
+				if rr := utf16.DecodeRune(r, r2); rr != utf8.RuneError {
+					return rr, 12
+				}
+			}
+		}
+		return utf8.RuneError, 6
+	}
+	return r, 6
+}
+
+// hex4 decodes four hexadecimal digits in v starting at i or returns -1.
+func hex4(v []byte, i int) rune {
+	if len(v) < i+4 {
+		return -1
+	}
+	var r rune
+	for _, c := range v[i : i+4] {
+		switch {
+		case c >= '0' && c <= '9':
+			c -= '0'
+		case c >= 'a' && c <= 'f':
+			c = c - 'a' + 10
+		case c >= 'A' && c <= 'F':
+			c = c - 'A' + 10
+		default:
+			return -1
+		}
+		r = r<<4 | rune(c)
+	}
+	return r
+}
+
+// tweetObject returns the tweet object in a message. The tweet object of a v2
+// message is the value of the data field. Other messages are returned as is.
+func tweetObject(p []byte) []byte {
+	if v, ok := objectField(p, "data"); ok && len(v) > 0 && v[0] == '{' {
+		return v
+	}
+	return p
+}
+
+// noticeKeys are the keys of the notices sent on the v1.1 streams.
+var noticeKeys = map[string]bool{
+	"delete":          true,
+	"scrub_geo":       true,
+	"limit":           true,
+	"status_withheld": true,
+	"user_withheld":   true,
+	"disconnect":      true,
+	"warning":         true,
+	"friends":         true,
+	"friends_str":     true,
+	"event":           true,
+	"control":         true,
+	"for_user":        true,
+}
+
+// isNotice returns true if the first field of the JSON object p is the key
+// of a notice.
+func isNotice(p []byte) bool {
+	i := skipSpace(p, 0)
+	if i >= len(p) || p[i] != '{' {
+		return false
+	}
+	i = skipSpace(p, i+1)
+	if i >= len(p) || p[i] != '"' {
+		return false
+	}
+	end, ok := skipString(p, i)
+	return ok && noticeKeys[string(p[i+1:end-1])]
+}
+
+// arrayElements calls fn with the raw value of each element of the JSON array
+// p until fn returns false. The function returns false if p is not an array.
+func arrayElements(p []byte, fn func(v []byte) bool) bool {
+	i := skipSpace(p, 0)
+	if i >= len(p) || p[i] != '[' {
+		return false
+	}
+	i = skipSpace(p, i+1)
+	if i < len(p) && p[i] == ']' {
+		return true
+	}
+	for i < len(p) {
+		end, ok := skipValue(p, i)
+		if !ok {
+			return false
+		}
+		if !fn(p[i:end]) {
+			return true
+		}
+		i = skipSpace(p, end)
+		if i >= len(p) || p[i] != ',' {
+			return i < len(p) && p[i] == ']'
+		}
+		i = skipSpace(p, i+1)
+	}
+	return false
+}
+
+// lookupPath returns the raw value at the path in the JSON document p. A
+// path element is an object field name or the decimal index of an array
+// element.
+func lookupPath(p []byte, path []string) ([]byte, bool) {
+	for _, name := range path {
+		i := skipSpace(p, 0)
+		if i < len(p) && p[i] == '[' {
+			n, err := strconv.Atoi(name)
+			if err != nil || n < 0 {
+				return nil, false
+			}
+			var v []byte
+			arrayElements(p, func(e []byte) bool {
+				if n == 0 {
+					v = e
+					return false
+				}
+				n--
+				return true
+			})
+			if v == nil {
+				return nil, false
+			}
+			p = v
+			continue
+		}
+		var ok bool
+		if p, ok = objectField(p, name); !ok {
+			return nil, false
+		}
+	}
+	return p, true
+}
+
+// objectEach calls fn with the key and raw value of each field of the JSON
+// object p. The key is not unescaped.
+func objectEach(p []byte, fn func(key, v []byte) error) error {
+	i := skipSpace(p, 0)
+	if i >= len(p) || p[i] != '{' {
+		return errScan
+	}
+	i = skipSpace(p, i+1)
+	if i < len(p) && p[i] == '}' {
+		return nil
+	}
+	for i < len(p) && p[i] == '"' {
+		end, ok := skipString(p, i)
+		if !ok {
+			return errScan
+		}
+		key := p[i+1 : end-1]
+		i = skipSpace(p, end)
+		if i >= len(p) || p[i] != ':' {
+			return errScan
+		}
+		i = skipSpace(p, i+1)
+		end, ok = skipValue(p, i)
+		if !ok {
+			return errScan
+		}
+		if err := fn(key, p[i:end]); err != nil {
+			return err
+		}
+		i = skipSpace(p, end)
+		if i < len(p) && p[i] == '}' {
+			return nil
+		}
+		if i >= len(p) || p[i] != ',' {
+			return errScan
+		}
+		i = skipSpace(p, i+1)
+	}
+	return errScan
+}
+
+var errScan = errors.New("twitterstream: invalid JSON object")
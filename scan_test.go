@@ -0,0 +1,198 @@
+// Copyright 2010 Gary Burd
+//
+// Licensed under the Apache License, Version 2.0 (the "License"): you may
+// not use this file except in compliance with the License. You may obtain
+// a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+// WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the
+// License for the specific language governing permissions and limitations
+// under the License.
+
+package twitterstream
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+)
+
+var objectFieldTests = []struct {
+	p, name string
+	want    string
+	ok      bool
+}{
+	{`{"a":1,"b":2}`, "b", `2`, true},
+	{`{"a":1,"b":2}`, "c", ``, false},
+	{` { "a" : "x" , "b" : [ 1 , 2 ] } `, "b", `[ 1 , 2 ]`, true},
+	{"{\n\t\"a\":\r\n{}\n}", "a", `{}`, true},
+	{`{"a":"q\"","b":3}`, "b", `3`, true},
+	{`{"a":"\\","b":3}`, "b", `3`, true},
+	{`{"a":"\\\"}","b":3}`, "b", `3`, true},
+	{`{"a\"b":1,"b":2}`, "b", `2`, true},
+	{`{"a":{"b":1},"b":2}`, "b", `2`, true},
+	{`{"a":[[1,[2]],{"b":"]"}],"b":2}`, "b", `2`, true},
+	{`{"a":"}","b":{"c":"{"}}`, "b", `{"c":"{"}`, true},
+	{`{"a":true,"b":null}`, "b", `null`, true},
+	{`{"a":-1.5e3,"b":false}`, "a", `-1.5e3`, true},
+	{`{}`, "a", ``, false},
+	{`[]`, "a", ``, false},
+	{`"a"`, "a", ``, false},
+	{``, "a", ``, false},
+
+	// Truncated input.
+	{`{"a":1,"b":`, "b", ``, false},
+	{`{"a":1,"b"`, "b", ``, false},
+	{`{"a":"x`, "a", ``, false},
+	{`{"a":[1,2`, "a", ``, false},
+	{`{"a":{"b":1}`, "a", `{"b":1}`, true},
+	{`{"a":"\"`, "a", ``, false},
+	{`{"a":1,"b`, "b", ``, false},
+}
+
+func TestObjectField(t *testing.T) {
+	for _, tt := range objectFieldTests {
+		v, ok := objectField([]byte(tt.p), tt.name)
+		if ok != tt.ok || string(v) != tt.want {
+			t.Errorf("objectField(%s, %q) = %s, %v, want %s, %v", tt.p, tt.name, v, ok, tt.want, tt.ok)
+		}
+	}
+}
+
+var lookupPathTests = []struct {
+	p, path string
+	want    string
+	ok      bool
+}{
+	{`{"a":{"b":{"c":1}}}`, "a.b.c", `1`, true},
+	{`{"a":{"b":{"c":1}}}`, "a.b", `{"c":1}`, true},
+	{`{"a":{"b":{"c":1}}}`, "a.x.c", ``, false},
+	{`{"a":[10,20,30]}`, "a.0", `10`, true},
+	{`{"a":[10,20,30]}`, "a.2", `30`, true},
+	{`{"a":[10,20,30]}`, "a.3", ``, false},
+	{`{"a":[10,20,30]}`, "a.-1", ``, false},
+	{`{"a":[10,20,30]}`, "a.x", ``, false},
+	{`{"a":[[1,2],[3,[4,5]]]}`, "a.1.1.0", `4`, true},
+	{`{"a":[{"b":"x"},{"b":"y"}]}`, "a.1.b", `"y"`, true},
+	{` { "a" : [ { "b" : "y" } ] } `, "a.0.b", `"y"`, true},
+	{`{"a":[]}`, "a.0", ``, false},
+	{`{"a":1}`, "a.b", ``, false},
+	{`{"a":"s"}`, "a.0", ``, false},
+	{`{"a":[1,2`, "a.0", ``, false},
+	{`{"a":{"b":`, "a.b", ``, false},
+}
+
+func TestLookupPath(t *testing.T) {
+	for _, tt := range lookupPathTests {
+		v, ok := lookupPath([]byte(tt.p), strings.Split(tt.path, "."))
+		if ok != tt.ok || string(v) != tt.want {
+			t.Errorf("lookupPath(%s, %q) = %s, %v, want %s, %v", tt.p, tt.path, v, ok, tt.want, tt.ok)
+		}
+	}
+}
+
+var unquoteTests = []struct {
+	v    string
+	want string
+	ok   bool
+}{
+	{`""`, "", true},
+	{`"abc"`, "abc", true},
+	{`"café"`, "café", true},
+	{`"\"\\\/\b\f\n\r\t"`, "\"\\/\b\f\n\r\t", true},
+	{`"a\"b"`, `a"b`, true},
+	{`"a\\"`, `a\`, true},
+	{`"\u00e9\u4e2d"`, "é中", true},
+	{`"A\u0000"`, "A\x00", true},
+	{`"\ud83d\ude00"`, "😀", true},
+	{`"x\uD83D\uDE00y"`, "x😀y", true},
+	{`"\ud83d"`, "�", true},
+	{`"\ude00"`, "�", true},
+	{`"a\ud83db"`, "a�b", true},
+	{`"\ud83dA"`, "�A", true},
+	{`"\ud83d\u0041"`, "�A", true},
+	{`"\ud83d\ud83d\ude00"`, "�😀", true},
+	{`"\ude00\ud83d"`, "��", true},
+	{`"\u12"`, "", false},
+	{`"\u12g4"`, "", false},
+	{`"\x"`, "", false},
+	{`"\"`, "", false},
+	{"\"a\xffb\"", "", false},
+	{`"abc`, "", false},
+	{`abc`, "", false},
+	{`"`, "", false},
+}
+
+func TestUnquote(t *testing.T) {
+	for _, tt := range unquoteTests {
+		s, ok := unquote([]byte(tt.v))
+		if ok != tt.ok || s != tt.want {
+			t.Errorf("unquote(%s) = %q, %v, want %q, %v", tt.v, s, ok, tt.want, tt.ok)
+		}
+		if !ok {
+			continue
+		}
+		var js string
+		if err := json.Unmarshal([]byte(tt.v), &js); err != nil || js != s {
+			t.Errorf("unquote(%s) = %q, encoding/json returned %q, %v", tt.v, s, js, err)
+		}
+	}
+}
+
+var skipValueTests = []struct {
+	p    string
+	want int
+	ok   bool
+}{
+	{`1,`, 1, true},
+	{`-12.5e3}`, 7, true},
+	{`true]`, 4, true},
+	{`null `, 4, true},
+	{`123`, 3, true},
+	{`"a\"b",`, 6, true},
+	{`"a\\",`, 5, true},
+	{`{"a":"}"},`, 9, true},
+	{`[1,[2,[3]],"]"],`, 15, true},
+	{`{"a":[{"b":{}}]} `, 16, true},
+	{`"abc`, 0, false},
+	{`{"a":1`, 0, false},
+	{`[1,[2]`, 0, false},
+	{`{"a":"}`, 0, false},
+	{``, 0, false},
+	{`,`, 0, false},
+}
+
+func TestSkipValue(t *testing.T) {
+	for _, tt := range skipValueTests {
+		end, ok := skipValue([]byte(tt.p), 0)
+		if ok != tt.ok || (ok && end != tt.want) {
+			t.Errorf("skipValue(%s) = %d, %v, want %d, %v", tt.p, end, ok, tt.want, tt.ok)
+		}
+	}
+}
+
+func TestArrayElements(t *testing.T) {
+	for _, tt := range []struct {
+		p    string
+		want []string
+		ok   bool
+	}{
+		{`[]`, nil, true},
+		{` [ 1 , "a,b" , [2,3] , {"c":[4]} ] `, []string{`1`, `"a,b"`, `[2,3]`, `{"c":[4]}`}, true},
+		{`[1,2`, []string{`1`, `2`}, false},
+		{`[1,`, []string{`1`}, false},
+		{`{}`, nil, false},
+	} {
+		var got []string
+		ok := arrayElements([]byte(tt.p), func(v []byte) bool {
+			got = append(got, string(v))
+			return true
+		})
+		if ok != tt.ok || strings.Join(got, " ") != strings.Join(tt.want, " ") {
+			t.Errorf("arrayElements(%s) = %q, %v, want %q, %v", tt.p, got, ok, tt.want, tt.ok)
+		}
+	}
+}
@@ -0,0 +1,114 @@
+// Copyright 2010 Gary Burd
+//
+// Licensed under the Apache License, Version 2.0 (the "License"): you may
+// not use this file except in compliance with the License. You may obtain
+// a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+// WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the
+// License for the specific language governing permissions and limitations
+// under the License.
+
+package twitterstream
+
+import (
+	"hash/fnv"
+	"sort"
+	"strconv"
+)
+
+// TweetKey returns the ID of the v1.1 or v2 tweet in m. TweetKey returns ""
+// if the message is not a tweet.
+func TweetKey(m Message) string {
+	if id, ok := tweetID(m.Raw); ok {
+		return strconv.FormatInt(id, 10)
+	}
+	return ""
+}
+
+// shardReplicas is the number of points on the hash ring for each shard.
+const shardReplicas = 100
+
+// hashRing maps keys to shards using consistent hashing. When the number of
+// shards changes, only the keys on the added or removed shards move.
+type hashRing struct {
+	points []uint32
+	shards []int
+}
+
+func hashKey(s string) uint32 {
+	h := fnv.New32a()
+	h.Write([]byte(s))
+	return h.Sum32()
+}
+
+func newHashRing(n int) *hashRing {
+	r := &hashRing{}
+	type point struct {
+		hash  uint32
+		shard int
+	}
+	var points []point
+	for i := 0; i < n; i++ {
+		for j := 0; j < shardReplicas; j++ {
+			points = append(points, point{hashKey(strconv.Itoa(i) + "-" + strconv.Itoa(j)), i})
+		}
+	}
+	sort.Slice(points, func(i, j int) bool { return points[i].hash < points[j].hash })
+	for _, p := range points {
+		r.points = append(r.points, p.hash)
+		r.shards = append(r.shards, p.shard)
+	}
+	return r
+}
+
+// shard returns the shard for key.
+func (r *hashRing) shard(key string) int {
+	h := hashKey(key)
+	i := sort.Search(len(r.points), func(i int) bool { return r.points[i] >= h })
+	if i == len(r.points) {
+		i = 0
+	}
+	return r.shards[i]
+}
+
+// Shard routes the messages received from messages to n output channels by
+// the key returned from the key function. Messages with the same key are sent
+// to the same channel in the order received. Messages with an empty key are
+// distributed round robin. Use UserKey, TweetKey or an application function
+// for the key. The channels are closed after messages is closed.
+//
+// Keys are assigned to channels with consistent hashing. A slow consumer on
+// one channel blocks delivery to all channels.
+func Shard(messages <-chan Message, n int, key func(Message) string) []<-chan Message {
+	if n < 1 {
+		n = 1
+	}
+	ring := newHashRing(n)
+	shards := make([]chan Message, n)
+	result := make([]<-chan Message, n)
+	for i := range shards {
+		shards[i] = make(chan Message, 16)
+		result[i] = shards[i]
+	}
+	go func() {
+		next := 0
+		for m := range messages {
+			var i int
+			if k := key(m); k != "" {
+				i = ring.shard(k)
+			} else {
+				i = next
+				next = (next + 1) % n
+			}
+			shards[i] <- m
+		}
+		for _, c := range shards {
+			close(c)
+		}
+	}()
+	return result
+}
@@ -0,0 +1,347 @@
+// Copyright 2010 Gary Burd
+//
+// Licensed under the Apache License, Version 2.0 (the "License"): you may
+// not use this file except in compliance with the License. You may obtain
+// a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+// WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the
+// License for the specific language governing permissions and limitations
+// under the License.
+
+package twitterstream
+
+import (
+	"bufio"
+	"compress/gzip"
+	"errors"
+	"os"
+	"path/filepath"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// FileSink writes messages to newline-delimited JSON files in a directory.
+// The sink starts a new file when the current file reaches MaxSize bytes or
+// MaxAge in age. A file is written with the suffix ".tmp" and is renamed to
+// its final name when the file is complete, so the files with the final name
+// are always whole. Files named "<prefix>-<time>.jsonl" sort in the order
+// written. A ".tmp" file left by a crash holds the messages written before
+// the crash up to the last flush.
+//
+// If Compress is true, then the files are compressed with gzip and named
+// "<prefix>-<time>.jsonl.gz". Each file is a complete gzip stream. A
+// compressed ".tmp" file left by a crash can be read up to the last flush.
+//
+// The fields must not be changed after the first write. The methods are safe
+// for concurrent use.
+//
+//  sink := &twitterstream.FileSink{Dir: "archive", MaxSize: 1 << 30, MaxAge: time.Hour}
+//  defer sink.Close()
+//  err := sink.WriteMessages(ts.Messages(1000))
+//
+// The sink can also be used with the OpenTee option to archive every message
+// read from the stream:
+//
+//  ts, err := twitterstream.Open(..., twitterstream.OpenTee(sink))
+type FileSink struct {
+	// Dir is the directory for the files. The directory is created as
+	// needed.
+	Dir string
+
+	// Prefix is the prefix of the file names. If empty, then "tweets" is
+	// used.
+	Prefix string
+
+	// MaxSize is the size in bytes at which the sink starts a new file. If
+	// zero, then the size is not limited.
+	MaxSize int64
+
+	// MaxAge is the time after which the sink starts a new file. The age
+	// is checked when a message is written. If zero, then the age is not
+	// limited.
+	MaxAge time.Duration
+
+	// Compress specifies whether the files are compressed with gzip.
+	// MaxSize applies to the size before compression.
+	Compress bool
+
+	// CompressionLevel is the gzip compression level, from
+	// gzip.BestSpeed to gzip.BestCompression. If zero, then
+	// gzip.DefaultCompression is used.
+	CompressionLevel int
+
+	// FlushInterval is the maximum time that written messages are held in
+	// the sink's buffers before they are written to the file. Flushing a
+	// compressed file reduces the compression ratio. If zero, then
+	// messages are written when the buffers are full, when Flush is called
+	// and when the file is complete.
+	FlushInterval time.Duration
+
+	mu     sync.Mutex
+	f      *os.File
+	bw     *bufio.Writer
+	gz     *gzip.Writer
+	name   string
+	size   int64
+	opened time.Time
+	timer  *time.Timer
+	closed bool
+
+	// Error from a timed flush, returned by the next call to a write
+	// method, Flush or Close.
+	flushErr error
+}
+
+var errSinkClosed = errors.New("twitterstream: sink closed")
+
+// open starts a new file.
+func (s *FileSink) open(now time.Time) error {
+	if err := os.MkdirAll(s.Dir, 0755); err != nil {
+		return err
+	}
+	prefix := s.Prefix
+	if prefix == "" {
+		prefix = "tweets"
+	}
+	base := filepath.Join(s.Dir, prefix+"-"+now.UTC().Format("20060102T150405.000000Z"))
+	ext := ".jsonl"
+	if s.Compress {
+		ext = ".jsonl.gz"
+	}
+	name := base + ext
+	for i := 1; ; i++ {
+		_, err := os.Stat(name)
+		if os.IsNotExist(err) {
+			_, err = os.Stat(name + ".tmp")
+		}
+		if os.IsNotExist(err) {
+			break
+		}
+		if err != nil {
+			return err
+		}
+		name = base + "-" + strconv.Itoa(i) + ext
+	}
+	f, err := os.OpenFile(name+".tmp", os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0644)
+	if err != nil {
+		return err
+	}
+	if s.bw == nil {
+		s.bw = bufio.NewWriterSize(f, 64*1024)
+	} else {
+		s.bw.Reset(f)
+	}
+	if s.Compress {
+		level := s.CompressionLevel
+		if level == 0 {
+			level = gzip.DefaultCompression
+		}
+		if s.gz == nil {
+			s.gz, err = gzip.NewWriterLevel(s.bw, level)
+			if err != nil {
+				f.Close()
+				os.Remove(name + ".tmp")
+				return err
+			}
+		} else {
+			s.gz.Reset(s.bw)
+		}
+	}
+	s.f = f
+	s.name = name
+	s.size = 0
+	s.opened = now
+	return nil
+}
+
+// finish flushes, closes and renames the current file.
+func (s *FileSink) finish() error {
+	if s.f == nil {
+		return nil
+	}
+	f := s.f
+	s.f = nil
+	var err error
+	if s.gz != nil {
+		err = s.gz.Close()
+	}
+	if err1 := s.bw.Flush(); err == nil {
+		err = err1
+	}
+	if err1 := f.Sync(); err == nil {
+		err = err1
+	}
+	if err1 := f.Close(); err == nil {
+		err = err1
+	}
+	if err != nil {
+		return err
+	}
+	return os.Rename(s.name+".tmp", s.name)
+}
+
+// write writes p to the current file, rotating the file as needed. The slice
+// p holds one or more complete lines.
+func (s *FileSink) write(p []byte) (int, error) {
+	if s.closed {
+		return 0, errSinkClosed
+	}
+	if err := s.takeFlushErr(); err != nil {
+		return 0, err
+	}
+	now := time.Now()
+	if s.f != nil &&
+		((s.MaxSize > 0 && s.size > 0 && s.size+int64(len(p)) > s.MaxSize) ||
+			(s.MaxAge > 0 && now.Sub(s.opened) >= s.MaxAge)) {
+		if err := s.finish(); err != nil {
+			return 0, err
+		}
+	}
+	if s.f == nil {
+		if err := s.open(now); err != nil {
+			return 0, err
+		}
+	}
+	var n int
+	var err error
+	if s.gz != nil {
+		n, err = s.gz.Write(p)
+	} else {
+		n, err = s.bw.Write(p)
+	}
+	s.size += int64(n)
+	if s.FlushInterval > 0 && s.timer == nil {
+		s.timer = time.AfterFunc(s.FlushInterval, s.timedFlush)
+	}
+	return n, err
+}
+
+// flush writes the buffered data to the current file.
+func (s *FileSink) flush() error {
+	if s.f == nil {
+		return nil
+	}
+	if s.gz != nil {
+		if err := s.gz.Flush(); err != nil {
+			return err
+		}
+	}
+	return s.bw.Flush()
+}
+
+// timedFlush flushes the sink for the FlushInterval field. Errors are
+// returned by the next call to a write method, Flush or Close.
+func (s *FileSink) timedFlush() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.timer = nil
+	if err := s.flush(); err != nil && s.flushErr == nil {
+		s.flushErr = err
+	}
+}
+
+// takeFlushErr returns and clears the error from a timed flush.
+func (s *FileSink) takeFlushErr() error {
+	err := s.flushErr
+	s.flushErr = nil
+	return err
+}
+
+// Write writes p to the sink. The slice p must hold one or more complete
+// lines because the sink starts new files only between calls to Write.
+// Write implements io.Writer so that the sink can be used with OpenTee.
+func (s *FileSink) Write(p []byte) (int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.write(p)
+}
+
+// WriteMessage writes p followed by '\n' to the sink.
+func (s *FileSink) WriteMessage(p []byte) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if len(p) > 0 && p[len(p)-1] == '\n' {
+		_, err := s.write(p)
+		return err
+	}
+	// Write the line with one call so that the line is not split between
+	// files.
+	buf := make([]byte, len(p)+1)
+	copy(buf, p)
+	buf[len(p)] = '\n'
+	_, err := s.write(buf)
+	return err
+}
+
+// Flush writes buffered messages to the current file.
+func (s *FileSink) Flush() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if err := s.takeFlushErr(); err != nil {
+		return err
+	}
+	return s.flush()
+}
+
+// WriteMessages writes the messages received from the channel to the sink
+// until the channel is closed. The messages are acknowledged and released
+// after they are flushed to the file. WriteMessages flushes the sink when
+// no message is waiting on the channel. WriteMessages returns the first
+// error writing to the sink; the remaining messages are not read.
+func (s *FileSink) WriteMessages(messages <-chan Message) error {
+	var pending []Message
+	flush := func() error {
+		if err := s.Flush(); err != nil {
+			return err
+		}
+		for _, m := range pending {
+			m.Ack()
+			m.Release()
+		}
+		pending = pending[:0]
+		return nil
+	}
+	for {
+		var m Message
+		var ok bool
+		select {
+		case m, ok = <-messages:
+		default:
+			if err := flush(); err != nil {
+				return err
+			}
+			m, ok = <-messages
+		}
+		if !ok {
+			return flush()
+		}
+		if err := s.WriteMessage(m.Raw); err != nil {
+			return err
+		}
+		pending = append(pending, m)
+	}
+}
+
+// Close completes the current file and closes the sink.
+func (s *FileSink) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.closed {
+		return nil
+	}
+	s.closed = true
+	if s.timer != nil {
+		s.timer.Stop()
+		s.timer = nil
+	}
+	err := s.takeFlushErr()
+	if err1 := s.finish(); err == nil {
+		err = err1
+	}
+	return err
+}
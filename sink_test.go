@@ -0,0 +1,236 @@
+// Copyright 2010 Gary Burd
+//
+// Licensed under the Apache License, Version 2.0 (the "License"): you may
+// not use this file except in compliance with the License. You may obtain
+// a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+// WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the
+// License for the specific language governing permissions and limitations
+// under the License.
+
+package twitterstream
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+// sinkFiles returns the names of the files in dir.
+func sinkFiles(t *testing.T, dir string) []string {
+	t.Helper()
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var names []string
+	for _, e := range entries {
+		names = append(names, e.Name())
+	}
+	sort.Strings(names)
+	return names
+}
+
+// sinkLines returns the lines in the file, decompressing the file if the name
+// ends with ".gz".
+func sinkLines(t *testing.T, name string) []string {
+	t.Helper()
+	f, err := os.Open(name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	var r io.Reader = f
+	if strings.HasSuffix(name, ".gz") {
+		gz, err := gzip.NewReader(f)
+		if err != nil {
+			t.Fatal(err)
+		}
+		r = gz
+	}
+	var lines []string
+	s := bufio.NewScanner(r)
+	for s.Scan() {
+		lines = append(lines, s.Text())
+	}
+	if err := s.Err(); err != nil {
+		t.Fatal(err)
+	}
+	return lines
+}
+
+func TestFileSinkMaxSize(t *testing.T) {
+	for _, compress := range []bool{false, true} {
+		dir := t.TempDir()
+		s := &FileSink{Dir: dir, Prefix: "p", MaxSize: 20, Compress: compress}
+		for i := 0; i < 5; i++ {
+			// Each line is 9 bytes, so each file holds two lines.
+			if err := s.WriteMessage([]byte(`{"id":` + strconv.Itoa(i) + `}`)); err != nil {
+				t.Fatal(err)
+			}
+		}
+		names := sinkFiles(t, dir)
+		if len(names) != 3 || !strings.HasSuffix(names[2], ".tmp") {
+			t.Fatalf("compress=%v: files before Close = %q, want two complete files and one .tmp file", compress, names)
+		}
+		if err := s.Close(); err != nil {
+			t.Fatal(err)
+		}
+		ext := ".jsonl"
+		if compress {
+			ext = ".jsonl.gz"
+		}
+		names = sinkFiles(t, dir)
+		var lines []string
+		for _, name := range names {
+			if !strings.HasPrefix(name, "p-") || !strings.HasSuffix(name, ext) {
+				t.Errorf("compress=%v: unexpected file %q", compress, name)
+			}
+			lines = append(lines, sinkLines(t, filepath.Join(dir, name))...)
+		}
+		if len(names) != 3 {
+			t.Errorf("compress=%v: files after Close = %q, want 3", compress, names)
+		}
+		want := []string{`{"id":0}`, `{"id":1}`, `{"id":2}`, `{"id":3}`, `{"id":4}`}
+		if strings.Join(lines, " ") != strings.Join(want, " ") {
+			t.Errorf("compress=%v: lines = %q, want %q", compress, lines, want)
+		}
+		if err := s.WriteMessage([]byte(`{}`)); err != errSinkClosed {
+			t.Errorf("compress=%v: WriteMessage after Close returned %v, want %v", compress, err, errSinkClosed)
+		}
+	}
+}
+
+func TestFileSinkMaxAge(t *testing.T) {
+	dir := t.TempDir()
+	s := &FileSink{Dir: dir, MaxAge: time.Hour}
+	if err := s.WriteMessage([]byte(`{"id":1}`)); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.WriteMessage([]byte(`{"id":2}`)); err != nil {
+		t.Fatal(err)
+	}
+	s.mu.Lock()
+	s.opened = s.opened.Add(-time.Hour)
+	s.mu.Unlock()
+	if err := s.WriteMessage([]byte(`{"id":3}`)); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Close(); err != nil {
+		t.Fatal(err)
+	}
+	names := sinkFiles(t, dir)
+	if len(names) != 2 {
+		t.Fatalf("files = %q, want 2", names)
+	}
+	if lines := sinkLines(t, filepath.Join(dir, names[0])); len(lines) != 2 {
+		t.Errorf("first file has lines %q, want 2 lines", lines)
+	}
+	if lines := sinkLines(t, filepath.Join(dir, names[1])); len(lines) != 1 {
+		t.Errorf("second file has lines %q, want 1 line", lines)
+	}
+}
+
+func TestFileSinkNameCollision(t *testing.T) {
+	dir := t.TempDir()
+	s := &FileSink{Dir: dir}
+	now := time.Date(2020, 1, 2, 3, 4, 5, 6000, time.UTC)
+	for i := 0; i < 3; i++ {
+		if err := s.open(now); err != nil {
+			t.Fatal(err)
+		}
+		if err := s.finish(); err != nil {
+			t.Fatal(err)
+		}
+	}
+	names := sinkFiles(t, dir)
+	want := []string{
+		"tweets-20200102T030405.000006Z-1.jsonl",
+		"tweets-20200102T030405.000006Z-2.jsonl",
+		"tweets-20200102T030405.000006Z.jsonl",
+	}
+	if strings.Join(names, " ") != strings.Join(want, " ") {
+		t.Errorf("files = %q, want %q", names, want)
+	}
+}
+
+func TestFileSinkWriteMessagesAck(t *testing.T) {
+	dir := t.TempDir()
+	s := &FileSink{Dir: dir}
+	messages := make(chan Message)
+	var acked []string
+	go func() {
+		for i := 0; i < 10; i++ {
+			raw := []byte(`{"id":` + strconv.Itoa(i) + `}`)
+			messages <- Message{Raw: raw, ack: func() {
+				// The message must be in the file when acknowledged.
+				names := sinkFiles(t, dir)
+				p, err := os.ReadFile(filepath.Join(dir, names[len(names)-1]))
+				if err != nil || !bytes.Contains(p, raw) {
+					t.Errorf("message %s acknowledged before written to file", raw)
+				}
+				acked = append(acked, string(raw))
+			}}
+		}
+		close(messages)
+	}()
+	if err := s.WriteMessages(messages); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if len(acked) != 10 {
+		t.Fatalf("acknowledged %d messages, want 10", len(acked))
+	}
+	for i, raw := range acked {
+		if want := `{"id":` + strconv.Itoa(i) + `}`; raw != want {
+			t.Errorf("ack %d = %s, want %s", i, raw, want)
+		}
+	}
+}
+
+func TestFileSinkTimedFlushError(t *testing.T) {
+	s := &FileSink{Dir: t.TempDir(), FlushInterval: time.Millisecond}
+	if err := s.WriteMessage([]byte(`{"id":1}`)); err != nil {
+		t.Fatal(err)
+	}
+	// Close the file under the sink so that the timed flush fails.
+	s.mu.Lock()
+	s.f.Close()
+	s.mu.Unlock()
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		s.mu.Lock()
+		err := s.flushErr
+		s.mu.Unlock()
+		if err != nil {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("timed flush did not fail")
+		}
+		time.Sleep(time.Millisecond)
+	}
+	if err := s.WriteMessage([]byte(`{"id":2}`)); err == nil {
+		t.Fatal("WriteMessage returned nil error after failed timed flush")
+	}
+	s.mu.Lock()
+	err := s.flushErr
+	s.mu.Unlock()
+	if err != nil {
+		t.Fatalf("flushErr = %v after WriteMessage, want nil", err)
+	}
+}
@@ -0,0 +1,224 @@
+// Copyright 2010 Gary Burd
+//
+// Licensed under the Apache License, Version 2.0 (the "License"): you may
+// not use this file except in compliance with the License. You may obtain
+// a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+// WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the
+// License for the specific language governing permissions and limitations
+// under the License.
+
+package twitterstream
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"github.com/garyburd/go-oauth/oauth"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+)
+
+const (
+	// SiteStreamURL is the site streams endpoint.
+	SiteStreamURL = "https://sitestream.twitter.com/1.1/site.json"
+
+	siteStreamHost = "https://sitestream.twitter.com"
+)
+
+// OpenSiteStream opens a site stream. The stream delivers the data and
+// events for the users in the follow parameter. Use SiteStreamParams to
+// create the parameters. Each message in the stream is wrapped in an envelope
+// identifying the user. Use ParseSiteMessage to decode the envelope.
+//
+// The stream sends a control URI for adding and removing users on the
+// connection. Use Stream.SiteStreamControl after the first call to Next to
+// get a client for the control URI.
+func OpenSiteStream(ctx context.Context, oauthClient *oauth.Client, accessToken *oauth.Credentials, params url.Values, options ...OpenOption) (*Stream, error) {
+	ts, err := OpenContext(ctx, oauthClient, accessToken, SiteStreamURL, params, withMethod("GET", options)...)
+	if err != nil {
+		return nil, err
+	}
+	ts.oauthClient = oauthClient
+	ts.accessToken = accessToken
+	return ts, nil
+}
+
+// SiteStreamParams specifies the parameters for the site streams endpoint.
+type SiteStreamParams struct {
+	// Follow is the list of users to include in the stream.
+	Follow []int64
+
+	// With is "user" to receive only the users' own messages or
+	// "followings" to also receive messages from the accounts the users
+	// follow. The default is "user".
+	With string
+
+	// AllReplies specifies whether the stream includes all replies by
+	// followed accounts.
+	AllReplies bool
+
+	// StringifyFriendIDs specifies whether friends lists are sent as
+	// strings.
+	StringifyFriendIDs bool
+}
+
+// Values returns the parameters encoded for use with OpenSiteStream.
+func (sp SiteStreamParams) Values() url.Values {
+	params := FilterParams{Follow: sp.Follow}.Values()
+	if sp.With != "" {
+		params.Set("with", sp.With)
+	}
+	if sp.AllReplies {
+		params.Set("replies", "all")
+	}
+	if sp.StringifyFriendIDs {
+		params.Set("stringify_friend_ids", "true")
+	}
+	return params
+}
+
+// SiteMessage is the envelope for a message in a site stream.
+type SiteMessage struct {
+	// ForUser is the ID of the user the message is for.
+	ForUser int64
+
+	// Message is the wrapped message. Decode the message as the
+	// corresponding message from a user stream.
+	Message json.RawMessage
+}
+
+// ParseSiteMessage decodes the envelope of a message read from a site stream.
+func ParseSiteMessage(p []byte) (*SiteMessage, error) {
+	var m struct {
+		ForUser json.Number     `json:"for_user"`
+		Message json.RawMessage `json:"message"`
+	}
+	if err := json.Unmarshal(p, &m); err != nil {
+		return nil, err
+	}
+	if m.Message == nil {
+		return nil, errors.New("twitterstream: not a site stream message")
+	}
+	id, err := strconv.ParseInt(string(m.ForUser), 10, 64)
+	if err != nil {
+		return nil, err
+	}
+	return &SiteMessage{ForUser: id, Message: m.Message}, nil
+}
+
+// parseControlURI decodes the control message read from a site stream.
+func parseControlURI(p []byte) (string, error) {
+	var m struct {
+		Control struct {
+			ControlURI string `json:"control_uri"`
+		} `json:"control"`
+	}
+	if err := json.Unmarshal(p, &m); err != nil {
+		return "", err
+	}
+	return m.Control.ControlURI, nil
+}
+
+// SiteStreamControl adds and removes users on an established site stream
+// connection.
+type SiteStreamControl struct {
+	oauthClient *oauth.Client
+	accessToken *oauth.Credentials
+
+	// URL is the control URL for the connection.
+	URL string
+
+	// HTTPClient is the client used for requests. If nil, then
+	// http.DefaultClient is used.
+	HTTPClient *http.Client
+}
+
+// SiteStreamControl returns a client for the control URI sent by the site
+// stream. SiteStreamControl returns nil if the stream has not received the
+// control URI or if the stream is not a site stream.
+func (ts *Stream) SiteStreamControl() *SiteStreamControl {
+	if ts.controlURI == "" || ts.oauthClient == nil {
+		return nil
+	}
+	return &SiteStreamControl{
+		oauthClient: ts.oauthClient,
+		accessToken: ts.accessToken,
+		URL:         siteStreamHost + ts.controlURI,
+	}
+}
+
+func (c *SiteStreamControl) do(ctx context.Context, method, path string, params url.Values) ([]byte, error) {
+	urlStr := c.URL + path
+	pcopy := url.Values{}
+	for key, values := range params {
+		pcopy[key] = values
+	}
+	c.oauthClient.SignParam(c.accessToken, method, urlStr, pcopy)
+
+	var req *http.Request
+	var err error
+	if method == "GET" {
+		req, err = http.NewRequestWithContext(ctx, method, urlStr+"?"+pcopy.Encode(), nil)
+	} else {
+		req, err = http.NewRequestWithContext(ctx, method, urlStr, strings.NewReader(pcopy.Encode()))
+		if req != nil {
+			req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		}
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	client := c.HTTPClient
+	if client == nil {
+		client = http.DefaultClient
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	p, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode != 200 {
+		return nil, newHTTPStatusError(resp, p)
+	}
+	return p, nil
+}
+
+func userIDParams(ids []int64) url.Values {
+	s := make([]string, len(ids))
+	for i, id := range ids {
+		s[i] = strconv.FormatInt(id, 10)
+	}
+	return url.Values{"user_id": {strings.Join(s, ",")}}
+}
+
+// AddUsers adds up to 100 users to the connection.
+func (c *SiteStreamControl) AddUsers(ctx context.Context, ids []int64) error {
+	_, err := c.do(ctx, "POST", "/add_user.json", userIDParams(ids))
+	return err
+}
+
+// RemoveUsers removes users from the connection.
+func (c *SiteStreamControl) RemoveUsers(ctx context.Context, ids []int64) error {
+	_, err := c.do(ctx, "POST", "/remove_user.json", userIDParams(ids))
+	return err
+}
+
+// Info returns the raw JSON description of the connection and the users on
+// the connection.
+func (c *SiteStreamControl) Info(ctx context.Context) (json.RawMessage, error) {
+	p, err := c.do(ctx, "GET", "/info.json", nil)
+	return json.RawMessage(p), err
+}
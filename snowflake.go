@@ -0,0 +1,101 @@
+// Copyright 2010 Gary Burd
+//
+// Licensed under the Apache License, Version 2.0 (the "License"): you may
+// not use this file except in compliance with the License. You may obtain
+// a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+// WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the
+// License for the specific language governing permissions and limitations
+// under the License.
+
+package twitterstream
+
+import (
+	"strconv"
+	"strings"
+	"time"
+)
+
+// snowflakeEpoch is the Twitter snowflake epoch in milliseconds since the
+// Unix epoch.
+const snowflakeEpoch = 1288834974657
+
+// snowflakeTimeShift is the position of the timestamp in a snowflake ID.
+const snowflakeTimeShift = 22
+
+// SnowflakeTime returns the creation time encoded in a snowflake ID. Twitter
+// assigns snowflake IDs to tweets created after November 4, 2010 and to
+// recently created users. The result for older sequential IDs is
+// meaningless.
+func SnowflakeTime(id int64) time.Time {
+	return time.UnixMilli(id>>snowflakeTimeShift + snowflakeEpoch).UTC()
+}
+
+// MinSnowflakeID returns the smallest ID that can be assigned at time t. Use
+// the ID to create since_id and max_id bounds for a time range:
+//
+//  params.Set("since_id", strconv.FormatInt(twitterstream.MinSnowflakeID(start)-1, 10))
+//  params.Set("max_id", strconv.FormatInt(twitterstream.MaxSnowflakeID(end), 10))
+func MinSnowflakeID(t time.Time) int64 {
+	ms := t.UnixMilli() - snowflakeEpoch
+	if ms < 0 {
+		return 0
+	}
+	return ms << snowflakeTimeShift
+}
+
+// MaxSnowflakeID returns the largest ID that can be assigned at time t.
+func MaxSnowflakeID(t time.Time) int64 {
+	ms := t.UnixMilli() - snowflakeEpoch
+	if ms < 0 {
+		return 0
+	}
+	return ms<<snowflakeTimeShift | (1<<snowflakeTimeShift - 1)
+}
+
+// SinceIDForTime returns a since_id parameter value that matches the tweets
+// created at or after t.
+func SinceIDForTime(t time.Time) string {
+	id := MinSnowflakeID(t) - 1
+	if id < 0 {
+		id = 0
+	}
+	return strconv.FormatInt(id, 10)
+}
+
+// MaxIDForTime returns a max_id parameter value that matches the tweets
+// created at or before t.
+func MaxIDForTime(t time.Time) string {
+	return strconv.FormatInt(MaxSnowflakeID(t), 10)
+}
+
+// CompareIDs compares the decimal string IDs a and b without converting the
+// IDs to integers. The result is 0 if a == b, -1 if a < b and +1 if a > b.
+// Use CompareIDs to find the newest ID for a since_id parameter.
+func CompareIDs(a, b string) int {
+	a = strings.TrimLeft(a, "0")
+	b = strings.TrimLeft(b, "0")
+	switch {
+	case len(a) < len(b):
+		return -1
+	case len(a) > len(b):
+		return 1
+	}
+	return strings.Compare(a, b)
+}
+
+// MaxID returns the greatest of the decimal string IDs or "" if ids is
+// empty.
+func MaxID(ids ...string) string {
+	max := ""
+	for _, id := range ids {
+		if max == "" || CompareIDs(id, max) > 0 {
+			max = id
+		}
+	}
+	return max
+}
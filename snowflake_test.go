@@ -0,0 +1,52 @@
+// Copyright 2010 Gary Burd
+//
+// Licensed under the Apache License, Version 2.0 (the "License"): you may
+// not use this file except in compliance with the License. You may obtain
+// a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+// WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the
+// License for the specific language governing permissions and limitations
+// under the License.
+
+package twitterstream
+
+import (
+	"testing"
+	"time"
+)
+
+func TestSnowflakeIDBounds(t *testing.T) {
+	for _, ms := range []int64{0, 1, 1000, 1001, 1539202764000 - snowflakeEpoch, 1539202764001 - snowflakeEpoch} {
+		tm := time.UnixMilli(ms + snowflakeEpoch)
+		min, max := MinSnowflakeID(tm), MaxSnowflakeID(tm)
+		if want := ms << snowflakeTimeShift; min != want {
+			t.Errorf("ms=%d: MinSnowflakeID = %d, want %d", ms, min, want)
+		}
+		if want := (ms+1)<<snowflakeTimeShift - 1; max != want {
+			t.Errorf("ms=%d: MaxSnowflakeID = %d, want %d", ms, max, want)
+		}
+		if got := SnowflakeTime(min); !got.Equal(tm) {
+			t.Errorf("ms=%d: SnowflakeTime(min) = %v, want %v", ms, got, tm)
+		}
+		if got := SnowflakeTime(max); !got.Equal(tm) {
+			t.Errorf("ms=%d: SnowflakeTime(max) = %v, want %v", ms, got, tm)
+		}
+		if got := SnowflakeTime(max + 1); !got.Equal(tm.Add(time.Millisecond)) {
+			t.Errorf("ms=%d: SnowflakeTime(max+1) = %v, want %v", ms, got, tm.Add(time.Millisecond))
+		}
+	}
+}
+
+func TestSnowflakeIDBeforeEpoch(t *testing.T) {
+	tm := time.UnixMilli(snowflakeEpoch - 1)
+	if id := MinSnowflakeID(tm); id != 0 {
+		t.Errorf("MinSnowflakeID = %d, want 0", id)
+	}
+	if id := MaxSnowflakeID(tm); id != 0 {
+		t.Errorf("MaxSnowflakeID = %d, want 0", id)
+	}
+}
@@ -0,0 +1,298 @@
+// Copyright 2010 Gary Burd
+//
+// Licensed under the Apache License, Version 2.0 (the "License"): you may
+// not use this file except in compliance with the License. You may obtain
+// a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+// WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the
+// License for the specific language governing permissions and limitations
+// under the License.
+
+package twitterstream
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// spillQueue is a disk backed FIFO queue of messages. The queue is stored in
+// append-only segment files in a directory. A segment is deleted after all
+// of the messages in the segment are read. Messages left in the directory
+// when the queue is closed are read when the queue is opened again. The
+// position of the reader is saved in a cursor file when the queue is closed.
+// If the process exits without closing the queue, then the messages read
+// from the first segment are read again.
+//
+// In ack mode, the cursor is the position after the last message committed
+// by the application instead of the position of the reader. Segments are
+// deleted after all of the messages in the segment are committed.
+//
+// Each record in a segment is the time the message was received in Unix
+// nanoseconds, the length of the message and the message. The numbers are
+// encoded as big endian 64 and 32 bit integers.
+type spillQueue struct {
+	dir         string
+	segmentSize int64
+
+	// Sequence numbers of the segments, oldest first. The last segment is
+	// the segment open for writing.
+	segments []int64
+
+	w     *os.File
+	wsize int64
+
+	r    *os.File
+	br   *bufio.Reader
+	rseq int64
+	roff int64
+
+	// Number of unread messages.
+	n int
+
+	// Ack mode and the segments that are read but not committed.
+	ack  bool
+	done []int64
+
+	// Source set on the messages read from the queue.
+	source string
+}
+
+// spillPos is a position in the queue.
+type spillPos struct {
+	seq, off int64
+}
+
+const (
+	spillCursor      = "cursor"
+	spillSuffix      = ".seg"
+	spillHeaderSize  = 12
+	spillSegmentSize = 64 << 20
+)
+
+var errSpillCorrupt = errors.New("twitterstream: corrupt spill segment")
+
+func spillName(dir string, seq int64) string {
+	return filepath.Join(dir, fmt.Sprintf("%020d%s", seq, spillSuffix))
+}
+
+// openSpillQueue opens the queue in dir, creating the directory as needed.
+func openSpillQueue(dir string, segmentSize int64, ack bool) (*spillQueue, error) {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, err
+	}
+	fis, err := ioutil.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+	s := &spillQueue{dir: dir, segmentSize: segmentSize, ack: ack}
+
+	// Read the position saved by close.
+	var cseq, coff int64
+	if p, err := ioutil.ReadFile(filepath.Join(dir, spillCursor)); err == nil {
+		fmt.Sscan(string(p), &cseq, &coff)
+	}
+
+	for _, fi := range fis {
+		name := fi.Name()
+		if !strings.HasSuffix(name, spillSuffix) {
+			continue
+		}
+		seq, err := strconv.ParseInt(strings.TrimSuffix(name, spillSuffix), 10, 64)
+		if err != nil {
+			continue
+		}
+		var off int64
+		switch {
+		case seq < cseq:
+			os.Remove(spillName(dir, seq))
+			continue
+		case seq == cseq:
+			off = coff
+		}
+		n, err := countSpillRecords(spillName(dir, seq), off)
+		if err != nil {
+			return nil, err
+		}
+		s.segments = append(s.segments, seq)
+		s.n += n
+	}
+	sort.Slice(s.segments, func(i, j int) bool { return s.segments[i] < s.segments[j] })
+	if len(s.segments) > 0 && s.segments[0] == cseq {
+		s.roff = coff
+	}
+	if err := s.rotate(); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+// countSpillRecords returns the number of complete records in a segment
+// after offset off.
+func countSpillRecords(name string, off int64) (int, error) {
+	f, err := os.Open(name)
+	if err != nil {
+		return 0, err
+	}
+	defer f.Close()
+	if _, err := f.Seek(off, io.SeekStart); err != nil {
+		return 0, err
+	}
+	br := bufio.NewReader(f)
+	var hdr [spillHeaderSize]byte
+	n := 0
+	for {
+		if _, err := io.ReadFull(br, hdr[:]); err == io.EOF || err == io.ErrUnexpectedEOF {
+			return n, nil
+		} else if err != nil {
+			return 0, err
+		}
+		size := int64(binary.BigEndian.Uint32(hdr[8:]))
+		if m, err := br.Discard(int(size)); int64(m) < size {
+			if err == io.EOF {
+				return n, nil
+			}
+			return 0, err
+		}
+		n++
+	}
+}
+
+// rotate starts a new segment for writing.
+func (s *spillQueue) rotate() error {
+	var seq int64
+	if len(s.segments) > 0 {
+		seq = s.segments[len(s.segments)-1] + 1
+	}
+	w, err := os.OpenFile(spillName(s.dir, seq), os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0644)
+	if err != nil {
+		return err
+	}
+	if s.w != nil {
+		s.w.Close()
+	}
+	s.w = w
+	s.wsize = 0
+	s.segments = append(s.segments, seq)
+	return nil
+}
+
+// len returns the number of unread messages.
+func (s *spillQueue) len() int {
+	return s.n
+}
+
+// push appends a message to the queue.
+func (s *spillQueue) push(m Message) error {
+	if s.wsize >= s.segmentSize {
+		if err := s.rotate(); err != nil {
+			return err
+		}
+	}
+	buf := make([]byte, spillHeaderSize, spillHeaderSize+len(m.Raw))
+	binary.BigEndian.PutUint64(buf, uint64(m.Received.UnixNano()))
+	binary.BigEndian.PutUint32(buf[8:], uint32(len(m.Raw)))
+	buf = append(buf, m.Raw...)
+	if _, err := s.w.Write(buf); err != nil {
+		return err
+	}
+	s.wsize += int64(len(buf))
+	s.n++
+	return nil
+}
+
+// pop removes the oldest message from the queue. The queue must not be
+// empty. The function returns the position after the message.
+func (s *spillQueue) pop() (Message, spillPos, error) {
+	for {
+		if s.r == nil {
+			r, err := os.Open(spillName(s.dir, s.segments[0]))
+			if err != nil {
+				return Message{}, spillPos{}, err
+			}
+			if s.roff > 0 {
+				if _, err := r.Seek(s.roff, io.SeekStart); err != nil {
+					r.Close()
+					return Message{}, spillPos{}, err
+				}
+			}
+			s.r = r
+			s.br = bufio.NewReader(r)
+			s.rseq = s.segments[0]
+		}
+		var hdr [spillHeaderSize]byte
+		var p []byte
+		_, err := io.ReadFull(s.br, hdr[:])
+		if err == nil {
+			p = make([]byte, binary.BigEndian.Uint32(hdr[8:]))
+			_, err = io.ReadFull(s.br, p)
+		}
+		if err == io.EOF || err == io.ErrUnexpectedEOF {
+			if len(s.segments) == 1 {
+				return Message{}, spillPos{}, errSpillCorrupt
+			}
+			// Done with this segment. An incomplete record at the end
+			// of the segment was not counted when the queue was opened.
+			s.r.Close()
+			if s.ack {
+				s.done = append(s.done, s.rseq)
+			} else {
+				os.Remove(spillName(s.dir, s.rseq))
+			}
+			s.r = nil
+			s.roff = 0
+			s.segments = s.segments[1:]
+			continue
+		} else if err != nil {
+			return Message{}, spillPos{}, err
+		}
+		s.n--
+		s.roff += int64(spillHeaderSize + len(p))
+		received := time.Unix(0, int64(binary.BigEndian.Uint64(hdr[:8])))
+		m := Message{Kind: KindOf(p), Raw: p, Received: received, Source: s.source}
+		return m, spillPos{s.rseq, s.roff}, nil
+	}
+}
+
+// commit saves pos as the cursor and deletes the segments before pos. Commit
+// is used in ack mode.
+func (s *spillQueue) commit(pos spillPos) error {
+	cursor := fmt.Sprintf("%d %d\n", pos.seq, pos.off)
+	if err := writeFileAtomic(filepath.Join(s.dir, spillCursor), []byte(cursor)); err != nil {
+		return err
+	}
+	for len(s.done) > 0 && s.done[0] < pos.seq {
+		os.Remove(spillName(s.dir, s.done[0]))
+		s.done = s.done[1:]
+	}
+	return nil
+}
+
+// close closes the files used by the queue. Unread messages remain in the
+// directory.
+func (s *spillQueue) close() error {
+	if s.r != nil {
+		s.r.Close()
+	}
+	err := s.w.Close()
+	if !s.ack && s.roff > 0 {
+		cursor := fmt.Sprintf("%d %d\n", s.segments[0], s.roff)
+		if e := writeFileAtomic(filepath.Join(s.dir, spillCursor), []byte(cursor)); err == nil {
+			err = e
+		}
+	}
+	return err
+}
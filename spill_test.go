@@ -0,0 +1,69 @@
+// Copyright 2010 Gary Burd
+//
+// Licensed under the Apache License, Version 2.0 (the "License"): you may
+// not use this file except in compliance with the License. You may obtain
+// a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+// WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the
+// License for the specific language governing permissions and limitations
+// under the License.
+
+package twitterstream
+
+import (
+	"strconv"
+	"testing"
+	"time"
+)
+
+func TestSpillQueue(t *testing.T) {
+	dir := t.TempDir()
+	s, err := openSpillQueue(dir, 100, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	s.source = "a"
+	for i := 0; i < 20; i++ {
+		if err := s.push(Message{Raw: []byte(`{"delete":` + strconv.Itoa(i) + `}`), Received: time.Now()}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for i := 0; i < 5; i++ {
+		m, _, err := s.pop()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if want := `{"delete":` + strconv.Itoa(i) + `}`; string(m.Raw) != want {
+			t.Fatalf("pop %d = %s, want %s", i, m.Raw, want)
+		}
+		if m.Kind != KindDelete || m.Source != "a" {
+			t.Fatalf("pop %d: Kind = %v, Source = %q, want delete, a", i, m.Kind, m.Source)
+		}
+	}
+	if err := s.close(); err != nil {
+		t.Fatal(err)
+	}
+
+	// Reopen the queue and read the remaining messages.
+	s, err = openSpillQueue(dir, 100, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.close()
+	if s.len() != 15 {
+		t.Fatalf("len() = %d, want 15", s.len())
+	}
+	for i := 5; i < 20; i++ {
+		m, _, err := s.pop()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if want := `{"delete":` + strconv.Itoa(i) + `}`; string(m.Raw) != want {
+			t.Fatalf("pop %d = %s, want %s", i, m.Raw, want)
+		}
+	}
+}
@@ -0,0 +1,230 @@
+// Copyright 2010 Gary Burd
+//
+// Licensed under the Apache License, Version 2.0 (the "License"): you may
+// not use this file except in compliance with the License. You may obtain
+// a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+// WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the
+// License for the specific language governing permissions and limitations
+// under the License.
+
+// Package sqlitesink writes the tweets read from a twitterstream stream to a
+// SQLite database.
+//
+// The sink uses database/sql. Import a SQLite driver such as
+// github.com/mattn/go-sqlite3 or modernc.org/sqlite in the application.
+//
+//  db, err := sql.Open("sqlite3", "tweets.db")
+//  s := &sqlitesink.Sink{DB: db}
+//  if err := s.CreateTable(ctx); err != nil {
+//      log.Fatal(err)
+//  }
+//  err = s.Run(ctx, ts.Messages(1000))
+//
+// CreateTable switches the database to write-ahead logging so that the
+// database can be queried while the sink writes. The table has the following
+// columns. The user_id and created_at columns are indexed. Times are stored
+// as RFC 3339 text in UTC.
+//
+//  id          INTEGER PRIMARY KEY  -- ID of the tweet
+//  user_id     INTEGER              -- ID of the user who posted the tweet
+//  created_at  TEXT                 -- time the tweet was posted
+//  deleted_at  TEXT                 -- time of the delete notice or NULL
+//  data        TEXT NOT NULL        -- the message read from the stream
+//
+// The sink stores v1.1 tweets and v2 responses with data. A tweet already in
+// the table is skipped. Delete notices set deleted_at for the deleted tweet.
+// Other messages are ignored.
+package sqlitesink
+
+import (
+	"context"
+	"database/sql"
+	"github.com/garyburd/twitterstream"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Sink writes tweets to SQLite. The fields must not be changed after the
+// first message is written.
+type Sink struct {
+	// DB is the database.
+	DB *sql.DB
+
+	// Table is the name of the table. If empty, then "tweets" is used.
+	Table string
+
+	// BatchSize is the maximum number of messages written in one
+	// transaction. If zero, then 1000 is used.
+	BatchSize int
+
+	// OnError is called with each message in a batch that could not be
+	// written. See twitterstream.Settle.
+	OnError func(m twitterstream.Message, err error)
+}
+
+func (s *Sink) table() string {
+	if s.Table == "" {
+		return "tweets"
+	}
+	return s.Table
+}
+
+func quoteIdent(s string) string {
+	return `"` + strings.ReplaceAll(s, `"`, `""`) + `"`
+}
+
+// CreateTable enables write-ahead logging and creates the table and indexes
+// if they do not exist.
+func (s *Sink) CreateTable(ctx context.Context) error {
+	t := s.table()
+	stmts := []string{
+		`PRAGMA journal_mode=WAL`,
+		`CREATE TABLE IF NOT EXISTS ` + quoteIdent(t) + ` (
+	id INTEGER PRIMARY KEY,
+	user_id INTEGER,
+	created_at TEXT,
+	deleted_at TEXT,
+	data TEXT NOT NULL
+)`,
+		`CREATE INDEX IF NOT EXISTS ` + quoteIdent(t+"_user_id_idx") + ` ON ` + quoteIdent(t) + ` (user_id)`,
+		`CREATE INDEX IF NOT EXISTS ` + quoteIdent(t+"_created_at_idx") + ` ON ` + quoteIdent(t) + ` (created_at)`,
+	}
+	for _, stmt := range stmts {
+		if _, err := s.DB.ExecContext(ctx, stmt); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func formatTime(t time.Time) string {
+	return t.UTC().Format(time.RFC3339)
+}
+
+// parseTime returns the time in the JSON value v as text or nil if v is not a
+// time.
+func parseTime(v []byte) interface{} {
+	var t twitterstream.TwitterTime
+	if t.UnmarshalJSON(v) != nil || t.IsZero() {
+		return nil
+	}
+	return formatTime(t.Time)
+}
+
+func parseID(lm twitterstream.LazyMessage, path string) (int64, bool) {
+	id, err := strconv.ParseInt(lm.String(path), 10, 64)
+	return id, err == nil
+}
+
+// write writes a batch of messages in a transaction.
+func (s *Sink) write(ctx context.Context, batch []twitterstream.Message) error {
+	tx, err := s.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	t := quoteIdent(s.table())
+	var insert, update *sql.Stmt
+	for _, m := range batch {
+		lm := twitterstream.LazyMessage(m.Raw)
+		switch twitterstream.KindOf(m.Raw) {
+		case twitterstream.KindTweet:
+			idPath, userPath, timePath := "id_str", "user.id_str", "created_at"
+			if lm.Has("data") {
+				idPath, userPath, timePath = "data.id", "data.author_id", "data.created_at"
+			}
+			id, ok := parseID(lm, idPath)
+			if !ok {
+				continue
+			}
+			var userID, createdAt interface{}
+			if uid, ok := parseID(lm, userPath); ok {
+				userID = uid
+			}
+			if v, ok := lm.Get(timePath); ok {
+				createdAt = parseTime(v)
+			}
+			if insert == nil {
+				insert, err = tx.PrepareContext(ctx, `INSERT OR IGNORE INTO `+t+` (id, user_id, created_at, data) VALUES (?, ?, ?, ?)`)
+				if err != nil {
+					return err
+				}
+				defer insert.Close()
+			}
+			if _, err := insert.ExecContext(ctx, id, userID, createdAt, string(m.Raw)); err != nil {
+				return err
+			}
+		case twitterstream.KindDelete:
+			id, ok := parseID(lm, "delete.status.id_str")
+			if !ok {
+				continue
+			}
+			deletedAt := interface{}(formatTime(m.Received))
+			if v, ok := lm.Get("delete.timestamp_ms"); ok {
+				if dt := parseTime(v); dt != nil {
+					deletedAt = dt
+				}
+			}
+			if update == nil {
+				update, err = tx.PrepareContext(ctx, `UPDATE `+t+` SET deleted_at = ? WHERE id = ? AND deleted_at IS NULL`)
+				if err != nil {
+					return err
+				}
+				defer update.Close()
+			}
+			if _, err := update.ExecContext(ctx, deletedAt, id); err != nil {
+				return err
+			}
+		}
+	}
+	return tx.Commit()
+}
+
+// flush writes a batch and handles the result for each message.
+func (s *Sink) flush(ctx context.Context, batch []twitterstream.Message) error {
+	err := s.write(ctx, batch)
+	if err != nil && ctx.Err() != nil {
+		return ctx.Err()
+	}
+	for _, m := range batch {
+		if err := twitterstream.Settle(m, err, s.OnError); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Write writes a single message.
+func (s *Sink) Write(ctx context.Context, m twitterstream.Message) error {
+	return s.flush(ctx, []twitterstream.Message{m})
+}
+
+// Run writes the messages received from the channel until the channel is
+// closed or the context is done. Run writes the messages that are waiting
+// on the channel in one transaction. Messages are acknowledged after the
+// transaction is committed.
+func (s *Sink) Run(ctx context.Context, messages <-chan twitterstream.Message) error {
+	n := s.BatchSize
+	if n <= 0 {
+		n = 1000
+	}
+	for {
+		batch, err := twitterstream.Batch(ctx, messages, n)
+		if err == io.EOF {
+			return nil
+		} else if err != nil {
+			return err
+		}
+		if err := s.flush(ctx, batch); err != nil {
+			return err
+		}
+	}
+}
@@ -0,0 +1,168 @@
+// Copyright 2010 Gary Burd
+//
+// Licensed under the Apache License, Version 2.0 (the "License"): you may
+// not use this file except in compliance with the License. You may obtain
+// a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+// WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the
+// License for the specific language governing permissions and limitations
+// under the License.
+
+package twitterstream
+
+import (
+	"expvar"
+	"sync/atomic"
+	"time"
+)
+
+// Stats is a snapshot of the health and counters of a stream.
+type Stats struct {
+	// ConnectedSince is the time the current connection was established. The
+	// value is zero if the stream is not connected.
+	ConnectedSince time.Time
+
+	// LastMessage is the time the last message was read from the stream.
+	LastMessage time.Time
+
+	// LastKeepalive is the time the last keepalive line was read from the
+	// stream.
+	LastKeepalive time.Time
+
+	// Messages is the number of messages read from the stream, including
+	// messages handled by callbacks.
+	Messages int64
+
+	// Bytes is the number of bytes in the lines read from the stream,
+	// including keepalive lines.
+	Bytes int64
+
+	// DecodeErrors is the number of messages that UnmarshalNext could not
+	// decode.
+	DecodeErrors int64
+
+	// Reconnects is the number of times a ReconnectingStream established a
+	// new connection after the first connection.
+	Reconnects int64
+
+	// Dropped is the number of undelivered tweets reported by limit notices.
+	Dropped int64
+
+	// QueueDropped is the number of messages discarded by the overflow
+	// policy of the goroutine started by Messages.
+	QueueDropped int64
+
+	// QueueBytes is the total size of the messages in the queue of the
+	// goroutine started by Messages.
+	QueueBytes int64
+
+	// QueueSpilled is the number of messages in the disk queue specified by
+	// the OpenSpillDir option.
+	QueueSpilled int64
+}
+
+// streamStats holds the counters for a stream. The fields are accessed
+// atomically. Times are stored as Unix nanoseconds.
+type streamStats struct {
+	connected     int64
+	lastMessage   int64
+	lastKeepalive int64
+	messages      int64
+	bytes         int64
+	decodeErrors  int64
+}
+
+func loadTime(p *int64) time.Time {
+	n := atomic.LoadInt64(p)
+	if n == 0 {
+		return time.Time{}
+	}
+	return time.Unix(0, n)
+}
+
+func storeTime(p *int64, t time.Time) {
+	atomic.StoreInt64(p, t.UnixNano())
+}
+
+// Stats returns a snapshot of the stream's counters. Stats can be called
+// concurrently with Next.
+func (ts *Stream) Stats() Stats {
+	s := Stats{
+		LastMessage:   loadTime(&ts.stats.lastMessage),
+		LastKeepalive: loadTime(&ts.stats.lastKeepalive),
+		Messages:      atomic.LoadInt64(&ts.stats.messages),
+		Bytes:         atomic.LoadInt64(&ts.stats.bytes),
+		DecodeErrors:  atomic.LoadInt64(&ts.stats.decodeErrors),
+		Dropped:       ts.DroppedCount(),
+	}
+	if ts.queue != nil {
+		s.QueueDropped = atomic.LoadInt64(&ts.queue.dropped)
+		s.QueueBytes = atomic.LoadInt64(&ts.queue.bytes)
+		s.QueueSpilled = atomic.LoadInt64(&ts.queue.spilled)
+	}
+	if ts.ctx.Err() == nil {
+		s.ConnectedSince = loadTime(&ts.stats.connected)
+	}
+	return s
+}
+
+// Stats returns a snapshot of the stream's counters summed over all
+// connections. Stats can be called concurrently with Next.
+func (rs *ReconnectingStream) Stats() Stats {
+	rs.mu.Lock()
+	defer rs.mu.Unlock()
+	s := rs.stats
+	s.DecodeErrors += atomic.LoadInt64(&rs.decodeErrors)
+	if rs.connects > 1 {
+		s.Reconnects = rs.connects - 1
+	}
+	if rs.ts != nil {
+		cs := rs.ts.Stats()
+		s.ConnectedSince = cs.ConnectedSince
+		if !cs.LastMessage.IsZero() {
+			s.LastMessage = cs.LastMessage
+		}
+		if !cs.LastKeepalive.IsZero() {
+			s.LastKeepalive = cs.LastKeepalive
+		}
+		s.Messages += cs.Messages
+		s.Bytes += cs.Bytes
+		s.DecodeErrors += cs.DecodeErrors
+		s.Dropped += cs.Dropped
+	}
+	return s
+}
+
+// addStats adds the counters for a dropped connection to the totals. The
+// caller must hold rs.mu.
+func (rs *ReconnectingStream) addStats(ts *Stream) {
+	cs := ts.Stats()
+	if !cs.LastMessage.IsZero() {
+		rs.stats.LastMessage = cs.LastMessage
+	}
+	if !cs.LastKeepalive.IsZero() {
+		rs.stats.LastKeepalive = cs.LastKeepalive
+	}
+	rs.stats.Messages += cs.Messages
+	rs.stats.Bytes += cs.Bytes
+	rs.stats.DecodeErrors += cs.DecodeErrors
+	rs.stats.Dropped += cs.Dropped
+}
+
+// PublishExpvar publishes the stream's Stats as an expvar variable with the
+// given name. Like expvar.Publish, PublishExpvar panics if the name is
+// already registered.
+func (ts *Stream) PublishExpvar(name string) {
+	expvar.Publish(name, expvar.Func(func() interface{} { return ts.Stats() }))
+}
+
+// PublishExpvar publishes the stream's Stats as an expvar variable with the
+// given name. Like expvar.Publish, PublishExpvar panics if the name is
+// already registered.
+func (rs *ReconnectingStream) PublishExpvar(name string) {
+	expvar.Publish(name, expvar.Func(func() interface{} { return rs.Stats() }))
+}
@@ -16,62 +16,130 @@
 // Twitter streaming APIs. See http://dev.twitter.com/pages/streaming_api for
 // information on the Twitter streaming APIs.
 //
-// The following example shows how to handle dropped connections. If it's
-// important for the application to see every tweet in the stream, then the
-// application should backfill the stream using the Twitter search API after
-// each connection attempt.
+// Use ReconnectingStream to handle dropped connections. If it's important for
+// the application to see every tweet in the stream, then the application
+// should backfill the stream using the Twitter search API after each
+// connection attempt.
 //
-//  waitUntil := time.Now()
+//  ts := twitterstream.NewReconnectingStream(client, cred, url, params)
+//  defer ts.Close()
 //  for {
-//      // Rate limit connection attempts to once every 30 seconds.
-//      if d := waitUntil.Sub(time.Now()); d > 0 {
-//          time.Sleep(d)
-//      }
-//      waitUntil = time.Now().Add(30 * time.Second)
-//
-//      ts, err := twitterstream.Open(client, cred, url, params)
-//      if err != nil {
-//          log.Println("error opening stream: ", err)
+//      var t twitterstream.Tweet
+//      if err := ts.UnmarshalNext(&t); err != nil {
+//          if ts.Err() != nil {
+//              log.Fatal("permanent error reading stream: ", err)
+//          }
+//          log.Println("error reading tweet: ", err)
 //          continue
 //      }
-//
-//      // Loop until stream has a permanent error.
-//      for ts.Err() == nil {
-//          var t MyTweet
-//          if err := ts.UnmarshalNext(&t); err != nil {
-//              log.Println("error reading tweet: ", err)
-//              continue
-//          } 
-//          process(&t) 
-//      }
-//      ts.Close()
+//      process(&t)
 //  }
-//          
 package twitterstream
 
 import (
 	"bufio"
 	"bytes"
+	"compress/gzip"
+	"compress/zlib"
+	"context"
+	"crypto/sha256"
 	"crypto/tls"
+	"encoding/base64"
 	"encoding/json"
 	"errors"
 	"github.com/garyburd/go-oauth/oauth"
+	"io"
 	"io/ioutil"
 	"net"
+	"net/http"
+	"net/http/httptrace"
 	"net/url"
-	"regexp"
 	"strconv"
 	"strings"
+	"sync"
+	"sync/atomic"
 	"time"
 )
 
 // Stream manages the connection to a Twitter streaming endpoint.
 type Stream struct {
-	chunkRemaining int64
-	chunkState     int
-	conn           net.Conn
-	r              *bufio.Reader
-	err            error
+	body     io.ReadCloser
+	r        *bufio.Reader
+	err      error
+	ctx      context.Context
+	cancel   context.CancelCauseFunc
+	watchdog *time.Timer
+
+	// Buffer for lines longer than the reader's buffer and the maximum
+	// line length.
+	long           []byte
+	maxMessageSize int
+
+	// Skip message length lines sent when the delimited=length parameter
+	// is specified.
+	delimited bool
+
+	onWarning   func(*Warning)
+	onDelete    func(*Delete)
+	onLimit     func(*Limit)
+	onKeepalive func(time.Time)
+	logger      Logger
+
+	checkpoint *checkpoint
+	deduper    Deduper
+
+	// Writer for the OpenDebugWriter option.
+	debugWriter io.Writer
+
+	// Writer for the OpenTee option and a buffer for the line written to
+	// the writer.
+	tee    io.Writer
+	teeBuf []byte
+
+	// Number of undelivered tweets reported by limit notices.
+	dropped int64
+
+	// Counters reported by Stats.
+	stats streamStats
+
+	// Gaps reported by limit notices.
+	gapsMu     sync.Mutex
+	gaps       []Gap
+	lastLimit  time.Time
+	limitTrack int64
+
+	// Disconnect notice received before the connection was closed.
+	disconnect *Disconnect
+
+	// Friends list sent at the start of a user stream.
+	friends *FriendsList
+
+	// Site stream control URI and the credentials for using the URI.
+	controlURI  string
+	oauthClient *oauth.Client
+	accessToken *oauth.Credentials
+
+	// Fields used by Messages.
+	overflow   OverflowPolicy
+	queueBytes int64
+	spillDir   string
+	queue      *messageQueue
+	messages   chan Message
+	quit       chan struct{}
+	quitOnce   sync.Once
+	exited     chan struct{}
+
+	// Label for messages.
+	source string
+
+	// Deliver messages from the disk queue and commit on Ack.
+	atLeastOnce bool
+
+	// Decoder used by UnmarshalNext.
+	decoder Decoder
+
+	// Skip lines rejected by the filter.
+	filter Filter
 }
 
 // HTTPStatusError represents an HTTP error return from the Twitter streaming
@@ -82,45 +150,181 @@ type HTTPStatusError struct {
 
 	// Response body.
 	Message string
+
+	// RetryAfter is the delay requested by the Retry-After header or zero if
+	// the header is not present.
+	RetryAfter time.Duration
+
+	// RateLimit is the rate limit status from the x-rate-limit-* headers or
+	// nil if the headers are not present.
+	RateLimit *RateLimit
+
+	// Errors is the list of errors decoded from a JSON response body.
+	Errors []APIError
+
+	// ConnectionHash and TransactionID are the values of the
+	// x-connection-hash and x-transaction-id headers. Twitter uses these
+	// values to find the request in Twitter's logs.
+	ConnectionHash string
+	TransactionID  string
+
+	// Header is the response header.
+	Header http.Header
+}
+
+// APIError is an error reported in the body of a Twitter API response.
+type APIError struct {
+	Code    int    `json:"code"`
+	Message string `json:"message"`
+}
+
+// Twitter API error codes.
+const (
+	ErrorCodeCouldNotAuthenticate  = 32
+	ErrorCodeSuspended             = 64
+	ErrorCodeRateLimitExceeded     = 88
+	ErrorCodeInvalidToken          = 89
+	ErrorCodeOverCapacity          = 130
+	ErrorCodeInternalError         = 131
+	ErrorCodeTimestampOutOfBounds  = 135
+	ErrorCodeBadAuthenticationData = 215
+)
+
+// HasErrorCode returns true if the response body reports an error with the
+// given code.
+func (err HTTPStatusError) HasErrorCode(code int) bool {
+	for _, e := range err.Errors {
+		if e.Code == code {
+			return true
+		}
+	}
+	return false
+}
+
+// RateLimit is the status of a rate limit reported in response headers.
+type RateLimit struct {
+	// Limit is the number of requests allowed in the rate limit window.
+	Limit int
+
+	// Remaining is the number of requests remaining in the current window.
+	Remaining int
+
+	// Reset is the time that the current window ends.
+	Reset time.Time
+}
+
+func newHTTPStatusError(resp *http.Response, p []byte) HTTPStatusError {
+	err := HTTPStatusError{
+		StatusCode:     resp.StatusCode,
+		Message:        string(p),
+		ConnectionHash: resp.Header.Get("X-Connection-Hash"),
+		TransactionID:  resp.Header.Get("X-Transaction-Id"),
+		Header:         resp.Header,
+	}
+	var body struct {
+		Errors []APIError `json:"errors"`
+	}
+	if json.Unmarshal(p, &body) == nil {
+		err.Errors = body.Errors
+	}
+	if s := resp.Header.Get("Retry-After"); s != "" {
+		if n, e := strconv.Atoi(s); e == nil {
+			err.RetryAfter = time.Duration(n) * time.Second
+		} else if t, e := http.ParseTime(s); e == nil {
+			err.RetryAfter = time.Until(t)
+		}
+	}
+	if s := resp.Header.Get("X-Rate-Limit-Reset"); s != "" {
+		reset, e := strconv.ParseInt(s, 10, 64)
+		if e == nil {
+			rl := &RateLimit{Reset: time.Unix(reset, 0)}
+			rl.Limit, _ = strconv.Atoi(resp.Header.Get("X-Rate-Limit-Limit"))
+			rl.Remaining, _ = strconv.Atoi(resp.Header.Get("X-Rate-Limit-Remaining"))
+			err.RateLimit = rl
+		}
+	}
+	return err
 }
 
 func (err HTTPStatusError) Error() string {
-	return "twitterstream: status=" + strconv.Itoa(err.StatusCode) + " " + err.Message
+	s := "twitterstream: status=" + strconv.Itoa(err.StatusCode)
+	if err.ConnectionHash != "" {
+		s += " connection=" + err.ConnectionHash
+	}
+	if err.TransactionID != "" {
+		s += " transaction=" + err.TransactionID
+	}
+	return s + " " + err.Message
 }
 
-var responseLineRegexp = regexp.MustCompile("^HTTP/[0-9.]+ ([0-9]+) ")
+// retryDelay returns the minimum delay before retrying the request as
+// specified by the response headers.
+func (err HTTPStatusError) retryDelay() time.Duration {
+	d := err.RetryAfter
+	if rl := err.RateLimit; rl != nil && rl.Remaining == 0 {
+		if until := time.Until(rl.Reset); until > d {
+			d = until
+		}
+	}
+	return d
+}
+
+var (
+	errConnectTimeout = errors.New("twitterstream: timeout connecting to stream")
+)
 
 // Open opens a new stream.
-func Open(oauthClient *oauth.Client, accessToken *oauth.Credentials, urlStr string, params url.Values) (*Stream, error) {
-	ts := new(Stream)
+func Open(oauthClient *oauth.Client, accessToken *oauth.Credentials, urlStr string, params url.Values, options ...OpenOption) (*Stream, error) {
+	return OpenContext(context.Background(), oauthClient, accessToken, urlStr, params, options...)
+}
+
+// OpenContext opens a new stream using the provided context. Cancelling the
+// context aborts a pending connection attempt and closes the stream. A call to
+// Next blocked on the closed stream returns the context's error.
+func OpenContext(ctx context.Context, oauthClient *oauth.Client, accessToken *oauth.Credentials, urlStr string, params url.Values, options ...OpenOption) (*Stream, error) {
+	return open(ctx, urlStr, params, newOpenOptions(options), func(method string, urlStr string, form url.Values, header http.Header) {
+		oauthClient.SignParam(accessToken, method, urlStr, form)
+	})
+}
+
+// authorizer adds credentials to a request. The function can modify the form
+// parameters or the request header.
+type authorizer func(method string, urlStr string, form url.Values, header http.Header)
 
+// defaultMethod returns the method required by the endpoint at urlStr.
+func defaultMethod(urlStr string) string {
 	u, err := url.Parse(urlStr)
 	if err != nil {
-		return nil, err
+		return "POST"
 	}
-
-	addr := u.Host
-	if strings.LastIndex(addr, ":") <= strings.LastIndex(addr, "]") {
-		if u.Scheme == "http" {
-			addr = addr + ":80"
-		} else {
-			addr = addr + ":443"
-		}
+	switch {
+	case strings.HasPrefix(u.Path, "/2/"),
+		strings.HasSuffix(u.Path, "/statuses/sample.json"),
+		strings.HasSuffix(u.Path, "/statuses/firehose.json"),
+		strings.HasSuffix(u.Path, "/user.json"),
+		strings.HasSuffix(u.Path, "/site.json"):
+		return "GET"
 	}
+	return "POST"
+}
 
-	if u.Scheme == "http" {
-		ts.conn, err = net.Dial("tcp", addr)
-		if err != nil {
-			return nil, err
-		}
-	} else {
-		ts.conn, err = tls.Dial("tcp", addr, nil)
-		if err != nil {
+// isFilterURL returns true if urlStr is the statuses/filter endpoint.
+func isFilterURL(urlStr string) bool {
+	u, err := url.Parse(urlStr)
+	return err == nil && strings.HasSuffix(u.Path, "/statuses/filter.json")
+}
+
+func open(ctx context.Context, urlStr string, params url.Values, do *openOptions, authorize authorizer) (*Stream, error) {
+	if do.atLeastOnce && do.spillDir == "" {
+		return nil, errors.New("twitterstream: OpenAtLeastOnce requires OpenSpillDir")
+	}
+	if do.method == "" {
+		do.method = defaultMethod(urlStr)
+	}
+	if isFilterURL(urlStr) {
+		if err := ValidateFilterParams(params); err != nil {
 			return nil, err
 		}
-		if err = ts.conn.(*tls.Conn).VerifyHostname(addr[:strings.LastIndex(addr, ":")]); err != nil {
-			return nil, ts.fatal(err)
-		}
 	}
 
 	// Setup request body.
@@ -128,67 +332,214 @@ func Open(oauthClient *oauth.Client, accessToken *oauth.Credentials, urlStr stri
 	for key, values := range params {
 		pcopy[key] = values
 	}
-	oauthClient.SignParam(accessToken, "POST", urlStr, pcopy)
+	if do.stallWarnings {
+		pcopy.Set("stall_warnings", "true")
+	}
+	header := make(http.Header)
+	authorize(do.method, urlStr, pcopy, header)
 	body := pcopy.Encode()
 
-	var req bytes.Buffer
-	req.WriteString("POST ")
-	req.WriteString(u.RequestURI())
-	req.WriteString(" HTTP/1.1")
-	req.WriteString("\r\nHost: ")
-	req.WriteString(u.Host)
-	req.WriteString("\r\nContent-Type: application/x-www-form-urlencoded")
-	req.WriteString("\r\nContent-Length: ")
-	req.WriteString(strconv.Itoa(len(body)))
-	req.WriteString("\r\n\r\n")
-	req.WriteString(body)
-	_, err = ts.conn.Write(req.Bytes())
+	// The endpoint without the query, for logging.
+	endpoint := urlStr
+	if i := strings.IndexByte(endpoint, '?'); i >= 0 {
+		endpoint = endpoint[:i]
+	}
+
+	var bodyReader io.Reader
+	if do.method == "GET" {
+		switch {
+		case body == "":
+		case strings.Contains(urlStr, "?"):
+			urlStr += "&" + body
+		default:
+			urlStr += "?" + body
+		}
+	} else {
+		bodyReader = strings.NewReader(body)
+	}
+
+	ts := new(Stream)
+	ts.ctx, ts.cancel = context.WithCancelCause(ctx)
+
+	reqCtx := ts.ctx
+	if do.clientTrace != nil {
+		reqCtx = httptrace.WithClientTrace(reqCtx, do.clientTrace)
+	}
+	req, err := http.NewRequestWithContext(reqCtx, do.method, urlStr, bodyReader)
 	if err != nil {
 		return nil, ts.fatal(err)
 	}
+	for k, v := range header {
+		req.Header[k] = v
+	}
+	if bodyReader != nil {
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	}
+	if do.userAgent != "" {
+		req.Header.Set("User-Agent", do.userAgent)
+	}
+	if do.compression {
+		req.Header.Set("Accept-Encoding", "gzip, deflate")
+	} else {
+		req.Header.Set("Accept-Encoding", "identity")
+	}
+
+	client := do.httpClient
+	if client == nil {
+		client = defaultClient(do)
+	}
 
-	// Must connect in 60 seconds.
-	err = ts.conn.SetReadDeadline(time.Now().Add(60 * time.Second))
+	// Must connect before the connect timeout.
+	t := time.AfterFunc(do.connectTimeout, func() { ts.cancel(errConnectTimeout) })
+	resp, err := client.Do(req)
+	t.Stop()
 	if err != nil {
-		return nil, ts.fatal(err)
+		err = ts.fatal(err)
+		do.logger.Errorf("twitterstream: error connecting to %s: %v", endpoint, err)
+		return nil, err
 	}
+	ts.body = resp.Body
 
-	ts.r = bufio.NewReaderSize(ts.conn, 8192)
-	p, err := ts.r.ReadSlice('\n')
+	if resp.StatusCode != 200 {
+		p, _ := ioutil.ReadAll(resp.Body)
+		err := ts.fatal(newHTTPStatusError(resp, p))
+		do.logger.Errorf("twitterstream: error connecting to %s: %v", endpoint, err)
+		return nil, err
+	}
+	do.logger.Infof("twitterstream: connected to %s", endpoint)
+
+	var r io.Reader = resp.Body
+	if do.readTimeout > 0 {
+		ts.watchdog = time.AfterFunc(do.readTimeout, func() { ts.cancel(ErrStalled) })
+		ts.watchdog.Stop()
+		r = &stallReader{r: r, watchdog: ts.watchdog, timeout: do.readTimeout}
+	}
+
+	// The application set the Accept-Encoding header above, so the
+	// transport does not decompress the body.
+	switch resp.Header.Get("Content-Encoding") {
+	case "gzip":
+		r, err = gzip.NewReader(r)
+	case "deflate":
+		r, err = zlib.NewReader(r)
+	}
 	if err != nil {
 		return nil, ts.fatal(err)
 	}
 
-	m := responseLineRegexp.FindSubmatch(p)
-	if m == nil {
-		return nil, ts.fatal(errors.New("twitterstream: bad http response line"))
+	ts.r = bufio.NewReaderSize(r, do.bufferSize)
+	ts.maxMessageSize = do.maxMessageSize
+	ts.delimited = params.Get("delimited") == "length"
+	ts.onWarning = do.onWarning
+	ts.onDelete = do.onDelete
+	ts.onLimit = do.onLimit
+	ts.onKeepalive = do.onKeepalive
+	ts.logger = do.logger
+	ts.debugWriter = do.debugWriter
+	ts.tee = do.tee
+	ts.checkpoint = do.checkpoint
+	ts.deduper = do.deduper
+	ts.overflow = do.overflow
+	ts.queueBytes = do.queueBytes
+	ts.spillDir = do.spillDir
+	ts.atLeastOnce = do.atLeastOnce
+	ts.source = do.source
+	ts.decoder = do.decoder
+	if ts.decoder == nil {
+		ts.decoder = jsonDecoder{useNumber: do.useNumber}
 	}
+	ts.filter = do.filter
+	storeTime(&ts.stats.connected, time.Now())
+	return ts, nil
+}
 
-	// Skip headers
-	for {
-		p, err = ts.r.ReadSlice('\n')
-		if err != nil {
-			return nil, ts.fatal(err)
+// stallReader detects stalled connections. The reader arms a watchdog timer
+// while waiting for data from the underlying reader. The watchdog cancels the
+// request if no data arrives before the timeout. Unlike a timeout on the
+// request, the watchdog does not fire when the application is slow to call
+// Next.
+type stallReader struct {
+	r        io.Reader
+	watchdog *time.Timer
+	timeout  time.Duration
+}
+
+func (sr *stallReader) Read(p []byte) (int, error) {
+	sr.watchdog.Reset(sr.timeout)
+	n, err := sr.r.Read(p)
+	sr.watchdog.Stop()
+	return n, err
+}
+
+// defaultClient returns the client used when the application does not
+// specify a client with the OpenHTTPClient option.
+func defaultClient(do *openOptions) *http.Client {
+	proxy := http.ProxyFromEnvironment
+	if do.proxyURL != nil {
+		proxy = http.ProxyURL(do.proxyURL)
+	}
+	var tlsConfig *tls.Config
+	if do.tlsConfig != nil {
+		tlsConfig = do.tlsConfig.Clone()
+	}
+	if len(do.pinnedKeys) > 0 {
+		if tlsConfig == nil {
+			tlsConfig = new(tls.Config)
 		}
-		if len(p) <= 2 {
-			break
+		verify := tlsConfig.VerifyConnection
+		pins := do.pinnedKeys
+		tlsConfig.VerifyConnection = func(cs tls.ConnectionState) error {
+			if verify != nil {
+				if err := verify(cs); err != nil {
+					return err
+				}
+			}
+			return verifyPinnedKeys(cs, pins)
 		}
 	}
-
-	statusCode, _ := strconv.Atoi(string(m[1]))
-	if statusCode != 200 {
-		p, _ := ioutil.ReadAll(ts.r)
-		return nil, HTTPStatusError{statusCode, string(p)}
+	return &http.Client{
+		Transport: &http.Transport{
+			TLSClientConfig:     tlsConfig,
+			Proxy:               proxy,
+			DialContext:         (&net.Dialer{Timeout: do.connectTimeout}).DialContext,
+			TLSHandshakeTimeout: do.connectTimeout,
+		},
 	}
+}
 
-	ts.chunkState = stateStart
-	return ts, nil
+var errPinnedKeys = errors.New("twitterstream: no certificate matches the pinned keys")
+
+// verifyPinnedKeys returns an error if no certificate in the verified chains
+// has a public key with one of the pinned hashes.
+func verifyPinnedKeys(cs tls.ConnectionState, pins []string) error {
+	for _, chain := range cs.VerifiedChains {
+		for _, cert := range chain {
+			sum := sha256.Sum256(cert.RawSubjectPublicKeyInfo)
+			hash := base64.StdEncoding.EncodeToString(sum[:])
+			for _, pin := range pins {
+				if hash == pin {
+					return nil
+				}
+			}
+		}
+	}
+	return errPinnedKeys
 }
 
 func (ts *Stream) fatal(err error) error {
-	if ts.conn != nil {
-		ts.conn.Close()
+	if cause := context.Cause(ts.ctx); cause != nil {
+		err = cause
+	} else if ts.disconnect != nil {
+		err = DisconnectError{*ts.disconnect}
+	}
+	ts.cancel(err)
+	if ts.watchdog != nil {
+		ts.watchdog.Stop()
 	}
+	if ts.body != nil {
+		ts.body.Close()
+	}
+	ts.flushCheckpoint()
 	if ts.err == nil {
 		ts.err = err
 	}
@@ -197,10 +548,32 @@ func (ts *Stream) fatal(err error) error {
 
 // Close releases the resources used by the stream.
 func (ts *Stream) Close() error {
+	if ts.messages != nil {
+		ts.quitOnce.Do(func() {
+			close(ts.quit)
+			ts.queue.abort()
+			ts.cancel(ErrStreamClosed)
+		})
+		<-ts.exited
+		ts.flushCheckpoint()
+		return ts.body.Close()
+	}
 	if ts.err != nil {
 		return ts.err
 	}
-	return ts.conn.Close()
+	ts.cancel(ErrStreamClosed)
+	ts.flushCheckpoint()
+	return ts.body.Close()
+}
+
+// flushCheckpoint saves the newest tweet ID to the checkpointer.
+func (ts *Stream) flushCheckpoint() {
+	if ts.checkpoint == nil {
+		return
+	}
+	if err := ts.checkpoint.flush(); err != nil {
+		ts.logger.Errorf("twitterstream: error saving checkpoint: %v", err)
+	}
 }
 
 // Err returns a non-nil value if the stream has a permanent error.
@@ -208,67 +581,348 @@ func (ts *Stream) Err() error {
 	return ts.err
 }
 
-const (
-	stateStart = iota
-	stateEnd
-	stateNormal
-)
+// Friends returns the friends list sent at the start of a user stream. The
+// list is available after Next returns the first line of the stream. Friends
+// returns nil for other streams.
+func (ts *Stream) Friends() *FriendsList {
+	return ts.friends
+}
 
-// Next returns the next line from the stream. The returned slice is
-// overwritten by the next call to Next.
+// DroppedCount returns the number of tweets matching the stream's filter that
+// were not delivered because of rate limits. The count is reported by limit
+// notices in the stream. DroppedCount can be called concurrently with Next.
+func (ts *Stream) DroppedCount() int64 {
+	return atomic.LoadInt64(&ts.dropped)
+}
+
+// Next returns the next line from the stream without the line terminator.
+// Lines are terminated by CRLF or LF. The returned slice is overwritten by
+// the next call to Next.
+//
+// Next does not copy the line. The slice aliases the stream's read buffer and
+// is valid only until the next call to a Next method. An application that
+// retains the line or passes the line to another goroutine must copy the
+// line or use NextCopy or NextPooled. Decoded values do not alias the buffer.
+//
+// Next returns ErrMessageTooLarge for a line longer than the limit set with
+// the OpenMaxMessageSize option. The stream is usable after this error. All
+// other errors are permanent.
 func (ts *Stream) Next() ([]byte, error) {
 	if ts.err != nil {
 		return nil, ts.err
 	}
 	for {
-		// Twitter sends at least one ine of text every 30 seconds.
-		err := ts.conn.SetReadDeadline(time.Now().Add(60 * time.Second))
-		if err != nil {
-			return nil, ts.fatal(err)
+		p, err := ts.readLine()
+		if err == ErrMessageTooLarge {
+			ts.logger.Errorf("twitterstream: discarded line longer than %d bytes", ts.maxMessageSize)
+			return nil, err
+		}
+		if ts.debugWriter != nil && len(p) > 0 {
+			ts.debug(p)
 		}
-
-		p, err := ts.r.ReadSlice('\n')
 		if err != nil {
 			return nil, ts.fatal(err)
 		}
 
-		switch ts.chunkState {
-		case stateStart:
-			ts.chunkRemaining, err = strconv.ParseInt(string(p[:len(p)-2]), 16, 64)
-			switch {
-			case err != nil:
-				return nil, ts.fatal(errors.New("error parsing chunk size"))
-			case ts.chunkRemaining == 0:
-				return nil, ts.fatal(errors.New("end of chunked stream"))
+		atomic.AddInt64(&ts.stats.bytes, int64(len(p)))
+
+		p = trimEOL(p)
+		if len(p) == 0 {
+			now := time.Now()
+			storeTime(&ts.stats.lastKeepalive, now)
+			ts.logger.Debugf("twitterstream: keepalive")
+			if ts.onKeepalive != nil {
+				ts.onKeepalive(now)
 			}
-			ts.chunkState = stateNormal
-			continue
-		case stateEnd:
-			ts.chunkState = stateStart
+			continue // ignore keepalive line
+		}
+
+		if ts.delimited && isLengthLine(p) {
 			continue
-		case stateNormal:
-			ts.chunkRemaining = ts.chunkRemaining - int64(len(p))
-			if ts.chunkRemaining == 0 {
-				ts.chunkState = stateEnd
+		}
+
+		atomic.AddInt64(&ts.stats.messages, 1)
+		storeTime(&ts.stats.lastMessage, time.Now())
+
+		if ts.tee != nil {
+			ts.teeBuf = append(append(ts.teeBuf[:0], p...), '\n')
+			if _, err := ts.tee.Write(ts.teeBuf); err != nil {
+				return nil, ts.fatal(TeeError{err})
 			}
 		}
 
-		if len(p) <= 2 {
-			continue // ignore keepalive line
+		if ts.onWarning != nil && bytes.HasPrefix(p, warningPrefix) {
+			var m struct {
+				Warning Warning `json:"warning"`
+			}
+			if json.Unmarshal(p, &m) == nil {
+				ts.logger.Infof("twitterstream: warning %s: %s", m.Warning.Code, m.Warning.Message)
+				ts.onWarning(&m.Warning)
+			}
+		}
+
+		if ts.friends == nil && bytes.HasPrefix(p, friendsPrefix) {
+			if fl, err := ParseFriendsList(p); err == nil {
+				ts.friends = fl
+			}
+		}
+
+		if ts.controlURI == "" && bytes.HasPrefix(p, controlPrefix) {
+			if uri, err := parseControlURI(p); err == nil {
+				ts.controlURI = uri
+			}
+		}
+
+		if bytes.HasPrefix(p, disconnectPrefix) {
+			if d, err := ParseDisconnect(p); err == nil {
+				ts.logger.Infof("twitterstream: disconnect code=%d stream=%s reason=%s", d.Code, d.StreamName, d.Reason)
+				ts.disconnect = d
+			}
+		}
+
+		if bytes.HasPrefix(p, limitPrefix) {
+			if l, err := ParseLimit(p); err == nil {
+				// The count in the notice is cumulative for the
+				// connection.
+				ts.logger.Infof("twitterstream: limit notice, %d tweets undelivered", l.Track)
+				ts.limitGap(l.Track)
+				if l.Track > atomic.LoadInt64(&ts.dropped) {
+					atomic.StoreInt64(&ts.dropped, l.Track)
+				}
+				if ts.onLimit != nil {
+					ts.onLimit(l)
+				}
+			}
+		}
+
+		if ts.onDelete != nil && bytes.HasPrefix(p, deletePrefix) {
+			if d, err := ParseDelete(p); err == nil {
+				ts.onDelete(d)
+				continue
+			}
+		}
+
+		if ts.checkpoint != nil || ts.deduper != nil {
+			if id, ok := tweetID(p); ok {
+				if ts.deduper != nil && ts.deduper.Seen(id) {
+					continue
+				}
+				if ts.checkpoint != nil {
+					if err := ts.checkpoint.update(id); err != nil {
+						ts.logger.Errorf("twitterstream: error saving checkpoint: %v", err)
+					}
+				}
+			}
+		}
+
+		if ts.filter != nil && !ts.filter(p) {
+			continue
 		}
 
 		return p, nil
 	}
-	panic("should not get here")
+}
+
+// trimEOL removes the CRLF or LF line terminator from p.
+func trimEOL(p []byte) []byte {
+	if n := len(p); n > 0 && p[n-1] == '\n' {
+		p = p[:n-1]
+		if n := len(p); n > 0 && p[n-1] == '\r' {
+			p = p[:n-1]
+		}
+	}
+	return p
+}
+
+// readLine reads a line from the stream. Lines longer than the reader's
+// buffer are assembled in ts.long.
+func (ts *Stream) readLine() ([]byte, error) {
+	p, err := ts.r.ReadSlice('\n')
+	if err != bufio.ErrBufferFull {
+		if err == nil && ts.maxMessageSize > 0 && len(p) > ts.maxMessageSize {
+			return nil, ErrMessageTooLarge
+		}
+		return p, err
+	}
+	ts.long = append(ts.long[:0], p...)
+	for err == bufio.ErrBufferFull {
+		if ts.maxMessageSize > 0 && len(ts.long) > ts.maxMessageSize {
+			// Discard the rest of the line.
+			for err == bufio.ErrBufferFull {
+				_, err = ts.r.ReadSlice('\n')
+			}
+			if err != nil {
+				return nil, err
+			}
+			return nil, ErrMessageTooLarge
+		}
+		p, err = ts.r.ReadSlice('\n')
+		ts.long = append(ts.long, p...)
+	}
+	if err == nil && ts.maxMessageSize > 0 && len(ts.long) > ts.maxMessageSize {
+		return nil, ErrMessageTooLarge
+	}
+	return ts.long, err
+}
+
+// debug writes a line to the debug writer.
+func (ts *Stream) debug(p []byte) {
+	buf := time.Now().AppendFormat(nil, time.RFC3339Nano)
+	buf = append(buf, ' ')
+	buf = append(buf, p...)
+	if len(p) == 0 || p[len(p)-1] != '\n' {
+		buf = append(buf, '\n')
+	}
+	ts.debugWriter.Write(buf)
+}
+
+var (
+	warningPrefix = []byte(`{"warning":`)
+	deletePrefix  = []byte(`{"delete":`)
+	limitPrefix   = []byte(`{"limit":`)
+
+	disconnectPrefix = []byte(`{"disconnect":`)
+	friendsPrefix    = []byte(`{"friends`)
+	controlPrefix    = []byte(`{"control":`)
+)
+
+// isLengthLine returns true if p is a message length line.
+func isLengthLine(p []byte) bool {
+	for _, b := range p {
+		if b < '0' || b > '9' {
+			return false
+		}
+	}
+	return true
 }
 
 // UnmarshalNext reads the next line of from the stream and decodes the line as
 // JSON to data. This is a convenience function for streams with homogeneous
-// entity types. 
+// entity types. Use the OpenDecoder option to specify the decoder and the
+// OpenUseNumber option to decode numbers as json.Number.
 func (ts *Stream) UnmarshalNext(data interface{}) error {
 	p, err := ts.Next()
 	if err != nil {
 		return err
 	}
-	return json.Unmarshal(p, data)
+	if err := ts.decoder.Unmarshal(p, data); err != nil {
+		atomic.AddInt64(&ts.stats.decodeErrors, 1)
+		return err
+	}
+	return nil
+}
+
+// Message is a line read from the stream by the goroutine started by
+// Messages.
+type Message struct {
+	// Kind is the type of the message as determined by KindOf.
+	Kind MessageKind
+
+	// Raw is the line without the line terminator. The application owns
+	// the slice until the application calls Release.
+	Raw json.RawMessage
+
+	// Received is the time the line was read from the stream.
+	Received time.Time
+
+	// Source is the label of the stream specified with the OpenSource
+	// option.
+	Source string
+
+	ack  func()
+	line *Line
+}
+
+// Ack acknowledges that the application has processed the message. Ack is
+// required for streams opened with the OpenAtLeastOnce option and does
+// nothing for other messages.
+func (m Message) Ack() {
+	if m.ack != nil {
+		m.ack()
+	}
+}
+
+// Release returns the buffer holding Raw to a pool for reuse by later
+// messages. Calling Release reduces allocations and garbage collection on
+// high volume streams. Release is optional. The application must not use Raw
+// after calling Release.
+func (m Message) Release() {
+	if m.line != nil {
+		m.line.Release()
+	}
+}
+
+// Messages starts a goroutine that reads the stream and returns a channel of
+// the lines read by the goroutine. The goroutine queues up to depth messages
+// ahead of the application, and up to the byte limit specified by the
+// OpenQueueBytes option. When the queue is full, the goroutine applies the
+// policy specified by the OpenOverflowPolicy option. The channel is closed
+// when the stream has a permanent error or when the stream is closed. After
+// the channel is closed, Err returns the error that terminated the stream.
+//
+// The application must not call Next or UnmarshalNext after calling
+// Messages. Messages returns the same channel on every call.
+func (ts *Stream) Messages(depth int) <-chan Message {
+	if ts.messages != nil {
+		return ts.messages
+	}
+	ts.messages = make(chan Message)
+	ts.quit = make(chan struct{})
+	ts.exited = make(chan struct{})
+	ts.queue = newMessageQueue(depth, ts.overflow, ts.queueBytes)
+	if ts.spillDir != "" {
+		spill, err := openSpillQueue(ts.spillDir, spillSegmentSize, ts.atLeastOnce)
+		if err != nil {
+			ts.fatal(err)
+			close(ts.messages)
+			close(ts.exited)
+			return ts.messages
+		}
+		spill.source = ts.source
+		ts.queue.spill = spill
+		ts.queue.spilled = int64(spill.len())
+	}
+
+	var wg sync.WaitGroup
+	wg.Add(2)
+	go func() {
+		defer wg.Done()
+		defer ts.queue.close()
+		for {
+			p, err := ts.Next()
+			if err == ErrMessageTooLarge {
+				continue
+			}
+			if err != nil {
+				return
+			}
+			m := ts.message(p)
+			if !ts.queue.put(m) {
+				if err := ts.queue.error(); err != nil {
+					ts.fatal(err)
+				}
+				return
+			}
+		}
+	}()
+	go func() {
+		defer wg.Done()
+		defer close(ts.messages)
+		for {
+			m, ok := ts.queue.get()
+			if !ok {
+				return
+			}
+			select {
+			case ts.messages <- m:
+			case <-ts.quit:
+				return
+			}
+		}
+	}()
+	go func() {
+		wg.Wait()
+		close(ts.exited)
+	}()
+	return ts.messages
 }
@@ -0,0 +1,132 @@
+// Copyright 2010 Gary Burd
+//
+// Licensed under the Apache License, Version 2.0 (the "License"): you may
+// not use this file except in compliance with the License. You may obtain
+// a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+// WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the
+// License for the specific language governing permissions and limitations
+// under the License.
+
+package twitterstream
+
+import (
+	"bufio"
+	"context"
+	"io"
+	"strings"
+	"testing"
+	"time"
+)
+
+// newTestStream returns a stream that reads from r.
+func newTestStream(r io.Reader) *Stream {
+	ts := &Stream{
+		r:              bufio.NewReader(r),
+		body:           io.NopCloser(strings.NewReader("")),
+		logger:         nopLogger{},
+		decoder:        jsonDecoder{},
+		maxMessageSize: 1 << 20,
+	}
+	ts.ctx, ts.cancel = context.WithCancelCause(context.Background())
+	storeTime(&ts.stats.connected, time.Now())
+	return ts
+}
+
+// repeatReader returns line repeatedly.
+type repeatReader struct {
+	line []byte
+	off  int
+}
+
+func (r *repeatReader) Read(p []byte) (int, error) {
+	n := 0
+	for n < len(p) {
+		m := copy(p[n:], r.line[r.off:])
+		n += m
+		r.off = (r.off + m) % len(r.line)
+	}
+	return n, nil
+}
+
+const benchmarkLine = `{"created_at":"Wed Oct 10 20:19:24 +0000 2018","id":1050118621198921728,"id_str":"1050118621198921728","text":"To make room for more expression, we will now count all emojis as equal","user":{"id":6253282,"id_str":"6253282","name":"Twitter API","screen_name":"TwitterAPI"},"lang":"en","timestamp_ms":"1539202764000"}` + "\r\n"
+
+func TestNextLineTerminators(t *testing.T) {
+	ts := newTestStream(strings.NewReader("{\"id\":1}\r\n\r\n{\"id\":2}\n\n{\"id\":3}\n"))
+	for _, want := range []string{`{"id":1}`, `{"id":2}`, `{"id":3}`} {
+		p, err := ts.Next()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(p) != want {
+			t.Fatalf("Next() = %q, want %q", p, want)
+		}
+	}
+	if _, err := ts.Next(); err == nil {
+		t.Fatal("Next() returned nil error at end of stream")
+	}
+}
+
+func BenchmarkNext(b *testing.B) {
+	for _, bm := range []struct {
+		name string
+		next func(ts *Stream) error
+	}{
+		{"Next", func(ts *Stream) error {
+			_, err := ts.Next()
+			return err
+		}},
+		{"NextCopy", func(ts *Stream) error {
+			_, err := ts.NextCopy()
+			return err
+		}},
+		{"NextPooled", func(ts *Stream) error {
+			l, err := ts.NextPooled()
+			if err == nil {
+				l.Release()
+			}
+			return err
+		}},
+	} {
+		b.Run(bm.name, func(b *testing.B) {
+			ts := newTestStream(&repeatReader{line: []byte(benchmarkLine)})
+			b.SetBytes(int64(len(benchmarkLine)))
+			b.ReportAllocs()
+			for i := 0; i < b.N; i++ {
+				if err := bm.next(ts); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+}
+
+func BenchmarkMessages(b *testing.B) {
+	for _, release := range []bool{false, true} {
+		name := "NoRelease"
+		if release {
+			name = "Release"
+		}
+		b.Run(name, func(b *testing.B) {
+			ts := newTestStream(&repeatReader{line: []byte(benchmarkLine)})
+			messages := ts.Messages(100)
+			b.SetBytes(int64(len(benchmarkLine)))
+			b.ReportAllocs()
+			for i := 0; i < b.N; i++ {
+				m, ok := <-messages
+				if !ok {
+					b.Fatal(ts.Err())
+				}
+				if release {
+					m.Release()
+				}
+			}
+			b.StopTimer()
+			ts.Close()
+		})
+	}
+}
@@ -0,0 +1,78 @@
+// Copyright 2010 Gary Burd
+//
+// Licensed under the Apache License, Version 2.0 (the "License"): you may
+// not use this file except in compliance with the License. You may obtain
+// a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+// WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the
+// License for the specific language governing permissions and limitations
+// under the License.
+
+package twitterstream
+
+import (
+	"strings"
+	"unicode/utf8"
+)
+
+// SliceUTF16 returns the substring of s between the start and end offsets in
+// UTF-16 code units. Twitter specifies entity indices and display ranges in
+// code units, where characters outside the Basic Multilingual Plane such as
+// most emoji count as two units. The offsets are clamped to the length of s.
+// An offset in the middle of a surrogate pair is rounded up to the next
+// character.
+func SliceUTF16(s string, start, end int) string {
+	i := ByteOffsetUTF16(s, start)
+	j := ByteOffsetUTF16(s, end)
+	if i > j {
+		return ""
+	}
+	return s[i:j]
+}
+
+// ByteOffsetUTF16 converts an offset in UTF-16 code units to a byte offset
+// in s. The offset is clamped to the length of s.
+func ByteOffsetUTF16(s string, offset int) int {
+	n := 0
+	for k, r := range s {
+		if n >= offset {
+			return k
+		}
+		n += utf16Len(r)
+	}
+	return len(s)
+}
+
+// LenUTF16 returns the length of s in UTF-16 code units. Twitter counts
+// the length of display_text_range and entity indices in these units.
+func LenUTF16(s string) int {
+	n := 0
+	for _, r := range s {
+		n += utf16Len(r)
+	}
+	return n
+}
+
+var textUnescaper = strings.NewReplacer("&lt;", "<", "&gt;", ">", "&amp;", "&")
+
+// UnescapeText replaces the HTML entities &amp;, &lt; and &gt; in tweet text
+// with the characters &, < and >. Twitter escapes these characters in the
+// text of tweets and does not escape other characters.
+func UnescapeText(s string) string {
+	if strings.IndexByte(s, '&') < 0 {
+		return s
+	}
+	return textUnescaper.Replace(s)
+}
+
+// utf16Len returns the number of UTF-16 code units for r.
+func utf16Len(r rune) int {
+	if r >= 0x10000 && r <= utf8.MaxRune {
+		return 2
+	}
+	return 1
+}
@@ -0,0 +1,107 @@
+// Copyright 2010 Gary Burd
+//
+// Licensed under the Apache License, Version 2.0 (the "License"): you may
+// not use this file except in compliance with the License. You may obtain
+// a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+// WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the
+// License for the specific language governing permissions and limitations
+// under the License.
+
+package twitterstream
+
+import (
+	"errors"
+	"strconv"
+	"time"
+)
+
+// TwitterTimeLayout is the layout of the created_at field in the v1.1 API.
+const TwitterTimeLayout = time.RubyDate
+
+// TwitterTime is a time decoded from the JSON representations of time used
+// by Twitter: the created_at format "Mon Jan 02 15:04:05 +0000 2006", the
+// RFC 3339 format used by the v2 API and the timestamp_ms format of
+// milliseconds since the epoch as a string or number. A null value decodes
+// to the zero time.
+type TwitterTime struct {
+	time.Time
+}
+
+// UnmarshalJSON implements the json.Unmarshaler interface.
+func (t *TwitterTime) UnmarshalJSON(p []byte) error {
+	s := string(p)
+	if s == "null" {
+		t.Time = time.Time{}
+		return nil
+	}
+	if len(s) >= 2 && s[0] == '"' && s[len(s)-1] == '"' {
+		s = s[1 : len(s)-1]
+	}
+	if s == "" {
+		t.Time = time.Time{}
+		return nil
+	}
+	if ms, err := strconv.ParseInt(s, 10, 64); err == nil {
+		t.Time = time.UnixMilli(ms).UTC()
+		return nil
+	}
+	for _, layout := range []string{TwitterTimeLayout, time.RFC3339Nano} {
+		if tt, err := time.Parse(layout, s); err == nil {
+			t.Time = tt
+			return nil
+		}
+	}
+	return errors.New("twitterstream: cannot parse time " + string(p))
+}
+
+// MarshalJSON implements the json.Marshaler interface. The time is encoded
+// in the created_at format. The zero time is encoded as null.
+func (t TwitterTime) MarshalJSON() ([]byte, error) {
+	if t.IsZero() {
+		return []byte("null"), nil
+	}
+	return strconv.AppendQuote(nil, t.Format(TwitterTimeLayout)), nil
+}
+
+// UnixMillis is a time decoded from the timestamp_ms fields used by Twitter:
+// milliseconds since the epoch as a string or number. A null value decodes to
+// the zero time.
+type UnixMillis struct {
+	time.Time
+}
+
+// UnmarshalJSON implements the json.Unmarshaler interface.
+func (t *UnixMillis) UnmarshalJSON(p []byte) error {
+	s := string(p)
+	if s == "null" {
+		t.Time = time.Time{}
+		return nil
+	}
+	if len(s) >= 2 && s[0] == '"' && s[len(s)-1] == '"' {
+		s = s[1 : len(s)-1]
+	}
+	if s == "" {
+		t.Time = time.Time{}
+		return nil
+	}
+	ms, err := strconv.ParseInt(s, 10, 64)
+	if err != nil {
+		return errors.New("twitterstream: cannot parse timestamp " + string(p))
+	}
+	t.Time = time.UnixMilli(ms).UTC()
+	return nil
+}
+
+// MarshalJSON implements the json.Marshaler interface. The time is encoded as
+// a string of milliseconds since the epoch. The zero time is encoded as null.
+func (t UnixMillis) MarshalJSON() ([]byte, error) {
+	if t.IsZero() {
+		return []byte("null"), nil
+	}
+	return strconv.AppendQuote(nil, strconv.FormatInt(t.UnixMilli(), 10)), nil
+}
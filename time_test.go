@@ -0,0 +1,74 @@
+// Copyright 2010 Gary Burd
+//
+// Licensed under the Apache License, Version 2.0 (the "License"): you may
+// not use this file except in compliance with the License. You may obtain
+// a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+// WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the
+// License for the specific language governing permissions and limitations
+// under the License.
+
+package twitterstream
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+)
+
+func TestUnixMillisRoundTrip(t *testing.T) {
+	for _, p := range []string{`"1539202764123"`, `null`} {
+		var v UnixMillis
+		if err := json.Unmarshal([]byte(p), &v); err != nil {
+			t.Fatalf("Unmarshal(%s) returned error %v", p, err)
+		}
+		q, err := json.Marshal(v)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(q) != p {
+			t.Errorf("Marshal(Unmarshal(%s)) = %s", p, q)
+		}
+	}
+}
+
+func TestUnixMillisUnmarshal(t *testing.T) {
+	want := time.Date(2018, 10, 10, 20, 19, 24, 123e6, time.UTC)
+	for _, p := range []string{`"1539202764123"`, `1539202764123`} {
+		var v UnixMillis
+		if err := json.Unmarshal([]byte(p), &v); err != nil {
+			t.Fatalf("Unmarshal(%s) returned error %v", p, err)
+		}
+		if !v.Equal(want) {
+			t.Errorf("Unmarshal(%s) = %v, want %v", p, v.Time, want)
+		}
+	}
+	var v UnixMillis
+	if err := json.Unmarshal([]byte(`"Wed Oct 10 20:19:24 +0000 2018"`), &v); err == nil {
+		t.Error("Unmarshal(created_at) returned nil error")
+	}
+}
+
+func TestTweetTimestampMsMarshal(t *testing.T) {
+	var tw Tweet
+	if err := json.Unmarshal([]byte(`{"id_str":"1","timestamp_ms":"1539202764000"}`), &tw); err != nil {
+		t.Fatal(err)
+	}
+	p, err := json.Marshal(&tw)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var m struct {
+		TimestampMs string `json:"timestamp_ms"`
+	}
+	if err := json.Unmarshal(p, &m); err != nil {
+		t.Fatal(err)
+	}
+	if m.TimestampMs != "1539202764000" {
+		t.Errorf("timestamp_ms = %q, want %q", m.TimestampMs, "1539202764000")
+	}
+}
@@ -0,0 +1,322 @@
+// Copyright 2010 Gary Burd
+//
+// Licensed under the Apache License, Version 2.0 (the "License"): you may
+// not use this file except in compliance with the License. You may obtain
+// a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+// WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the
+// License for the specific language governing permissions and limitations
+// under the License.
+
+package twitterstream
+
+// Tweet represents a status message from the stream. See
+// https://dev.twitter.com/overview/api/tweets for a description of the
+// fields.
+//
+// The ID fields are decoded from the JSON numbers directly to int64 without
+// loss of precision. The ID string fields hold the same values for
+// applications that pass IDs to JavaScript or other environments where
+// numbers are float64.
+type Tweet struct {
+	ID                   int64          `json:"id"`
+	IDStr                string         `json:"id_str"`
+	CreatedAt            TwitterTime    `json:"created_at"`
+	Text                 string         `json:"text"`
+	FullText             string         `json:"full_text,omitempty"`
+	DisplayTextRange     []int          `json:"display_text_range,omitempty"`
+	Source               string         `json:"source"`
+	Truncated            bool           `json:"truncated"`
+	InReplyToStatusID    int64          `json:"in_reply_to_status_id"`
+	InReplyToStatusIDStr string         `json:"in_reply_to_status_id_str"`
+	InReplyToUserID      int64          `json:"in_reply_to_user_id"`
+	InReplyToUserIDStr   string         `json:"in_reply_to_user_id_str"`
+	InReplyToScreenName  string         `json:"in_reply_to_screen_name"`
+	User                 *User          `json:"user"`
+	Coordinates          *Coordinates   `json:"coordinates"`
+	Place                *Place         `json:"place"`
+	QuotedStatusID       int64          `json:"quoted_status_id,omitempty"`
+	QuotedStatusIDStr    string         `json:"quoted_status_id_str,omitempty"`
+	IsQuoteStatus        bool           `json:"is_quote_status"`
+	QuotedStatus         *Tweet         `json:"quoted_status,omitempty"`
+	RetweetedStatus      *Tweet         `json:"retweeted_status,omitempty"`
+	ExtendedTweet        *ExtendedTweet `json:"extended_tweet,omitempty"`
+	QuoteCount           int            `json:"quote_count"`
+	ReplyCount           int            `json:"reply_count"`
+	RetweetCount         int            `json:"retweet_count"`
+	FavoriteCount        int            `json:"favorite_count"`
+	Entities             *Entities      `json:"entities"`
+	ExtendedEntities     *Entities      `json:"extended_entities,omitempty"`
+	Favorited            bool           `json:"favorited"`
+	Retweeted            bool           `json:"retweeted"`
+	PossiblySensitive    bool           `json:"possibly_sensitive,omitempty"`
+	FilterLevel          string         `json:"filter_level"`
+	Lang                 string         `json:"lang"`
+	TimestampMs          UnixMillis     `json:"timestamp_ms"`
+	WithheldInCountries  []string       `json:"withheld_in_countries,omitempty"`
+}
+
+// ExtendedTweet holds the untruncated text and entities of a tweet longer than
+// 140 characters.
+type ExtendedTweet struct {
+	FullText         string    `json:"full_text"`
+	DisplayTextRange []int     `json:"display_text_range"`
+	Entities         *Entities `json:"entities"`
+	ExtendedEntities *Entities `json:"extended_entities,omitempty"`
+}
+
+// User represents a Twitter user.
+type User struct {
+	ID                   int64       `json:"id"`
+	IDStr                string      `json:"id_str"`
+	Name                 string      `json:"name"`
+	ScreenName           string      `json:"screen_name"`
+	Location             string      `json:"location"`
+	URL                  string      `json:"url"`
+	Description          string      `json:"description"`
+	Protected            bool        `json:"protected"`
+	Verified             bool        `json:"verified"`
+	FollowersCount       int         `json:"followers_count"`
+	FriendsCount         int         `json:"friends_count"`
+	ListedCount          int         `json:"listed_count"`
+	FavouritesCount      int         `json:"favourites_count"`
+	StatusesCount        int         `json:"statuses_count"`
+	CreatedAt            TwitterTime `json:"created_at"`
+	GeoEnabled           bool        `json:"geo_enabled"`
+	Lang                 string      `json:"lang"`
+	ProfileImageURLHTTPS string      `json:"profile_image_url_https"`
+	DefaultProfile       bool        `json:"default_profile"`
+	DefaultProfileImage  bool        `json:"default_profile_image"`
+	WithheldInCountries  []string    `json:"withheld_in_countries,omitempty"`
+}
+
+// Entities holds the metadata and contextual information extracted from the
+// text of a tweet.
+type Entities struct {
+	Hashtags     []HashtagEntity     `json:"hashtags"`
+	Symbols      []HashtagEntity     `json:"symbols"`
+	URLs         []URLEntity         `json:"urls"`
+	UserMentions []UserMentionEntity `json:"user_mentions"`
+	Media        []MediaEntity       `json:"media,omitempty"`
+}
+
+// HashtagEntity represents a hashtag or cashtag symbol in the text of a
+// tweet.
+type HashtagEntity struct {
+	Indices []int  `json:"indices"`
+	Text    string `json:"text"`
+}
+
+// URLEntity represents a URL in the text of a tweet.
+type URLEntity struct {
+	Indices     []int  `json:"indices"`
+	URL         string `json:"url"`
+	DisplayURL  string `json:"display_url"`
+	ExpandedURL string `json:"expanded_url"`
+}
+
+// UserMentionEntity represents a mention of another user in the text of a
+// tweet.
+type UserMentionEntity struct {
+	Indices    []int  `json:"indices"`
+	ID         int64  `json:"id"`
+	IDStr      string `json:"id_str"`
+	Name       string `json:"name"`
+	ScreenName string `json:"screen_name"`
+}
+
+// MediaEntity represents media attached to a tweet.
+type MediaEntity struct {
+	Indices       []int      `json:"indices"`
+	ID            int64      `json:"id"`
+	IDStr         string     `json:"id_str"`
+	Type          string     `json:"type"`
+	URL           string     `json:"url"`
+	DisplayURL    string     `json:"display_url"`
+	ExpandedURL   string     `json:"expanded_url"`
+	MediaURLHTTPS string     `json:"media_url_https"`
+	VideoInfo     *VideoInfo `json:"video_info,omitempty"`
+}
+
+// VideoInfo describes the encodings of video and animated GIF media.
+type VideoInfo struct {
+	AspectRatio    []int          `json:"aspect_ratio"`
+	DurationMillis int            `json:"duration_millis"`
+	Variants       []VideoVariant `json:"variants"`
+}
+
+// VideoVariant is a single encoding of a video.
+type VideoVariant struct {
+	Bitrate     int    `json:"bitrate"`
+	ContentType string `json:"content_type"`
+	URL         string `json:"url"`
+}
+
+// Coordinates is a GeoJSON point. The coordinates are in longitude, latitude
+// order.
+type Coordinates struct {
+	Type        string     `json:"type"`
+	Coordinates [2]float64 `json:"coordinates"`
+}
+
+// Place represents a named location associated with a tweet.
+type Place struct {
+	ID          string   `json:"id"`
+	URL         string   `json:"url"`
+	PlaceType   string   `json:"place_type"`
+	Name        string   `json:"name"`
+	FullName    string   `json:"full_name"`
+	CountryCode string   `json:"country_code"`
+	Country     string   `json:"country"`
+	BoundingBox *Polygon `json:"bounding_box"`
+}
+
+// Polygon is a GeoJSON polygon. The coordinates are in longitude, latitude
+// order.
+type Polygon struct {
+	Type        string         `json:"type"`
+	Coordinates [][][2]float64 `json:"coordinates"`
+}
+
+// UntruncatedText returns the complete text of the tweet. For a retweet, the
+// text is the complete text of the retweeted tweet without the "RT @user: "
+// prefix. The text is resolved from the extended_tweet object sent for
+// tweets longer than 140 characters in compatibility mode, the full_text
+// field sent in extended mode and the text field, in that order.
+func (t *Tweet) UntruncatedText() string {
+	text, _ := t.untruncated()
+	return text
+}
+
+// DisplayText returns the displayable part of UntruncatedText. The display
+// range excludes the leading @mentions of a reply and the trailing link to
+// attached media.
+func (t *Tweet) DisplayText() string {
+	text, r := t.untruncated()
+	if len(r) != 2 {
+		return text
+	}
+	return SliceUTF16(text, r[0], r[1])
+}
+
+// untruncated returns the complete text and the display range of the tweet.
+func (t *Tweet) untruncated() (string, []int) {
+	if t.RetweetedStatus != nil {
+		return t.RetweetedStatus.untruncated()
+	}
+	switch {
+	case t.ExtendedTweet != nil:
+		return t.ExtendedTweet.FullText, t.ExtendedTweet.DisplayTextRange
+	case t.FullText != "":
+		return t.FullText, t.DisplayTextRange
+	}
+	return t.Text, t.DisplayTextRange
+}
+
+// Original returns the tweet that was retweeted or t if t is not a retweet.
+// The author of the original tweet is the User field of the returned tweet.
+func (t *Tweet) Original() *Tweet {
+	for t.RetweetedStatus != nil {
+		t = t.RetweetedStatus
+	}
+	return t
+}
+
+// Quoted returns the tweet quoted by the original tweet or nil if the
+// original tweet does not quote a tweet. The quoted tweet is resolved
+// through Original, so Quoted returns the quoted tweet of a retweeted quote
+// tweet.
+func (t *Tweet) Quoted() *Tweet {
+	return t.Original().QuotedStatus
+}
+
+// entities returns the entities and extended entities for UntruncatedText.
+func (t *Tweet) entities() (*Entities, *Entities) {
+	if t.RetweetedStatus != nil {
+		return t.RetweetedStatus.entities()
+	}
+	if t.ExtendedTweet != nil {
+		return t.ExtendedTweet.Entities, t.ExtendedTweet.ExtendedEntities
+	}
+	return t.Entities, t.ExtendedEntities
+}
+
+// Hashtags returns the hashtags in the tweet. The indices of the hashtags
+// and of the other entities returned by the Tweet methods are offsets in
+// UntruncatedText. Use EntityText to get the text at the indices.
+func (t *Tweet) Hashtags() []HashtagEntity {
+	if e, _ := t.entities(); e != nil {
+		return e.Hashtags
+	}
+	return nil
+}
+
+// Symbols returns the cashtag symbols in the tweet.
+func (t *Tweet) Symbols() []HashtagEntity {
+	if e, _ := t.entities(); e != nil {
+		return e.Symbols
+	}
+	return nil
+}
+
+// Mentions returns the user mentions in the tweet.
+func (t *Tweet) Mentions() []UserMentionEntity {
+	if e, _ := t.entities(); e != nil {
+		return e.UserMentions
+	}
+	return nil
+}
+
+// URLs returns the URLs in the tweet.
+func (t *Tweet) URLs() []URLEntity {
+	if e, _ := t.entities(); e != nil {
+		return e.URLs
+	}
+	return nil
+}
+
+// Media returns the media attached to the tweet. The media are taken from
+// the extended entities, which list every photo in a multi-photo tweet and
+// include the video information.
+func (t *Tweet) Media() []MediaEntity {
+	e, x := t.entities()
+	if x != nil && len(x.Media) > 0 {
+		return x.Media
+	}
+	if e != nil {
+		return e.Media
+	}
+	return nil
+}
+
+// EntityText returns the text of UntruncatedText at the indices of an
+// entity. The indices are in UTF-16 code units.
+func (t *Tweet) EntityText(indices []int) string {
+	if len(indices) != 2 {
+		return ""
+	}
+	return SliceUTF16(t.UntruncatedText(), indices[0], indices[1])
+}
+
+// UnescapeText replaces the HTML entities in the text fields of the tweet
+// and the retweeted and quoted tweets using the function UnescapeText. Call
+// UnescapeText before displaying or indexing the text. The method is not
+// idempotent: text containing "&amp;lt;" is unescaped to "<" by a second
+// call.
+func (t *Tweet) UnescapeText() {
+	t.Text = UnescapeText(t.Text)
+	t.FullText = UnescapeText(t.FullText)
+	if t.ExtendedTweet != nil {
+		t.ExtendedTweet.FullText = UnescapeText(t.ExtendedTweet.FullText)
+	}
+	if t.RetweetedStatus != nil {
+		t.RetweetedStatus.UnescapeText()
+	}
+	if t.QuotedStatus != nil {
+		t.QuotedStatus.UnescapeText()
+	}
+}
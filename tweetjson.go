@@ -0,0 +1,523 @@
+// Copyright 2010 Gary Burd
+//
+// Licensed under the Apache License, Version 2.0 (the "License"): you may
+// not use this file except in compliance with the License. You may obtain
+// a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+// WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the
+// License for the specific language governing permissions and limitations
+// under the License.
+
+package twitterstream
+
+import (
+	"encoding/json"
+	"strconv"
+	"strings"
+)
+
+// The functions in this file decode the Tweet type and the types nested in
+// Tweet without reflection. Decoding dominates the CPU time of applications
+// that read high volume streams. The functions fall back to encoding/json for
+// values that cannot be decoded directly, such as strings with invalid UTF-8.
+//
+// The functions are not UnmarshalJSON methods on the types because the
+// methods would be promoted to application types that embed the types. The
+// default decoder calls decodeTweet for *Tweet values only.
+
+// decodeTweet decodes the JSON object p to t with the semantics of
+// encoding/json.
+func decodeTweet(p []byte, t *Tweet) error {
+	if isNull(p) {
+		return nil
+	}
+	return decodeObject(p, func(key, v []byte) error {
+		switch string(key) {
+		case "id":
+			return decodeInt64(v, &t.ID)
+		case "id_str":
+			return decodeString(v, &t.IDStr)
+		case "created_at":
+			return t.CreatedAt.UnmarshalJSON(v)
+		case "text":
+			return decodeString(v, &t.Text)
+		case "full_text":
+			return decodeString(v, &t.FullText)
+		case "display_text_range":
+			return decodeInts(v, &t.DisplayTextRange)
+		case "source":
+			return decodeString(v, &t.Source)
+		case "truncated":
+			return decodeBool(v, &t.Truncated)
+		case "in_reply_to_status_id":
+			return decodeInt64(v, &t.InReplyToStatusID)
+		case "in_reply_to_status_id_str":
+			return decodeString(v, &t.InReplyToStatusIDStr)
+		case "in_reply_to_user_id":
+			return decodeInt64(v, &t.InReplyToUserID)
+		case "in_reply_to_user_id_str":
+			return decodeString(v, &t.InReplyToUserIDStr)
+		case "in_reply_to_screen_name":
+			return decodeString(v, &t.InReplyToScreenName)
+		case "user":
+			return decodePtr(v, &t.User, decodeUser)
+		case "coordinates":
+			return decodePtr(v, &t.Coordinates, decodeCoordinates)
+		case "place":
+			return decodePtr(v, &t.Place, decodePlace)
+		case "quoted_status_id":
+			return decodeInt64(v, &t.QuotedStatusID)
+		case "quoted_status_id_str":
+			return decodeString(v, &t.QuotedStatusIDStr)
+		case "is_quote_status":
+			return decodeBool(v, &t.IsQuoteStatus)
+		case "quoted_status":
+			return decodePtr(v, &t.QuotedStatus, decodeTweet)
+		case "retweeted_status":
+			return decodePtr(v, &t.RetweetedStatus, decodeTweet)
+		case "extended_tweet":
+			return decodePtr(v, &t.ExtendedTweet, decodeExtendedTweet)
+		case "quote_count":
+			return decodeInt(v, &t.QuoteCount)
+		case "reply_count":
+			return decodeInt(v, &t.ReplyCount)
+		case "retweet_count":
+			return decodeInt(v, &t.RetweetCount)
+		case "favorite_count":
+			return decodeInt(v, &t.FavoriteCount)
+		case "entities":
+			return decodePtr(v, &t.Entities, decodeEntities)
+		case "extended_entities":
+			return decodePtr(v, &t.ExtendedEntities, decodeEntities)
+		case "favorited":
+			return decodeBool(v, &t.Favorited)
+		case "retweeted":
+			return decodeBool(v, &t.Retweeted)
+		case "possibly_sensitive":
+			return decodeBool(v, &t.PossiblySensitive)
+		case "filter_level":
+			return decodeString(v, &t.FilterLevel)
+		case "lang":
+			return decodeString(v, &t.Lang)
+		case "timestamp_ms":
+			return t.TimestampMs.UnmarshalJSON(v)
+		case "withheld_in_countries":
+			return decodeArray(v, &t.WithheldInCountries, decodeString)
+		}
+		return nil
+	})
+}
+
+func decodeUser(p []byte, u *User) error {
+	if isNull(p) {
+		return nil
+	}
+	return decodeObject(p, func(key, v []byte) error {
+		switch string(key) {
+		case "id":
+			return decodeInt64(v, &u.ID)
+		case "id_str":
+			return decodeString(v, &u.IDStr)
+		case "name":
+			return decodeString(v, &u.Name)
+		case "screen_name":
+			return decodeString(v, &u.ScreenName)
+		case "location":
+			return decodeString(v, &u.Location)
+		case "url":
+			return decodeString(v, &u.URL)
+		case "description":
+			return decodeString(v, &u.Description)
+		case "protected":
+			return decodeBool(v, &u.Protected)
+		case "verified":
+			return decodeBool(v, &u.Verified)
+		case "followers_count":
+			return decodeInt(v, &u.FollowersCount)
+		case "friends_count":
+			return decodeInt(v, &u.FriendsCount)
+		case "listed_count":
+			return decodeInt(v, &u.ListedCount)
+		case "favourites_count":
+			return decodeInt(v, &u.FavouritesCount)
+		case "statuses_count":
+			return decodeInt(v, &u.StatusesCount)
+		case "created_at":
+			return u.CreatedAt.UnmarshalJSON(v)
+		case "geo_enabled":
+			return decodeBool(v, &u.GeoEnabled)
+		case "lang":
+			return decodeString(v, &u.Lang)
+		case "profile_image_url_https":
+			return decodeString(v, &u.ProfileImageURLHTTPS)
+		case "default_profile":
+			return decodeBool(v, &u.DefaultProfile)
+		case "default_profile_image":
+			return decodeBool(v, &u.DefaultProfileImage)
+		case "withheld_in_countries":
+			return decodeArray(v, &u.WithheldInCountries, decodeString)
+		}
+		return nil
+	})
+}
+
+// decodeObject calls fn with the key and raw value of each field of the JSON
+// object p. Like encoding/json, the key is unescaped and, because the field
+// names of the decoded types are lower case, folded to lower case.
+func decodeObject(p []byte, fn func(key, v []byte) error) error {
+	return objectEach(p, func(key, v []byte) error {
+		for _, c := range key {
+			if c == '\\' || c >= 0x80 || 'A' <= c && c <= 'Z' {
+				return fn(foldKey(key), v)
+			}
+		}
+		return fn(key, v)
+	})
+}
+
+// foldKey returns the unescaped key in lower case.
+func foldKey(key []byte) []byte {
+	s, ok := rawString(append(append([]byte{'"'}, key...), '"'))
+	if !ok {
+		return key
+	}
+	return []byte(strings.ToLower(s))
+}
+
+func isNull(v []byte) bool {
+	return string(v) == "null"
+}
+
+// decodePtr decodes v to the value pointed to by *x using dec, allocating the
+// value as needed. A null value sets *x to nil.
+func decodePtr[T any](v []byte, x **T, dec func(v []byte, x *T) error) error {
+	if isNull(v) {
+		*x = nil
+		return nil
+	}
+	if *x == nil {
+		*x = new(T)
+	}
+	return dec(v, *x)
+}
+
+// decodeArray decodes the JSON array v to s using dec to decode the
+// elements. A null value sets s to nil.
+func decodeArray[T any](v []byte, s *[]T, dec func(v []byte, e *T) error) error {
+	if isNull(v) {
+		*s = nil
+		return nil
+	}
+	a := (*s)[:0]
+	var err error
+	ok := arrayElements(v, func(e []byte) bool {
+		var x T
+		err = dec(e, &x)
+		a = append(a, x)
+		return err == nil
+	})
+	if err != nil {
+		return err
+	}
+	if !ok {
+		return json.Unmarshal(v, s)
+	}
+	if a == nil {
+		a = []T{}
+	}
+	*s = a
+	return nil
+}
+
+func decodeInts(v []byte, s *[]int) error {
+	return decodeArray(v, s, decodeInt)
+}
+
+func decodeFloat64(v []byte, f *float64) error {
+	if x, err := strconv.ParseFloat(string(v), 64); err == nil {
+		*f = x
+		return nil
+	}
+	return json.Unmarshal(v, f)
+}
+
+func decodeString(v []byte, s *string) error {
+	if s2, ok := unquote(v); ok {
+		*s = s2
+		return nil
+	}
+	return json.Unmarshal(v, s)
+}
+
+func decodeInt64(v []byte, n *int64) error {
+	if i, err := strconv.ParseInt(string(v), 10, 64); err == nil {
+		*n = i
+		return nil
+	}
+	return json.Unmarshal(v, n)
+}
+
+func decodeInt(v []byte, n *int) error {
+	if i, err := strconv.Atoi(string(v)); err == nil {
+		*n = i
+		return nil
+	}
+	return json.Unmarshal(v, n)
+}
+
+func decodeBool(v []byte, b *bool) error {
+	switch string(v) {
+	case "true":
+		*b = true
+		return nil
+	case "false":
+		*b = false
+		return nil
+	}
+	return json.Unmarshal(v, b)
+}
+
+func decodeExtendedTweet(p []byte, et *ExtendedTweet) error {
+	if isNull(p) {
+		return nil
+	}
+	return decodeObject(p, func(key, v []byte) error {
+		switch string(key) {
+		case "full_text":
+			return decodeString(v, &et.FullText)
+		case "display_text_range":
+			return decodeInts(v, &et.DisplayTextRange)
+		case "entities":
+			return decodePtr(v, &et.Entities, decodeEntities)
+		case "extended_entities":
+			return decodePtr(v, &et.ExtendedEntities, decodeEntities)
+		}
+		return nil
+	})
+}
+
+func decodeEntities(p []byte, e *Entities) error {
+	if isNull(p) {
+		return nil
+	}
+	return decodeObject(p, func(key, v []byte) error {
+		switch string(key) {
+		case "hashtags":
+			return decodeArray(v, &e.Hashtags, decodeHashtagEntity)
+		case "symbols":
+			return decodeArray(v, &e.Symbols, decodeHashtagEntity)
+		case "urls":
+			return decodeArray(v, &e.URLs, decodeURLEntity)
+		case "user_mentions":
+			return decodeArray(v, &e.UserMentions, decodeUserMentionEntity)
+		case "media":
+			return decodeArray(v, &e.Media, decodeMediaEntity)
+		}
+		return nil
+	})
+}
+
+func decodeHashtagEntity(p []byte, h *HashtagEntity) error {
+	if isNull(p) {
+		return nil
+	}
+	return decodeObject(p, func(key, v []byte) error {
+		switch string(key) {
+		case "indices":
+			return decodeInts(v, &h.Indices)
+		case "text":
+			return decodeString(v, &h.Text)
+		}
+		return nil
+	})
+}
+
+func decodeURLEntity(p []byte, u *URLEntity) error {
+	if isNull(p) {
+		return nil
+	}
+	return decodeObject(p, func(key, v []byte) error {
+		switch string(key) {
+		case "indices":
+			return decodeInts(v, &u.Indices)
+		case "url":
+			return decodeString(v, &u.URL)
+		case "display_url":
+			return decodeString(v, &u.DisplayURL)
+		case "expanded_url":
+			return decodeString(v, &u.ExpandedURL)
+		}
+		return nil
+	})
+}
+
+func decodeUserMentionEntity(p []byte, m *UserMentionEntity) error {
+	if isNull(p) {
+		return nil
+	}
+	return decodeObject(p, func(key, v []byte) error {
+		switch string(key) {
+		case "indices":
+			return decodeInts(v, &m.Indices)
+		case "id":
+			return decodeInt64(v, &m.ID)
+		case "id_str":
+			return decodeString(v, &m.IDStr)
+		case "name":
+			return decodeString(v, &m.Name)
+		case "screen_name":
+			return decodeString(v, &m.ScreenName)
+		}
+		return nil
+	})
+}
+
+func decodeMediaEntity(p []byte, m *MediaEntity) error {
+	if isNull(p) {
+		return nil
+	}
+	return decodeObject(p, func(key, v []byte) error {
+		switch string(key) {
+		case "indices":
+			return decodeInts(v, &m.Indices)
+		case "id":
+			return decodeInt64(v, &m.ID)
+		case "id_str":
+			return decodeString(v, &m.IDStr)
+		case "type":
+			return decodeString(v, &m.Type)
+		case "url":
+			return decodeString(v, &m.URL)
+		case "display_url":
+			return decodeString(v, &m.DisplayURL)
+		case "expanded_url":
+			return decodeString(v, &m.ExpandedURL)
+		case "media_url_https":
+			return decodeString(v, &m.MediaURLHTTPS)
+		case "video_info":
+			return decodePtr(v, &m.VideoInfo, decodeVideoInfo)
+		}
+		return nil
+	})
+}
+
+func decodeVideoInfo(p []byte, vi *VideoInfo) error {
+	if isNull(p) {
+		return nil
+	}
+	return decodeObject(p, func(key, v []byte) error {
+		switch string(key) {
+		case "aspect_ratio":
+			return decodeInts(v, &vi.AspectRatio)
+		case "duration_millis":
+			return decodeInt(v, &vi.DurationMillis)
+		case "variants":
+			return decodeArray(v, &vi.Variants, decodeVideoVariant)
+		}
+		return nil
+	})
+}
+
+func decodeVideoVariant(p []byte, vv *VideoVariant) error {
+	if isNull(p) {
+		return nil
+	}
+	return decodeObject(p, func(key, v []byte) error {
+		switch string(key) {
+		case "bitrate":
+			return decodeInt(v, &vv.Bitrate)
+		case "content_type":
+			return decodeString(v, &vv.ContentType)
+		case "url":
+			return decodeString(v, &vv.URL)
+		}
+		return nil
+	})
+}
+
+func decodeCoordinates(p []byte, c *Coordinates) error {
+	if isNull(p) {
+		return nil
+	}
+	return decodeObject(p, func(key, v []byte) error {
+		switch string(key) {
+		case "type":
+			return decodeString(v, &c.Type)
+		case "coordinates":
+			return decodePosition(v, &c.Coordinates)
+		}
+		return nil
+	})
+}
+
+// decodePosition decodes a GeoJSON position.
+func decodePosition(v []byte, pos *[2]float64) error {
+	i := 0
+	var err error
+	ok := arrayElements(v, func(e []byte) bool {
+		if i < len(pos) {
+			err = decodeFloat64(e, &pos[i])
+		}
+		i++
+		return err == nil
+	})
+	if err != nil {
+		return err
+	}
+	if !ok {
+		return json.Unmarshal(v, pos)
+	}
+	// Like encoding/json, zero the elements missing from a short array.
+	for ; i < len(pos); i++ {
+		pos[i] = 0
+	}
+	return nil
+}
+
+func decodePlace(p []byte, pl *Place) error {
+	if isNull(p) {
+		return nil
+	}
+	return decodeObject(p, func(key, v []byte) error {
+		switch string(key) {
+		case "id":
+			return decodeString(v, &pl.ID)
+		case "url":
+			return decodeString(v, &pl.URL)
+		case "place_type":
+			return decodeString(v, &pl.PlaceType)
+		case "name":
+			return decodeString(v, &pl.Name)
+		case "full_name":
+			return decodeString(v, &pl.FullName)
+		case "country_code":
+			return decodeString(v, &pl.CountryCode)
+		case "country":
+			return decodeString(v, &pl.Country)
+		case "bounding_box":
+			return decodePtr(v, &pl.BoundingBox, decodePolygon)
+		}
+		return nil
+	})
+}
+
+func decodePolygon(p []byte, pg *Polygon) error {
+	if isNull(p) {
+		return nil
+	}
+	return decodeObject(p, func(key, v []byte) error {
+		switch string(key) {
+		case "type":
+			return decodeString(v, &pg.Type)
+		case "coordinates":
+			return decodeArray(v, &pg.Coordinates, func(v []byte, ring *[][2]float64) error {
+				return decodeArray(v, ring, decodePosition)
+			})
+		}
+		return nil
+	})
+}
@@ -0,0 +1,196 @@
+// Copyright 2010 Gary Burd
+//
+// Licensed under the Apache License, Version 2.0 (the "License"): you may
+// not use this file except in compliance with the License. You may obtain
+// a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+// WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the
+// License for the specific language governing permissions and limitations
+// under the License.
+
+package twitterstream
+
+import (
+	"encoding/json"
+	"reflect"
+	"strconv"
+	"testing"
+)
+
+// Tweet fixtures. The fixtures are tweets from the statuses/filter endpoint
+// with long strings shortened.
+var tweetFixtures = map[string]string{
+	"extended": `{"created_at":"Wed Oct 10 20:19:24 +0000 2018","id":1050118621198921728,"id_str":"1050118621198921728","text":"To make room for more expression, we will now count all emojis as equal—including those with gender‍‍ and skin t… https:\/\/t.co\/MkGjXf9aXm","source":"<a href=\"http:\/\/twitter.com\" rel=\"nofollow\">Twitter Web Client<\/a>","truncated":true,"in_reply_to_status_id":null,"in_reply_to_status_id_str":null,"in_reply_to_user_id":null,"in_reply_to_user_id_str":null,"in_reply_to_screen_name":null,"user":{"id":6253282,"id_str":"6253282","name":"Twitter API","screen_name":"TwitterAPI","location":"San Francisco, CA","url":"https:\/\/developer.twitter.com","description":"The Real Twitter API. Tweets about API changes, service issues and our Developer Platform. Don't get an answer? It's on my website.","protected":false,"verified":true,"followers_count":6129794,"friends_count":12,"listed_count":12899,"favourites_count":31,"statuses_count":3658,"created_at":"Wed May 23 06:01:13 +0000 2007","utc_offset":null,"time_zone":null,"geo_enabled":false,"lang":"en","profile_image_url_https":"https:\/\/pbs.twimg.com\/profile_images\/942858479592554497\/BbazLO9L_normal.jpg","default_profile":false,"default_profile_image":false,"following":null,"follow_request_sent":null,"notifications":null},"geo":null,"coordinates":null,"place":null,"contributors":null,"is_quote_status":false,"extended_tweet":{"full_text":"To make room for more expression, we will now count all emojis as equal—including those with gender‍‍ and skin tone modifiers 👍🏻👍🏽👍🏿. This is now reflected in Twitter-Text, our Open Source library. \n\nUsing Twitter-Text? See the forum post for detail: https:\/\/t.co\/Nx1XZmRCXA","display_text_range":[0,277],"entities":{"hashtags":[],"urls":[{"url":"https:\/\/t.co\/Nx1XZmRCXA","expanded_url":"https:\/\/twittercommunity.com\/t\/new-update-to-the-twitter-text-library-emoji-character-count\/114607","display_url":"twittercommunity.com\/t\/new-update-to…","indices":[254,277]}],"user_mentions":[],"symbols":[]}},"quote_count":0,"reply_count":0,"retweet_count":0,"favorite_count":0,"entities":{"hashtags":[],"urls":[{"url":"https:\/\/t.co\/MkGjXf9aXm","expanded_url":"https:\/\/twitter.com\/i\/web\/status\/1050118621198921728","display_url":"twitter.com\/i\/web\/status\/1…","indices":[117,140]}],"user_mentions":[],"symbols":[]},"favorited":false,"retweeted":false,"possibly_sensitive":false,"filter_level":"low","lang":"en","timestamp_ms":"1539202764000"}`,
+
+	"retweet": `{"created_at":"Thu Apr 06 15:28:43 +0000 2017","id":850007368138018817,"id_str":"850007368138018817","text":"RT @TwitterDev: 1\/ Today we’re sharing our vision for the future of the Twitter API platform!\nhttps:\/\/t.co\/XweGngmxlP","source":"<a href=\"http:\/\/twitter.com\" rel=\"nofollow\">Twitter Web Client<\/a>","truncated":false,"in_reply_to_status_id":null,"in_reply_to_user_id":null,"user":{"id":6253282,"id_str":"6253282","name":"Twitter API","screen_name":"twitterapi","created_at":"Wed May 23 06:01:13 +0000 2007","followers_count":6172353,"withheld_in_countries":[]},"retweeted_status":{"created_at":"Thu Apr 06 15:24:15 +0000 2017","id":850006245121695744,"id_str":"850006245121695744","text":"1\/ Today we’re sharing our vision for the future of the Twitter API platform!\nhttps:\/\/t.co\/XweGngmxlP","user":{"id":2244994945,"id_str":"2244994945","name":"TwitterDev","screen_name":"TwitterDev"},"is_quote_status":true,"quoted_status_id":849412806835351552,"quoted_status_id_str":"849412806835351552","quoted_status":{"created_at":"Wed Apr 05 00:00:00 +0000 2017","id":849412806835351552,"id_str":"849412806835351552","text":"Quoted \"tweet\" with a tab\tand a backslash \\ and café","user":{"id":1,"id_str":"1","name":"Quoted","screen_name":"quoted"},"entities":{"hashtags":[{"text":"dev","indices":[0,4]}],"urls":[],"user_mentions":[{"screen_name":"TwitterDev","name":"TwitterDev","id":2244994945,"id_str":"2244994945","indices":[5,16]}]}},"entities":{"hashtags":[],"urls":[{"url":"https:\/\/t.co\/XweGngmxlP","expanded_url":"https:\/\/cards.twitter.com\/cards\/18ce53wgo4h\/3xo1c","display_url":"cards.twitter.com\/cards\/18ce53wg…","indices":[76,99]}],"user_mentions":[]},"retweet_count":284,"favorite_count":0,"lang":"en"},"is_quote_status":false,"retweet_count":284,"favorite_count":0,"entities":{"hashtags":[],"urls":[],"user_mentions":[{"screen_name":"TwitterDev","name":"TwitterDev","id":2244994945,"id_str":"2244994945","indices":[3,14]}]},"favorited":false,"retweeted":false,"lang":"en","timestamp_ms":"1491492523000"}`,
+
+	"media": `{"created_at":"Fri Sep 18 18:36:15 +0000 2020","id":1307025659294674945,"id_str":"1307025659294674945","full_text":"Here’s a video https:\/\/t.co\/abc","display_text_range":[0,15],"user":{"id":783214,"id_str":"783214","name":"Twitter","screen_name":"Twitter","verified":true},"coordinates":{"type":"Point","coordinates":[-122.40612,37.78217]},"place":{"id":"5a110d312052166f","url":"https:\/\/api.twitter.com\/1.1\/geo\/id\/5a110d312052166f.json","place_type":"city","name":"San Francisco","full_name":"San Francisco, CA","country_code":"US","country":"United States","bounding_box":{"type":"Polygon","coordinates":[[[-122.514926,37.708075],[-122.357031,37.708075],[-122.357031,37.833238],[-122.514926,37.833238]]]}},"entities":{"hashtags":[],"urls":[],"user_mentions":[],"media":[{"id":1307025625194414080,"id_str":"1307025625194414080","indices":[16,39],"media_url_https":"https:\/\/pbs.twimg.com\/ext_tw_video_thumb\/1307025625194414080\/pu\/img\/x.jpg","url":"https:\/\/t.co\/abc","display_url":"pic.twitter.com\/abc","expanded_url":"https:\/\/twitter.com\/Twitter\/status\/1307025659294674945\/video\/1","type":"video"}]},"extended_entities":{"media":[{"id":1307025625194414080,"id_str":"1307025625194414080","indices":[16,39],"media_url_https":"https:\/\/pbs.twimg.com\/ext_tw_video_thumb\/1307025625194414080\/pu\/img\/x.jpg","type":"video","video_info":{"aspect_ratio":[16,9],"duration_millis":6000,"variants":[{"bitrate":832000,"content_type":"video\/mp4","url":"https:\/\/video.twimg.com\/ext_tw_video\/1307025625194414080\/pu\/vid\/640x360\/a.mp4"},{"content_type":"application\/x-mpegURL","url":"https:\/\/video.twimg.com\/ext_tw_video\/1307025625194414080\/pu\/pl\/b.m3u8"}]}}]},"possibly_sensitive":false,"lang":"en","timestamp_ms":"1600454175000"}`,
+}
+
+// Edge cases for the decoder.
+var tweetEdgeCases = map[string]string{
+	"escapes":        `{"text":"\"\\\/\b\f\n\r\tAé中"}`,
+	"surrogate pair": `{"text":"😀 😀"}`,
+	"lone high":      `{"text":"a\ud83db"}`,
+	"lone low":       `{"text":"a\ude00b"}`,
+	"high then BMP":  `{"text":"\ud83dA"}`,
+	"high at end":    `{"text":"\ud83d"}`,
+	"two highs":      `{"text":"\ud83d😀"}`,
+	"invalid utf8":   "{\"text\":\"a\xffb\"}",
+	"raw unicode":    `{"text":"café 👍"}`,
+	"null fields":    `{"id":null,"id_str":null,"text":null,"truncated":null,"user":null,"coordinates":null,"place":null,"entities":null,"display_text_range":null,"withheld_in_countries":null,"quote_count":null}`,
+	"empty arrays":   `{"display_text_range":[],"withheld_in_countries":[],"entities":{"hashtags":[],"urls":[]}}`,
+	"whitespace":     " { \"id\" : 1 , \"user\" : { \"id\" : 2 } , \"display_text_range\" : [ 0 , 1 ] } ",
+	"unknown fields": `{"unknown":{"a":[1,{"b":"\"}"}]},"id":3,"geo":null,"contributors":[1,2]}`,
+	"short position": `{"coordinates":{"type":"Point","coordinates":[1.5]}}`,
+	"exponent":       `{"coordinates":{"type":"Point","coordinates":[1e2,-2.5E-1]}}`,
+	"empty":          `{}`,
+	"folded keys":    `{"ID_STR":"5","Text":"x","USER":{"Screen_Name":"a"},"Entities":{"HashTags":[{"TEXT":"go"}]}}`,
+	"escaped keys":   `{"te\u0078t":"x","us\u0065r":{"id\u005fstr":"1"}}`,
+	"kelvin key":     `{"\u212aelvin":1,"loc\u212a":2}`,
+}
+
+// decodedTypes are the types decoded by the functions in tweetjson.go.
+var decodedTypes = map[reflect.Type]bool{
+	reflect.TypeOf(Tweet{}):             true,
+	reflect.TypeOf(User{}):              true,
+	reflect.TypeOf(ExtendedTweet{}):     true,
+	reflect.TypeOf(Entities{}):          true,
+	reflect.TypeOf(HashtagEntity{}):     true,
+	reflect.TypeOf(URLEntity{}):         true,
+	reflect.TypeOf(UserMentionEntity{}): true,
+	reflect.TypeOf(MediaEntity{}):       true,
+	reflect.TypeOf(VideoInfo{}):         true,
+	reflect.TypeOf(VideoVariant{}):      true,
+	reflect.TypeOf(Coordinates{}):       true,
+	reflect.TypeOf(Place{}):             true,
+	reflect.TypeOf(Polygon{}):           true,
+}
+
+// compareValues reports the differences between got, decoded with
+// decodeTweet, and want, decoded with encoding/json.
+func compareValues(t *testing.T, path string, got, want reflect.Value) {
+	t.Helper()
+	switch got.Kind() {
+	case reflect.Ptr, reflect.Slice:
+		if got.IsNil() != want.IsNil() {
+			t.Errorf("%s: got nil = %v, want nil = %v", path, got.IsNil(), want.IsNil())
+			return
+		}
+		if got.IsNil() {
+			return
+		}
+		if got.Kind() == reflect.Ptr {
+			compareValues(t, path, got.Elem(), want.Elem())
+			return
+		}
+		fallthrough
+	case reflect.Array:
+		if got.Len() != want.Len() {
+			t.Errorf("%s: got len %d, want len %d", path, got.Len(), want.Len())
+			return
+		}
+		for i := 0; i < got.Len(); i++ {
+			compareValues(t, path+"["+strconv.Itoa(i)+"]", got.Index(i), want.Index(i))
+		}
+	case reflect.Struct:
+		if !decodedTypes[got.Type()] {
+			if !reflect.DeepEqual(got.Interface(), want.Interface()) {
+				t.Errorf("%s: got %#v, want %#v", path, got.Interface(), want.Interface())
+			}
+			return
+		}
+		for i := 0; i < got.NumField(); i++ {
+			compareValues(t, path+"."+got.Type().Field(i).Name, got.Field(i), want.Field(i))
+		}
+	default:
+		if !reflect.DeepEqual(got.Interface(), want.Interface()) {
+			t.Errorf("%s: got %#v, want %#v", path, got.Interface(), want.Interface())
+		}
+	}
+}
+
+// checkTweetJSON decodes each document in order to the same Tweet with
+// decodeTweet and to another Tweet with encoding/json and compares the
+// results.
+func checkTweetJSON(t *testing.T, docs ...string) {
+	t.Helper()
+	var got, want Tweet
+	for _, doc := range docs {
+		gotErr := decodeTweet([]byte(doc), &got)
+		wantErr := json.Unmarshal([]byte(doc), &want)
+		if (gotErr != nil) != (wantErr != nil) {
+			t.Fatalf("got error %v, want error %v", gotErr, wantErr)
+		}
+	}
+	compareValues(t, "Tweet", reflect.ValueOf(got), reflect.ValueOf(want))
+}
+
+func TestDecodeTweet(t *testing.T) {
+	for name, doc := range tweetFixtures {
+		t.Run(name, func(t *testing.T) { checkTweetJSON(t, doc) })
+	}
+	for name, doc := range tweetEdgeCases {
+		t.Run(name, func(t *testing.T) { checkTweetJSON(t, doc) })
+	}
+}
+
+func TestDecodeTweetReuse(t *testing.T) {
+	docs := make(map[string]string)
+	for name, doc := range tweetFixtures {
+		docs[name] = doc
+	}
+	for name, doc := range tweetEdgeCases {
+		docs[name] = doc
+	}
+	for firstName, first := range tweetFixtures {
+		for secondName, second := range docs {
+			t.Run(firstName+"/"+secondName, func(t *testing.T) { checkTweetJSON(t, first, second) })
+		}
+	}
+}
+
+func TestDecodeTweetErrors(t *testing.T) {
+	for _, doc := range []string{
+		`{"id":"x"}`,
+		`{"id":1.5}`,
+		`{"text":1}`,
+		`{"truncated":"yes"}`,
+		`{"user":[]}`,
+		`{"display_text_range":{}}`,
+		`{"text":"\x"}`,
+		`{"text":"\u12"}`,
+		`[]`,
+	} {
+		var tw Tweet
+		if err := decodeTweet([]byte(doc), &tw); err == nil {
+			t.Errorf("decodeTweet(%s) returned nil error", doc)
+		}
+	}
+}
+
+// embeddedTweet is an application type that embeds Tweet.
+type embeddedTweet struct {
+	Tweet
+	Extra string `json:"extra"`
+}
+
+func TestEmbeddedTweet(t *testing.T) {
+	p := []byte(`{"id_str":"1","text":"hello","user":{"id_str":"2"},"extra":"x"}`)
+	for name, unmarshal := range map[string]func([]byte, interface{}) error{
+		"encoding/json": json.Unmarshal,
+		"jsonDecoder":   jsonDecoder{}.Unmarshal,
+	} {
+		var v embeddedTweet
+		if err := unmarshal(p, &v); err != nil {
+			t.Fatalf("%s: %v", name, err)
+		}
+		if v.Extra != "x" || v.IDStr != "1" || v.Text != "hello" || v.User == nil || v.User.IDStr != "2" {
+			t.Errorf("%s: got %+v", name, v)
+		}
+	}
+}
@@ -0,0 +1,266 @@
+// Copyright 2010 Gary Burd
+//
+// Licensed under the Apache License, Version 2.0 (the "License"): you may
+// not use this file except in compliance with the License. You may obtain
+// a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS, WITHOUT
+// WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied. See the
+// License for the specific language governing permissions and limitations
+// under the License.
+
+package twitterstream
+
+import (
+	"context"
+	"net/url"
+	"strconv"
+	"time"
+)
+
+// Twitter API v2 stream endpoints.
+const (
+	FilteredStreamV2URL = "https://api.twitter.com/2/tweets/search/stream"
+	SampleStreamV2URL   = "https://api.twitter.com/2/tweets/sample/stream"
+)
+
+// OpenFilteredV2 opens the Twitter API v2 filtered stream. The v2 endpoints
+// use application-only authentication and GET requests. The stream delivers
+// tweets matching the rules added to the application's rule set. Decode the
+// lines read from the stream to a ResponseV2.
+func OpenFilteredV2(ctx context.Context, bearerToken string, params url.Values, options ...OpenOption) (*Stream, error) {
+	return OpenBearer(ctx, bearerToken, FilteredStreamV2URL, params, v2Options(options)...)
+}
+
+// OpenSampleV2 opens the Twitter API v2 sampled stream. The stream delivers a
+// random sample of about one percent of all public tweets. Decode the lines
+// read from the stream to a ResponseV2.
+func OpenSampleV2(ctx context.Context, bearerToken string, params url.Values, options ...OpenOption) (*Stream, error) {
+	return OpenBearer(ctx, bearerToken, SampleStreamV2URL, params, v2Options(options)...)
+}
+
+// maxBackfill is the longest period that can be recovered with the
+// backfill_minutes parameter.
+const maxBackfill = 5 * time.Minute
+
+// NewReconnectingStreamV2 returns a reconnecting stream for a v2 endpoint.
+// The arguments have the same meaning as the arguments to OpenBearer.
+//
+// If the OpenBackfill option is specified, then the stream requests the
+// tweets missed while disconnected using the backfill_minutes parameter. The
+// parameter is set to the number of minutes since the last message was
+// received, up to the maximum of five minutes supported by Twitter. Backfill
+// is available to Academic Research and Enterprise projects only.
+func NewReconnectingStreamV2(bearerToken string, urlStr string, params url.Values, options ...OpenOption) *ReconnectingStream {
+	options = v2Options(options)
+	backfill := newOpenOptions(options).backfill
+	return newReconnectingStream(func(ctx context.Context, gap time.Duration, params url.Values) (*Stream, error) {
+		p := params
+		if backfill && gap > 0 {
+			p = url.Values{}
+			for k, v := range params {
+				p[k] = v
+			}
+			p.Set("backfill_minutes", strconv.Itoa(backfillMinutes(gap)))
+		}
+		return OpenBearer(ctx, bearerToken, urlStr, p, options...)
+	}, params, options)
+}
+
+// backfillMinutes returns the backfill_minutes parameter for recovering the
+// tweets missed in gap.
+func backfillMinutes(gap time.Duration) int {
+	if gap > maxBackfill {
+		gap = maxBackfill
+	}
+	return int((gap + time.Minute - 1) / time.Minute)
+}
+
+// v2Options returns the default options for v2 endpoints followed by the
+// application's options.
+func v2Options(options []OpenOption) []OpenOption {
+	return withMethod("GET", options)
+}
+
+// ResponseV2 is the envelope for a message in a v2 stream.
+type ResponseV2 struct {
+	Data          *TweetV2       `json:"data,omitempty"`
+	Includes      *IncludesV2    `json:"includes,omitempty"`
+	MatchingRules []MatchingRule `json:"matching_rules,omitempty"`
+
+	// Errors is set when Twitter reports a problem with the stream or with
+	// the expansion of an object in Includes.
+	Errors []ErrorV2 `json:"errors,omitempty"`
+}
+
+// TweetV2 is a tweet in the v2 format. Fields other than ID and Text are set
+// only when requested with the tweet.fields parameter.
+type TweetV2 struct {
+	ID                string      `json:"id"`
+	Text              string      `json:"text"`
+	AuthorID          string      `json:"author_id,omitempty"`
+	ConversationID    string      `json:"conversation_id,omitempty"`
+	CreatedAt         TwitterTime `json:"created_at,omitzero"`
+	InReplyToUserID   string      `json:"in_reply_to_user_id,omitempty"`
+	Lang              string      `json:"lang,omitempty"`
+	PossiblySensitive bool        `json:"possibly_sensitive,omitempty"`
+	Source            string      `json:"source,omitempty"`
+
+	ReferencedTweets []ReferencedTweetV2 `json:"referenced_tweets,omitempty"`
+	Attachments      *AttachmentsV2      `json:"attachments,omitempty"`
+	Geo              *GeoV2              `json:"geo,omitempty"`
+}
+
+// AttachmentsV2 references the media and polls attached to a tweet. Request
+// the objects with the attachments.media_keys and attachments.poll_ids
+// expansions.
+type AttachmentsV2 struct {
+	MediaKeys []string `json:"media_keys,omitempty"`
+	PollIDs   []string `json:"poll_ids,omitempty"`
+}
+
+// GeoV2 references the place tagged in a tweet. Request the place with the
+// geo.place_id expansion.
+type GeoV2 struct {
+	PlaceID     string       `json:"place_id,omitempty"`
+	Coordinates *Coordinates `json:"coordinates,omitempty"`
+}
+
+// ReferencedTweetV2 is a reference from a tweet to a retweeted, quoted or
+// replied to tweet.
+type ReferencedTweetV2 struct {
+	// Type is "retweeted", "quoted" or "replied_to".
+	Type string `json:"type"`
+	ID   string `json:"id"`
+}
+
+// UserV2 is a user in the v2 format. Fields other than ID, Name and Username
+// are set only when requested with the user.fields parameter.
+type UserV2 struct {
+	ID          string      `json:"id"`
+	Name        string      `json:"name"`
+	Username    string      `json:"username"`
+	CreatedAt   TwitterTime `json:"created_at,omitzero"`
+	Description string      `json:"description,omitempty"`
+	Location    string      `json:"location,omitempty"`
+	Protected   bool        `json:"protected,omitempty"`
+	Verified    bool        `json:"verified,omitempty"`
+}
+
+// MediaV2 is a media object in the v2 format.
+type MediaV2 struct {
+	MediaKey        string `json:"media_key"`
+	Type            string `json:"type"`
+	URL             string `json:"url,omitempty"`
+	PreviewImageURL string `json:"preview_image_url,omitempty"`
+	DurationMs      int    `json:"duration_ms,omitempty"`
+	Height          int    `json:"height,omitempty"`
+	Width           int    `json:"width,omitempty"`
+	AltText         string `json:"alt_text,omitempty"`
+}
+
+// PlaceV2 is a place in the v2 format.
+type PlaceV2 struct {
+	ID              string   `json:"id"`
+	FullName        string   `json:"full_name"`
+	Name            string   `json:"name,omitempty"`
+	Country         string   `json:"country,omitempty"`
+	CountryCode     string   `json:"country_code,omitempty"`
+	PlaceType       string   `json:"place_type,omitempty"`
+	ContainedWithin []string `json:"contained_within,omitempty"`
+	Geo             *struct {
+		Type string    `json:"type"`
+		BBox []float64 `json:"bbox"`
+	} `json:"geo,omitempty"`
+}
+
+// PollV2 is a poll in the v2 format.
+type PollV2 struct {
+	ID              string         `json:"id"`
+	Options         []PollOptionV2 `json:"options"`
+	DurationMinutes int            `json:"duration_minutes,omitempty"`
+	EndDatetime     string         `json:"end_datetime,omitempty"`
+	VotingStatus    string         `json:"voting_status,omitempty"`
+}
+
+// PollOptionV2 is a choice in a poll.
+type PollOptionV2 struct {
+	Position int    `json:"position"`
+	Label    string `json:"label"`
+	Votes    int    `json:"votes"`
+}
+
+// IncludesV2 holds the objects referenced by a tweet and requested with the
+// expansions parameter.
+type IncludesV2 struct {
+	Tweets []TweetV2 `json:"tweets,omitempty"`
+	Users  []UserV2  `json:"users,omitempty"`
+	Media  []MediaV2 `json:"media,omitempty"`
+	Places []PlaceV2 `json:"places,omitempty"`
+	Polls  []PollV2  `json:"polls,omitempty"`
+}
+
+// Tweet returns the included tweet with the given ID or nil if the tweet is
+// not included.
+func (inc *IncludesV2) Tweet(id string) *TweetV2 {
+	for i := range inc.Tweets {
+		if inc.Tweets[i].ID == id {
+			return &inc.Tweets[i]
+		}
+	}
+	return nil
+}
+
+// User returns the included user with the given ID or nil if the user is not
+// included.
+func (inc *IncludesV2) User(id string) *UserV2 {
+	for i := range inc.Users {
+		if inc.Users[i].ID == id {
+			return &inc.Users[i]
+		}
+	}
+	return nil
+}
+
+// MediaByKey returns the included media with the given key or nil if the
+// media is not included.
+func (inc *IncludesV2) MediaByKey(key string) *MediaV2 {
+	for i := range inc.Media {
+		if inc.Media[i].MediaKey == key {
+			return &inc.Media[i]
+		}
+	}
+	return nil
+}
+
+// Place returns the included place with the given ID or nil if the place is
+// not included.
+func (inc *IncludesV2) Place(id string) *PlaceV2 {
+	for i := range inc.Places {
+		if inc.Places[i].ID == id {
+			return &inc.Places[i]
+		}
+	}
+	return nil
+}
+
+// MatchingRule identifies a filtered stream rule that matched a tweet.
+type MatchingRule struct {
+	ID  string `json:"id"`
+	Tag string `json:"tag,omitempty"`
+}
+
+// ErrorV2 is an error reported by a v2 endpoint.
+type ErrorV2 struct {
+	Title        string      `json:"title"`
+	Detail       string      `json:"detail,omitempty"`
+	Type         string      `json:"type,omitempty"`
+	ResourceType string      `json:"resource_type,omitempty"`
+	ResourceID   string      `json:"resource_id,omitempty"`
+	Parameter    string      `json:"parameter,omitempty"`
+	Value        interface{} `json:"value,omitempty"`
+	Message      string      `json:"message,omitempty"`
+}